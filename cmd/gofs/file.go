@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	gofs "github.com/craimbault/go-fs"
+)
+
+func runCat(goFS *gofs.GoFS, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing file path")
+	}
+
+	// On affiche chaque fichier
+	for _, filePath := range args {
+		fileStream, err := goFS.ReadStream(toKey(filePath))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(os.Stdout, fileStream.Content)
+		fileStream.Content.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runPut(goFS *gofs.GoFS, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage : put <local file|-> <path>")
+	}
+
+	// Si l'on lit l'entree standard, on ne connait pas la taille
+	if args[0] == "-" {
+		return goFS.WriteStream(toKey(args[1]), io.NopCloser(os.Stdin), -1)
+	}
+
+	// Sinon on ouvre le fichier local
+	fd, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Si la destination est un dossier, on garde le nom du fichier
+	dst := toKey(args[1])
+	if dst == "" || strings.HasSuffix(args[1], "/") {
+		dst = toPrefix(dst) + info.Name()
+	}
+
+	return goFS.WriteStream(dst, fd, info.Size())
+}
+
+func runGet(goFS *gofs.GoFS, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return errors.New("usage : get <path> [local file|-]")
+	}
+
+	// On recupere le fichier
+	fileStream, err := goFS.ReadStream(toKey(args[0]))
+	if err != nil {
+		return err
+	}
+	defer fileStream.Content.Close()
+
+	// On determine la destination
+	dst := path.Base(toKey(args[0]))
+	if len(args) == 2 {
+		dst = args[1]
+	}
+	if dst == "-" {
+		_, err = io.Copy(os.Stdout, fileStream.Content)
+		return err
+	}
+
+	// On ecrit le fichier local
+	fd, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(fd, fileStream.Content); err != nil {
+		fd.Close()
+		return err
+	}
+
+	return fd.Close()
+}
+
+func runCp(goFS *gofs.GoFS, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage : cp <src> <dst>")
+	}
+	return goFS.Copy(toKey(args[0]), toKey(args[1]))
+}
+
+func runMv(goFS *gofs.GoFS, args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage : mv <src> <dst>")
+	}
+	return goFS.Move(toKey(args[0]), toKey(args[1]))
+}
+
+func runRm(goFS *gofs.GoFS, args []string) error {
+	// On recupere les options
+	flags := flag.NewFlagSet("rm", flag.ExitOnError)
+	recursive := flags.Bool("r", false, "remove every file under the given prefixes")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		return errors.New("missing file path")
+	}
+
+	for _, filePath := range flags.Args() {
+		// Si l'on est pas en recursif, on supprime juste le fichier
+		if !*recursive {
+			if err := goFS.Delete(toKey(filePath)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Sinon on supprime tous les fichiers sous le prefixe
+		prefix := toPrefix(filePath)
+		files, err := goFS.List(prefix, true)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if err := goFS.Delete(prefix + file); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func runStat(goFS *gofs.GoFS, args []string) error {
+	if len(args) == 0 {
+		return errors.New("missing file path")
+	}
+
+	for _, filePath := range args {
+		info, err := goFS.Stat(toKey(filePath))
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Path: %s\n", toKey(filePath))
+		fmt.Printf("Size: %d\n", info.Size)
+		fmt.Printf("ContentType: %s\n", info.ContentType)
+		fmt.Printf("ETag: %s\n", info.ETag)
+		fmt.Printf("LastModified: %s\n", info.LastModified.Format("2006-01-02 15:04:05 MST"))
+		if info.Encryption != gofs.ENCRYPTION_NONE {
+			fmt.Printf("Encryption: %s\n", info.Encryption)
+		}
+	}
+
+	return nil
+}
+
+func toKey(filePath string) string {
+	return strings.TrimPrefix(filePath, "/")
+}
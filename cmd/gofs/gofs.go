@@ -0,0 +1,138 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	gofs "github.com/craimbault/go-fs"
+	"github.com/rs/zerolog"
+)
+
+// logger est utilise par toutes les instances ouvertes par la commande
+var logger = zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
+
+type command struct {
+	usage string
+	run   func(goFS *gofs.GoFS, args []string) error
+}
+
+var commands = map[string]command{
+	"ls": {
+		usage: "ls [-r] [-l] [path]",
+		run:   runLs,
+	},
+	"cat": {
+		usage: "cat <path>...",
+		run:   runCat,
+	},
+	"put": {
+		usage: "put <local file|-> <path>",
+		run:   runPut,
+	},
+	"get": {
+		usage: "get <path> [local file|-]",
+		run:   runGet,
+	},
+	"cp": {
+		usage: "cp <src> <dst>",
+		run:   runCp,
+	},
+	"mv": {
+		usage: "mv <src> <dst>",
+		run:   runMv,
+	},
+	"rm": {
+		usage: "rm [-r] <path>...",
+		run:   runRm,
+	},
+	"stat": {
+		usage: "stat <path>...",
+		run:   runStat,
+	},
+	"du": {
+		usage: "du [-h] [path]",
+		run:   runDu,
+	},
+	"find": {
+		usage: "find [-name glob] [-regex regex] [-exclude glob] [-min-size bytes] [-max-size bytes] [-newer duration] [-older duration] [-skip-hidden] [-sort name|size|mtime] [-reverse] [-n max] [path]",
+		run:   runFind,
+	},
+	"sync": {
+		usage: "sync [-compare size|mtime|checksum] [-delete] [-dry-run] [-include glob] [-exclude glob] [-workers n] [-v] <src> <dst>",
+		run:   runSync,
+	},
+	"webdav": {
+		usage: "webdav [-listen addr] [-prefix prefix]",
+		run:   runWebdav,
+	},
+}
+
+func main() {
+	// On recupere les options globales
+	configPath := flag.String("config", "gofs.ini", "ini configuration file")
+	sectionName := flag.String("section", "gofs", "ini section describing the backend")
+	dsn := flag.String("url", "", "backend url, used instead of the ini file (env GOFS_URL)")
+	flag.Usage = usage
+	flag.Parse()
+
+	// L'URL peut contenir des secrets, elle est lue apres les options pour ne pas apparaitre dans l'aide
+	if *dsn == "" {
+		*dsn = os.Getenv("GOFS_URL")
+	}
+
+	// On recupere la commande
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	cmd, exists := commands[flag.Arg(0)]
+	if !exists {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+		usage()
+		os.Exit(2)
+	}
+
+	// On initalise le backend
+	var goFS gofs.GoFS
+	var err error
+	if *dsn != "" {
+		goFS, err = openGoFSFromURL(*dsn)
+	} else {
+		goFS, err = openGoFS(*configPath, *sectionName)
+	}
+	if err != nil {
+		log.Fatal("GOFS Backend initialization error : " + err.Error())
+	}
+
+	// On execute la commande
+	if err := cmd.run(&goFS, flag.Args()[1:]); err != nil {
+		log.Fatal(flag.Arg(0) + " : " + err.Error())
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: gofs [-config file] [-section name] [-url url] <command> [args]\n\nCommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %s\n", commands[name].usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nGlobal options:\n")
+	flag.PrintDefaults()
+}
+
+func openGoFS(configPath string, sectionName string) (gofs.GoFS, error) {
+	// Le niveau debug est indique par la cle debug de la section
+	return gofs.NewFromIni(configPath, sectionName, gofs.WithLogger(logger))
+}
+
+func openGoFSFromURL(dsn string) (gofs.GoFS, error) {
+	// Le niveau debug est indique par le parametre debug de l'url
+	return gofs.Open(dsn, gofs.WithLogger(logger))
+}
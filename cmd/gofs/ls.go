@@ -0,0 +1,144 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	gofs "github.com/craimbault/go-fs"
+	"github.com/dustin/go-humanize"
+)
+
+func runLs(goFS *gofs.GoFS, args []string) error {
+	// On recupere les options
+	flags := flag.NewFlagSet("ls", flag.ExitOnError)
+	recursive := flags.Bool("r", false, "list files recursively")
+	long := flags.Bool("l", false, "use a long listing format")
+	flags.Parse(args)
+	prefix := toPrefix(flags.Arg(0))
+
+	// On liste tous les fichiers, les sous dossiers sont deduits des prefixes
+	files, err := goFS.List(prefix, true)
+	if err != nil {
+		return err
+	}
+	entries := make([]string, 0, len(files))
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		// Si l'on est pas en recursif, on ne garde que le premier niveau
+		if i := strings.Index(file, "/"); !*recursive && i >= 0 {
+			if !dirs[file[:i+1]] {
+				dirs[file[:i+1]] = true
+				entries = append(entries, file[:i+1])
+			}
+			continue
+		}
+		entries = append(entries, file)
+	}
+	sort.Strings(entries)
+
+	// Si l'on a pas le format long, on affiche juste les noms
+	if !*long {
+		for _, entry := range entries {
+			fmt.Println(entry)
+		}
+		return nil
+	}
+
+	// Sinon on ajoute les infos de chaque fichier
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, entry := range entries {
+		if dirs[entry] {
+			fmt.Fprintf(w, "-\t-\t%s\t\n", entry)
+			continue
+		}
+		info, err := goFS.Stat(prefix + entry)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t\n", info.Size, info.LastModified.Format("2006-01-02 15:04:05"), entry)
+	}
+	return w.Flush()
+}
+
+func runDu(goFS *gofs.GoFS, args []string) error {
+	// On recupere les options
+	flags := flag.NewFlagSet("du", flag.ExitOnError)
+	human := flags.Bool("h", false, "print sizes in human readable format")
+	flags.Parse(args)
+	prefix := toPrefix(flags.Arg(0))
+
+	// On additionne la taille de tous les fichiers
+	files, err := goFS.List(prefix, true)
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, file := range files {
+		info, err := goFS.Stat(prefix + file)
+		if err != nil {
+			return err
+		}
+		total += info.Size
+	}
+
+	// On affiche le resultat
+	size := fmt.Sprint(total)
+	if *human {
+		size = humanize.IBytes(uint64(total))
+	}
+	fmt.Printf("%s\t%d files\t%s\n", size, len(files), "/"+prefix)
+
+	return nil
+}
+
+func runFind(goFS *gofs.GoFS, args []string) error {
+	// On recupere les options
+	opts := gofs.ListOptions{Recursive: true}
+	flags := flag.NewFlagSet("find", flag.ExitOnError)
+	flags.Var((*globs)(&opts.Include), "name", "only list files matching this glob (repeatable)")
+	flags.Var((*globs)(&opts.IncludeRegex), "regex", "only list files whose relative path matches this regex (repeatable)")
+	flags.Var((*globs)(&opts.Exclude), "exclude", "skip files matching this glob (repeatable)")
+	flags.Int64Var(&opts.MinSize, "min-size", 0, "minimum file size in bytes")
+	flags.Int64Var(&opts.MaxSize, "max-size", 0, "maximum file size in bytes, 0 for no limit")
+	newer := flags.Duration("newer", 0, "only list files modified during this duration")
+	older := flags.Duration("older", 0, "only list files not modified during this duration")
+	flags.BoolVar(&opts.SkipHidden, "skip-hidden", false, "skip hidden files and folders")
+	sortOrder := flags.String("sort", string(gofs.SORT_NAME), "sort order: name, size or mtime")
+	flags.BoolVar(&opts.Reverse, "reverse", false, "reverse the sort order")
+	flags.IntVar(&opts.MaxResults, "n", 0, "maximum number of files, 0 for no limit")
+	flags.Parse(args)
+	prefix := toPrefix(flags.Arg(0))
+	opts.Sort = gofs.SortOrder(*sortOrder)
+	if *newer > 0 {
+		opts.ModifiedAfter = time.Now().Add(-*newer)
+	}
+	if *older > 0 {
+		opts.ModifiedBefore = time.Now().Add(-*older)
+	}
+
+	// On liste les fichiers correspondants
+	files, err := goFS.ListWithOptions(prefix, opts)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		fmt.Println(prefix + file)
+	}
+
+	return nil
+}
+
+func toPrefix(dirPath string) string {
+	// On transforme le chemin en prefixe de dossier, "." et "/" designant la racine
+	dirPath = strings.TrimPrefix(path.Clean("/"+dirPath), "/")
+	if dirPath != "" && !strings.HasSuffix(dirPath, "/") {
+		dirPath += "/"
+	}
+	return dirPath
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	gofs "github.com/craimbault/go-fs"
+	"github.com/dustin/go-humanize"
+)
+
+// globs permet de repeter une option
+type globs []string
+
+func (g *globs) String() string {
+	return strings.Join(*g, ",")
+}
+
+func (g *globs) Set(value string) error {
+	*g = append(*g, value)
+	return nil
+}
+
+func runSync(goFS *gofs.GoFS, args []string) error {
+	// On recupere les options
+	flags := flag.NewFlagSet("sync", flag.ExitOnError)
+	opts := gofs.SyncOptions{}
+	compare := flags.String("compare", string(gofs.SYNC_COMPARE_MTIME), "compare method: size, mtime or checksum")
+	flags.IntVar(&opts.Workers, "workers", gofs.DEFAULT_SYNC_WORKERS, "number of files copied in parallel")
+	flags.BoolVar(&opts.Delete, "delete", false, "delete destination files missing from the source")
+	flags.BoolVar(&opts.DryRun, "dry-run", false, "only report what would be done")
+	flags.Var((*globs)(&opts.Include), "include", "only sync files matching this glob (repeatable)")
+	flags.Var((*globs)(&opts.Exclude), "exclude", "skip files matching this glob (repeatable)")
+	verbose := flags.Bool("v", false, "print every copied and deleted file")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return errors.New("usage : sync [options] <src> <dst>")
+	}
+	opts.Compare = gofs.SyncCompare(*compare)
+
+	// On recupere les deux cotes, chacun etant une url ou un dossier du backend configure
+	src, srcPath, err := syncSide(goFS, flags.Arg(0))
+	if err != nil {
+		return errors.New("source : " + err.Error())
+	}
+	dst, dstPath, err := syncSide(goFS, flags.Arg(1))
+	if err != nil {
+		return errors.New("destination : " + err.Error())
+	}
+	opts.SrcPath, opts.DstPath = srcPath, dstPath
+
+	// On synchronise
+	report, err := gofs.Sync(src, dst, opts)
+	if err != nil {
+		return err
+	}
+
+	// On affiche le rapport
+	if *verbose {
+		for _, file := range report.Copied {
+			fmt.Println("copied  " + file)
+		}
+		for _, file := range report.Deleted {
+			fmt.Println("deleted " + file)
+		}
+	}
+	for _, failure := range report.Failed {
+		fmt.Println("failed  " + failure.Error())
+	}
+	prefix := ""
+	if opts.DryRun {
+		prefix = "(dry run) "
+	}
+	fmt.Printf(
+		"%scopied %d (%s), skipped %d, deleted %d, failed %d\n",
+		prefix, len(report.Copied), humanize.Bytes(uint64(report.Bytes)),
+		len(report.Skipped), len(report.Deleted), len(report.Failed),
+	)
+	if len(report.Failed) > 0 {
+		return errors.New(strconv.Itoa(len(report.Failed)) + " files failed")
+	}
+
+	return nil
+}
+
+func syncSide(goFS *gofs.GoFS, arg string) (gofs.GoFS, string, error) {
+	// Si l'on a une url, on ouvre le backend correspondant
+	if strings.Contains(arg, "://") || strings.HasPrefix(arg, "file:") {
+		other, err := gofs.Open(arg, gofs.WithLogger(logger))
+		return other, "", err
+	}
+
+	// Sinon c'est un dossier du backend configure
+	return *goFS, toPrefix(arg), nil
+}
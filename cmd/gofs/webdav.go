@@ -0,0 +1,30 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	gofs "github.com/craimbault/go-fs"
+	"github.com/craimbault/go-fs/pkg/gofswebdav"
+)
+
+func runWebdav(goFS *gofs.GoFS, args []string) error {
+	// On recupere les options
+	flags := flag.NewFlagSet("webdav", flag.ExitOnError)
+	listen := flags.String("listen", "localhost:8080", "address to listen on")
+	prefix := flags.String("prefix", "", "URL path prefix to strip")
+	flags.Parse(args)
+
+	// On initialise le handler
+	handler := gofswebdav.NewHandler(goFS, *prefix)
+	handler.Logger = func(r *http.Request, err error) {
+		if err != nil {
+			log.Printf("%s %s : %s\n", r.Method, r.URL.Path, err.Error())
+		}
+	}
+
+	// On demarre le serveur
+	log.Printf("Serving WebDAV on http://%s%s/\n", *listen, *prefix)
+	return http.ListenAndServe(*listen, handler)
+}
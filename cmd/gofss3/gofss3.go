@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	gofs "github.com/craimbault/go-fs"
 	"github.com/craimbault/go-fs/pkg/backend/gofsbcks3"
@@ -22,16 +23,13 @@ func main() {
 		Debug:           true,
 	}
 
-	// On indique le niveau de log
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
-	if config.Debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
-	}
+	// On initialise le logger, le niveau debug etant indique par la config
+	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stderr}).With().Timestamp().Logger()
 
 	log.Println("Initializing backend ...")
 
 	// On initalise le backend
-	goFS, err := gofs.New(gofs.BACKEND_TYPE_S3, config)
+	goFS, err := gofs.New(gofs.BACKEND_TYPE_S3, config, gofs.WithLogger(logger))
 	if err != nil {
 		log.Fatal("GOSF Backend initialization error : " + err.Error())
 	}
@@ -1,11 +1,16 @@
 package gofs
 
 import (
+	"context"
 	"errors"
+	"io"
+	"time"
 
 	"github.com/craimbault/go-fs/internal/backend"
 	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbckpolicy"
 	"github.com/craimbault/go-fs/pkg/backend/gofsbcks3"
+	"github.com/rs/zerolog"
 )
 
 type GoFSBackendType string
@@ -15,16 +20,67 @@ const (
 	BACKEND_TYPE_S3    GoFSBackendType = gofsbcks3.BACKEND_NAME
 )
 
+type (
+	FileInfo       = backend.FileInfo
+	FileStream     = backend.FileStream
+	WriteOptions   = backend.WriteOptions
+	ReadOptions    = backend.ReadOptions
+	Encryption     = backend.Encryption
+	EncryptionMode = backend.EncryptionMode
+	Version        = backend.Version
+	Lock           = backend.Lock
+	RetentionMode  = backend.RetentionMode
+	LockedError    = backend.LockedError
+	Event          = backend.Event
+	EventType      = backend.EventType
+	WatchOptions   = backend.WatchOptions
+	ListOptions    = backend.ListOptions
+	SortOrder      = backend.SortOrder
+)
+
+const (
+	ENCRYPTION_NONE    = backend.ENCRYPTION_NONE
+	ENCRYPTION_SSE_S3  = backend.ENCRYPTION_SSE_S3
+	ENCRYPTION_SSE_KMS = backend.ENCRYPTION_SSE_KMS
+	ENCRYPTION_SSE_C   = backend.ENCRYPTION_SSE_C
+
+	RETENTION_NONE       = backend.RETENTION_NONE
+	RETENTION_GOVERNANCE = backend.RETENTION_GOVERNANCE
+	RETENTION_COMPLIANCE = backend.RETENTION_COMPLIANCE
+
+	EVENT_CREATE = backend.EVENT_CREATE
+	EVENT_MODIFY = backend.EVENT_MODIFY
+	EVENT_DELETE = backend.EVENT_DELETE
+
+	SORT_NAME  = backend.SORT_NAME
+	SORT_SIZE  = backend.SORT_SIZE
+	SORT_MTIME = backend.SORT_MTIME
+)
+
+// ErrNotExist est renvoyee lorsque le fichier demande n'existe pas.
+// Elle est compatible avec errors.Is(err, fs.ErrNotExist)
+var ErrNotExist = backend.ErrNotExist
+
+// ErrNotSupported est renvoyee lorsque le backend ne propose pas la fonctionnalite demandee
+var ErrNotSupported = backend.ErrNotSupported
+
+// ErrLocked est renvoyee lorsqu'un fichier protege devait etre modifie ou supprime,
+// l'erreur est une *LockedError compatible avec errors.Is(err, fs.ErrPermission)
+var ErrLocked = backend.ErrLocked
+
 type GoFS struct {
-	bType GoFSBackendType
-	b     backend.Backend
+	bType  GoFSBackendType
+	b      backend.Backend
+	ctx    context.Context
+	logger zerolog.Logger
 }
 
-func New(backendType GoFSBackendType, backendConfig interface{}) (GoFS, error) {
+func New(backendType GoFSBackendType, backendConfig interface{}, opts ...Option) (GoFS, error) {
 	// On initialise le retour
 	gofs := GoFS{
 		bType: backendType,
 	}
+	o := newOptions(opts)
 	var err error
 
 	// En fonction du type de backend
@@ -34,42 +90,278 @@ func New(backendType GoFSBackendType, backendConfig interface{}) (GoFS, error) {
 		if !ok {
 			return gofs, errors.New(string(BACKEND_TYPE_LOCAL) + " config is not valid")
 		}
+		if o.logger != nil {
+			config.Logger = o.logger
+		}
+		gofs.logger = backend.NewLogger(config.Logger, string(backendType), config.Debug)
 		gofs.b, err = gofsbcklocal.New(config)
 	case BACKEND_TYPE_S3:
 		config, ok := backendConfig.(gofsbcks3.S3Config)
 		if !ok {
-			return gofs, errors.New(string(BACKEND_TYPE_LOCAL) + " config is not valid")
+			return gofs, errors.New(string(BACKEND_TYPE_S3) + " config is not valid")
 		}
+		if o.logger != nil {
+			config.Logger = o.logger
+		}
+		gofs.logger = backend.NewLogger(config.Logger, string(backendType), config.Debug)
 		gofs.b, err = gofsbcks3.New(config)
 	default:
 		return gofs, errors.New("unknown backend type")
 	}
 
+	// On ajoute les middlewares autour du backend
+	if err == nil && len(o.middlewares) > 0 {
+		gofs.b = NewMiddlewareBackend(gofs.b, o.middlewares...)
+	}
+
 	// On renvoi les infos
 	return gofs, err
 }
 
+// WithContext renvoie une copie de l'instance dont les appels utiliseront le contexte fourni
+func (gfs GoFS) WithContext(ctx context.Context) GoFS {
+	gfs.ctx = ctx
+	return gfs
+}
+
+// Type renvoie le type du backend d'origine
+func (gfs *GoFS) Type() GoFSBackendType {
+	return gfs.bType
+}
+
+// Backend renvoie le backend utilise, afin de pouvoir l'envelopper (chiffrement, ...)
+func (gfs *GoFS) Backend() backend.Backend {
+	return gfs.b
+}
+
+// WithBackend renvoie une copie de l'instance utilisant le backend fourni,
+// generalement un backend enveloppant celui d'origine
+func (gfs GoFS) WithBackend(b backend.Backend) GoFS {
+	gfs.b = b
+	return gfs
+}
+
+// ReadOnly renvoie une copie de l'instance n'autorisant que le listing et la lecture,
+// les autres appels renvoient une erreur fs.ErrPermission
+func (gfs GoFS) ReadOnly() GoFS {
+	policyBackend, _ := gofsbckpolicy.New(gfs.b, gofsbckpolicy.ReadOnly())
+	gfs.b = policyBackend
+	return gfs
+}
+
+// Context renvoie le contexte utilise pour les appels au backend
+func (gfs *GoFS) Context() context.Context {
+	if gfs.ctx == nil {
+		return context.Background()
+	}
+	return gfs.ctx
+}
+
 func (gfs *GoFS) List(path string, recursive bool) ([]string, error) {
-	return gfs.b.List(path, recursive)
+	start := time.Now()
+	files, err := gfs.b.List(gfs.Context(), path, recursive)
+	gfs.logCall("List", path, start, -1, err)
+	return files, err
+}
+
+// ListWithOptions liste les fichiers du dossier en appliquant les filtres, le tri et la limite des options.
+// Les filtres sont appliques par le backend lorsqu'il le peut, sinon les fichiers sont interroges si necessaire
+func (gfs *GoFS) ListWithOptions(path string, opts ListOptions) ([]string, error) {
+	start := time.Now()
+	var files []string
+	var err error
+	if lister, ok := gfs.b.(backend.FilteredLister); ok {
+		files, err = lister.ListFiltered(gfs.Context(), path, opts)
+	} else {
+		err = ErrNotSupported
+	}
+	if errors.Is(err, ErrNotSupported) {
+		files, err = backend.ListWithOptions(gfs.Context(), gfs.b, path, opts)
+	}
+	gfs.logCall("ListWithOptions", path, start, -1, err)
+	return files, err
 }
-func (gfs *GoFS) Stat(filepath string) (backend.FileInfo, error) {
-	return gfs.b.Stat(filepath)
+func (gfs *GoFS) Stat(filepath string) (FileInfo, error) {
+	start := time.Now()
+	fInfo, err := gfs.b.Stat(gfs.Context(), filepath)
+	gfs.logCall("Stat", filepath, start, -1, err)
+	return fInfo, err
 }
 func (gfs *GoFS) Read(filepath string) ([]byte, error) {
-	return gfs.b.Read(filepath)
+	start := time.Now()
+	data, err := gfs.b.Read(gfs.Context(), filepath)
+	gfs.logCall("Read", filepath, start, int64(len(data)), err)
+	return data, err
 }
 func (gfs *GoFS) ReadString(filepath string) (string, error) {
-	return gfs.b.ReadString(filepath)
+	start := time.Now()
+	content, err := gfs.b.ReadString(gfs.Context(), filepath)
+	gfs.logCall("ReadString", filepath, start, int64(len(content)), err)
+	return content, err
 }
-func (gfs *GoFS) Write(filepath string, data []byte) error {
-	return gfs.b.Write(filepath, data)
+func (gfs *GoFS) ReadStream(filepath string, opts ...ReadOptions) (FileStream, error) {
+	start := time.Now()
+	fileStream, err := gfs.b.ReadStream(gfs.Context(), filepath, opts...)
+	gfs.logCall("ReadStream", filepath, start, fileStream.Size, err)
+	return fileStream, err
 }
-func (gfs *GoFS) WriteString(filepath string, content string) error {
-	return gfs.b.WriteString(filepath, content)
+func (gfs *GoFS) Write(filepath string, data []byte, opts ...WriteOptions) error {
+	start := time.Now()
+	err := gfs.b.Write(gfs.Context(), filepath, data, opts...)
+	gfs.logCall("Write", filepath, start, int64(len(data)), err)
+	return err
+}
+func (gfs *GoFS) WriteString(filepath string, content string, opts ...WriteOptions) error {
+	start := time.Now()
+	err := gfs.b.WriteString(gfs.Context(), filepath, content, opts...)
+	gfs.logCall("WriteString", filepath, start, int64(len(content)), err)
+	return err
+}
+func (gfs *GoFS) WriteStream(filepath string, stream io.ReadCloser, length int64, opts ...WriteOptions) error {
+	start := time.Now()
+	err := gfs.b.WriteStream(gfs.Context(), filepath, stream, length, opts...)
+	gfs.logCall("WriteStream", filepath, start, length, err)
+	return err
+}
+func (gfs *GoFS) Copy(filepathSrc string, filepathDst string) error {
+	start := time.Now()
+	err := gfs.b.Copy(gfs.Context(), filepathSrc, filepathDst)
+	gfs.logCall("Copy", filepathSrc+" -> "+filepathDst, start, -1, err)
+	return err
 }
 func (gfs *GoFS) Move(filepathSrc string, filepathDst string) error {
-	return gfs.b.Move(filepathSrc, filepathDst)
+	start := time.Now()
+	err := gfs.b.Move(gfs.Context(), filepathSrc, filepathDst)
+	gfs.logCall("Move", filepathSrc+" -> "+filepathDst, start, -1, err)
+	return err
 }
 func (gfs *GoFS) Delete(filepath string) error {
-	return gfs.b.Delete(filepath)
+	start := time.Now()
+	err := gfs.b.Delete(gfs.Context(), filepath)
+	gfs.logCall("Delete", filepath, start, -1, err)
+	return err
+}
+func (gfs *GoFS) SetMetadata(filepath string, metadata map[string]string) error {
+	start := time.Now()
+	err := gfs.b.SetMetadata(gfs.Context(), filepath, metadata)
+	gfs.logCall("SetMetadata", filepath, start, -1, err)
+	return err
+}
+
+// ListVersions renvoie les versions d'un fichier, de la plus recente a la plus ancienne.
+// Le backend doit conserver les versions, sans etre enveloppe par un backend qui ne les propose pas
+func (gfs *GoFS) ListVersions(filepath string) ([]Version, error) {
+	start := time.Now()
+	var versions []Version
+	err := ErrNotSupported
+	if versioner, ok := gfs.b.(backend.Versioner); ok {
+		versions, err = versioner.ListVersions(gfs.Context(), filepath)
+	}
+	gfs.logCall("ListVersions", filepath, start, -1, err)
+	return versions, err
+}
+func (gfs *GoFS) ReadVersion(filepath string, versionID string, opts ...ReadOptions) (FileStream, error) {
+	start := time.Now()
+	var fileStream FileStream
+	err := ErrNotSupported
+	if versioner, ok := gfs.b.(backend.Versioner); ok {
+		fileStream, err = versioner.ReadVersion(gfs.Context(), filepath, versionID, opts...)
+	}
+	gfs.logCall("ReadVersion", filepath, start, fileStream.Size, err)
+	return fileStream, err
+}
+func (gfs *GoFS) DeleteVersion(filepath string, versionID string) error {
+	start := time.Now()
+	err := ErrNotSupported
+	if versioner, ok := gfs.b.(backend.Versioner); ok {
+		err = versioner.DeleteVersion(gfs.Context(), filepath, versionID)
+	}
+	gfs.logCall("DeleteVersion", filepath, start, -1, err)
+	return err
+}
+
+// SetRetention protege le fichier contre la modification et la suppression jusqu'a la date indiquee
+func (gfs *GoFS) SetRetention(filepath string, mode RetentionMode, until time.Time) error {
+	start := time.Now()
+	err := ErrNotSupported
+	if locker, ok := gfs.b.(backend.Locker); ok {
+		err = locker.SetRetention(gfs.Context(), filepath, mode, until)
+	}
+	gfs.logCall("SetRetention", filepath, start, -1, err)
+	return err
+}
+func (gfs *GoFS) SetLegalHold(filepath string, on bool) error {
+	start := time.Now()
+	err := ErrNotSupported
+	if locker, ok := gfs.b.(backend.Locker); ok {
+		err = locker.SetLegalHold(gfs.Context(), filepath, on)
+	}
+	gfs.logCall("SetLegalHold", filepath, start, -1, err)
+	return err
+}
+
+// Symlink cree un lien symbolique vers un fichier du backend, FileInfo.IsSymlink l'indique ensuite
+func (gfs *GoFS) Symlink(target string, linkPath string) error {
+	start := time.Now()
+	err := ErrNotSupported
+	if symlinker, ok := gfs.b.(backend.Symlinker); ok {
+		err = symlinker.Symlink(gfs.Context(), target, linkPath)
+	}
+	gfs.logCall("Symlink", linkPath, start, -1, err)
+	return err
+}
+func (gfs *GoFS) Readlink(linkPath string) (string, error) {
+	start := time.Now()
+	target, err := "", ErrNotSupported
+	if symlinker, ok := gfs.b.(backend.Symlinker); ok {
+		target, err = symlinker.Readlink(gfs.Context(), linkPath)
+	}
+	gfs.logCall("Readlink", linkPath, start, -1, err)
+	return target, err
+}
+
+// Logger renvoie le logger de l'instance
+func (gfs *GoFS) Logger() *zerolog.Logger {
+	return &gfs.logger
+}
+
+// Watch renvoie les creations, modifications et suppressions de fichiers sous le prefixe, jusqu'a l'annulation du contexte.
+// Les backends sans notification, ou enveloppes par un decorateur, sont suivis en comparant des listings successifs
+func (gfs *GoFS) Watch(ctx context.Context, prefix string, opts ...WatchOptions) (<-chan Event, error) {
+	start := time.Now()
+	o := backend.MergeWatchOptions(opts)
+	var events <-chan Event
+	var err error
+	if watcher, ok := gfs.b.(backend.Watcher); ok {
+		events, err = watcher.Watch(ctx, prefix, o)
+	} else {
+		err = ErrNotSupported
+	}
+	if errors.Is(err, ErrNotSupported) {
+		events, err = backend.PollBackend(ctx, gfs.b, prefix, o.PollInterval)
+	}
+	if err == nil && o.Debounce > 0 {
+		events = backend.Debounce(ctx, events, o.Debounce)
+	}
+	gfs.logCall("Watch", prefix, start, -1, err)
+	return events, err
+}
+
+// logCall trace un appel avec les champs communs : backend, op, path, duration, bytes (si connu) et error
+func (gfs *GoFS) logCall(op string, path string, start time.Time, bytes int64, err error) {
+	event := gfs.logger.Debug()
+	if event == nil {
+		return
+	}
+	event.
+		Str("op", op).
+		Str("path", path).
+		Dur("duration", time.Since(start))
+	if bytes >= 0 && err == nil {
+		event.Int64("bytes", bytes)
+	}
+	if err != nil {
+		event.Err(err)
+	}
+	event.Send()
 }
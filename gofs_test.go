@@ -0,0 +1,100 @@
+package gofs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+	"github.com/rs/zerolog"
+)
+
+func TestReadOnly(t *testing.T) {
+	goFS := newTestGoFS(t)
+	writeFiles(t, goFS, map[string]string{"file": "content", "dir/other": "other"})
+	readOnly := goFS.ReadOnly()
+
+	tests := []struct {
+		name      string
+		op        func() error
+		wantAllow bool
+	}{
+		{"list", func() error { _, err := readOnly.List("", true); return err }, true},
+		{"stat", func() error { _, err := readOnly.Stat("file"); return err }, true},
+		{"read", func() error { _, err := readOnly.ReadString("file"); return err }, true},
+		{"read stream", func() error {
+			fileStream, err := readOnly.ReadStream("file")
+			if err == nil {
+				fileStream.Content.Close()
+			}
+			return err
+		}, true},
+		{"write", func() error { return readOnly.WriteString("file", "changed") }, false},
+		{"write stream", func() error {
+			return readOnly.WriteStream("new", io.NopCloser(bytes.NewReader([]byte("new"))), 3)
+		}, false},
+		{"copy", func() error { return readOnly.Copy("file", "copy") }, false},
+		{"move", func() error { return readOnly.Move("file", "moved") }, false},
+		{"delete", func() error { return readOnly.Delete("dir/other") }, false},
+		{"set metadata", func() error { return readOnly.SetMetadata("file", map[string]string{"k": "v"}) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.op()
+			if tt.wantAllow && err != nil {
+				t.Errorf("error = %v, want nil", err)
+			} else if !tt.wantAllow && !errors.Is(err, fs.ErrPermission) {
+				t.Errorf("error = %v, want %v", err, fs.ErrPermission)
+			}
+		})
+	}
+
+	// L'instance d'origine reste modifiable et les fichiers sont intacts
+	if content, err := goFS.ReadString("file"); err != nil || content != "content" {
+		t.Errorf("content = %q, %v, want %q", content, err, "content")
+	}
+	if err := goFS.WriteString("file", "changed"); err != nil {
+		t.Errorf("write on the original instance : %v", err)
+	}
+}
+
+func TestNotSupported(t *testing.T) {
+	// Le backend est enveloppe sans ses fonctionnalites optionnelles
+	var logs bytes.Buffer
+	goFS, err := New(BACKEND_TYPE_LOCAL, gofsbcklocal.LocalConfig{BasePath: t.TempDir(), Debug: true}, WithLogger(zerolog.New(&logs)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFS = goFS.WithBackend(struct{ backend.Backend }{goFS.Backend()})
+
+	tests := []struct {
+		op   string
+		call func() error
+	}{
+		{"ListVersions", func() error { _, err := goFS.ListVersions("file"); return err }},
+		{"ReadVersion", func() error { _, err := goFS.ReadVersion("file", "id"); return err }},
+		{"DeleteVersion", func() error { return goFS.DeleteVersion("file", "id") }},
+		{"SetRetention", func() error { return goFS.SetRetention("file", RETENTION_GOVERNANCE, time.Now().Add(time.Hour)) }},
+		{"SetLegalHold", func() error { return goFS.SetLegalHold("file", true) }},
+		{"Symlink", func() error { return goFS.Symlink("file", "link") }},
+		{"Readlink", func() error { _, err := goFS.Readlink("link"); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.op, func(t *testing.T) {
+			logs.Reset()
+			if err := tt.call(); !errors.Is(err, ErrNotSupported) {
+				t.Errorf("error = %v, want %v", err, ErrNotSupported)
+			}
+
+			// L'appel est journalise comme les autres
+			if !strings.Contains(logs.String(), `"op":"`+tt.op+`"`) || !strings.Contains(logs.String(), ErrNotSupported.Error()) {
+				t.Errorf("logs = %s, want the unsupported call logged", logs.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package gofs
+
+import (
+	"errors"
+
+	"github.com/craimbault/go-fs/internal/iniconfig"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbckpolicy"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcks3"
+	"gopkg.in/ini.v1"
+)
+
+// iniConfigParsers associe chaque type de backend a la lecture de sa configuration ini
+var iniConfigParsers = map[GoFSBackendType]func(section *ini.Section) (interface{}, error){
+	BACKEND_TYPE_LOCAL: func(section *ini.Section) (interface{}, error) {
+		return gofsbcklocal.NewConfigFromIniSectionE(section)
+	},
+	BACKEND_TYPE_S3: func(section *ini.Section) (interface{}, error) {
+		return gofsbcks3.NewConfigFromIniSectionE(section)
+	},
+}
+
+// NewFromIni initialise une instance depuis la section d'un fichier ini
+func NewFromIni(path string, sectionName string, opts ...Option) (GoFS, error) {
+	// On charge le fichier
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return GoFS{}, errors.New("unable to load ini file : " + err.Error())
+	}
+
+	// On recupere la section
+	section, err := cfg.GetSection(sectionName)
+	if err != nil {
+		return GoFS{}, errors.New("unable to find section[" + sectionName + "] : " + err.Error())
+	}
+
+	return NewFromIniSection(section, opts...)
+}
+
+// NewFromIniSection initialise une instance depuis une section ini,
+// dont la cle type indique le backend a utiliser
+func NewFromIniSection(section *ini.Section, opts ...Option) (GoFS, error) {
+	// On recupere le type de backend
+	backendType, err := iniconfig.RequiredString(section, "type")
+	if err != nil {
+		return GoFS{}, err
+	}
+	parseConfig, exists := iniConfigParsers[GoFSBackendType(backendType)]
+	if !exists {
+		return GoFS{}, errors.New("unknown backend type[" + backendType + "] in section[" + section.Name() + "]")
+	}
+
+	// On recupere la configuration du backend
+	config, err := parseConfig(section)
+	if err != nil {
+		return GoFS{}, err
+	}
+
+	// On recupere la politique d'acces
+	policy, hasPolicy, err := gofsbckpolicy.NewConfigFromIniSection(section)
+	if err != nil {
+		return GoFS{}, err
+	}
+
+	// On initialise l'instance, protegee par la politique si besoin
+	gofs, err := New(GoFSBackendType(backendType), config, opts...)
+	if err != nil || !hasPolicy {
+		return gofs, err
+	}
+	policyBackend, err := gofsbckpolicy.New(gofs.Backend(), policy)
+	if err != nil {
+		return GoFS{}, errors.New(err.Error() + " in section[" + section.Name() + "]")
+	}
+
+	return gofs.WithBackend(policyBackend), nil
+}
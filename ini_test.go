@@ -0,0 +1,104 @@
+package gofs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+	"gopkg.in/ini.v1"
+)
+
+// loadSection lit la section gofs d'un contenu ini
+func loadSection(t *testing.T, content string) *ini.Section {
+	t.Helper()
+	cfg, err := ini.Load([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	section, err := cfg.GetSection("gofs")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return section
+}
+
+func TestNewFromIniSection(t *testing.T) {
+	basePath := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"local", "[gofs]\ntype = local\nbase_path = " + basePath + "\ndebug = false\n", ""},
+		{"missing type", "[gofs]\nbase_path = " + basePath + "\n", "missing required key[type] in section[gofs]"},
+		{"empty type", "[gofs]\ntype = \nbase_path = " + basePath + "\n", "missing required key[type] in section[gofs]"},
+		{"unknown type", "[gofs]\ntype = ftp\n", "unknown backend type[ftp] in section[gofs]"},
+		{"local without base path", "[gofs]\ntype = local\n", "missing required key[base_path] in section[gofs]"},
+		{"local invalid debug", "[gofs]\ntype = local\nbase_path = " + basePath + "\ndebug = maybe\n", "invalid boolean value for key[debug] in section[gofs]"},
+		{"s3 without endpoint", "[gofs]\ntype = s3\nbucket_name = gofs\n", "missing required key[endpoint] in section[gofs]"},
+		{"s3 without bucket", "[gofs]\ntype = s3\nendpoint = localhost:9000\n", "missing required key[bucket_name] in section[gofs]"},
+		{"s3 invalid ssl", "[gofs]\ntype = s3\nendpoint = localhost:9000\nbucket_name = gofs\naccess_key = a\nsecret_key = b\nssl = 2\n", "invalid boolean value for key[ssl] in section[gofs]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goFS, err := NewFromIniSection(loadSection(t, tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+
+			// L'instance utilise bien le dossier configure
+			if err = goFS.WriteString("file", "content"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err = os.Stat(filepath.Join(basePath, "file")); err != nil {
+				t.Errorf("file not written in base path : %v", err)
+			}
+		})
+	}
+}
+
+func TestNewFromIni(t *testing.T) {
+	iniPath := filepath.Join(t.TempDir(), "gofs.ini")
+	content := "[data]\ntype = local\nbase_path = " + t.TempDir() + "\n"
+	if err := os.WriteFile(iniPath, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		section string
+		wantErr string
+	}{
+		{"existing section", iniPath, "data", ""},
+		{"missing section", iniPath, "other", "unable to find section[other]"},
+		{"missing file", iniPath + ".missing", "data", "unable to load ini file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewFromIni(tt.path, tt.section)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewConfigFromIniSectionDefaults(t *testing.T) {
+	// La version historique ne renvoie pas d'erreur et applique les valeurs par defaut
+	config := gofsbcklocal.NewConfigFromIniSection(loadSection(t, "[gofs]\ndebug = maybe\n"))
+	if config.BasePath != "" || config.Debug {
+		t.Errorf("config = %+v, want the default values", config)
+	}
+}
@@ -1,21 +1,26 @@
 package backend
 
 import (
+	"context"
 	"io"
+	"io/fs"
+	"strings"
 	"time"
 )
 
 type Backend interface {
-	List(path string, recursive bool) ([]string, error)
-	Stat(filepath string) (FileInfo, error)
-	Read(filepath string) ([]byte, error)
-	ReadString(filepath string) (string, error)
-	ReadStream(filepath string) (FileStream, error)
-	Write(filepath string, data []byte) error
-	WriteString(filepath string, content string) error
-	WriteStream(filepath string, stream io.ReadCloser, length int64) error
-	Move(filepathSrc string, filepathDst string) error
-	Delete(filepath string) error
+	List(ctx context.Context, path string, recursive bool) ([]string, error)
+	Stat(ctx context.Context, filepath string) (FileInfo, error)
+	Read(ctx context.Context, filepath string) ([]byte, error)
+	ReadString(ctx context.Context, filepath string) (string, error)
+	ReadStream(ctx context.Context, filepath string, opts ...ReadOptions) (FileStream, error)
+	Write(ctx context.Context, filepath string, data []byte, opts ...WriteOptions) error
+	WriteString(ctx context.Context, filepath string, content string, opts ...WriteOptions) error
+	WriteStream(ctx context.Context, filepath string, stream io.ReadCloser, length int64, opts ...WriteOptions) error
+	Copy(ctx context.Context, filepathSrc string, filepathDst string) error
+	Move(ctx context.Context, filepathSrc string, filepathDst string) error
+	Delete(ctx context.Context, filepath string) error
+	SetMetadata(ctx context.Context, filepath string, metadata map[string]string) error
 }
 
 type FileInfo struct {
@@ -23,6 +28,18 @@ type FileInfo struct {
 	ETag         string
 	ContentType  string
 	Size         int64
+	Encryption   EncryptionMode
+	// Identifiant de la version courante, vide si le backend ne conserve pas les versions
+	VersionID string
+	// Protection du fichier, si le backend la gere
+	Lock Lock
+	// Date d'expiration du fichier, zero s'il n'expire pas
+	ExpiresAt time.Time
+	// Le fichier est un lien symbolique, vers la cible indiquee
+	IsSymlink     bool
+	SymlinkTarget string
+	// Metadonnees utilisateur, dont les cles sont en minuscules
+	Metadata map[string]string
 }
 
 type FileStream struct {
@@ -30,3 +47,112 @@ type FileStream struct {
 	ContentType string
 	Content     io.ReadCloser
 }
+
+type EncryptionMode string
+
+const (
+	ENCRYPTION_NONE    EncryptionMode = ""
+	ENCRYPTION_SSE_S3  EncryptionMode = "sse-s3"
+	ENCRYPTION_SSE_KMS EncryptionMode = "sse-kms"
+	ENCRYPTION_SSE_C   EncryptionMode = "sse-c"
+)
+
+// Encryption decrit le chiffrement cote serveur a appliquer a un fichier
+type Encryption struct {
+	Mode EncryptionMode
+	// Identifiant et contexte de la cle pour le mode SSE-KMS
+	KMSKeyID   string
+	KMSContext map[string]string
+	// Cle de 32 octets fournie par le client pour le mode SSE-C
+	CustomerKey []byte
+}
+
+// String decrit le chiffrement sans jamais afficher la cle client
+func (e Encryption) String() string {
+	switch e.Mode {
+	case ENCRYPTION_SSE_KMS:
+		return string(e.Mode) + "(" + e.KMSKeyID + ")"
+	case ENCRYPTION_SSE_C:
+		return string(e.Mode) + "(REDACTED)"
+	}
+	return string(e.Mode)
+}
+
+// WriteOptions permet de modifier le comportement d'une ecriture
+type WriteOptions struct {
+	// Chiffrement cote serveur, remplace celui de la configuration du backend
+	Encryption *Encryption
+	// Metadonnees utilisateur enregistrees avec le fichier, les cles sont passees en minuscules
+	Metadata map[string]string
+	// Date d'expiration du fichier, ou duree de vie a partir de l'ecriture si ExpiresAt n'est pas indique.
+	// Un fichier expire n'est plus lisible et est supprime par le janitor
+	ExpiresAt *time.Time
+	TTL       time.Duration
+}
+
+// Expiry renvoie la date d'expiration demandee, zero si le fichier n'expire pas
+func (o WriteOptions) Expiry(now time.Time) time.Time {
+	if o.ExpiresAt != nil {
+		return o.ExpiresAt.UTC()
+	}
+	if o.TTL > 0 {
+		return now.Add(o.TTL).UTC()
+	}
+	return time.Time{}
+}
+
+// MergeWriteOptions fusionne les options recues, les dernieres etant prioritaires
+func MergeWriteOptions(opts []WriteOptions) WriteOptions {
+	merged := WriteOptions{}
+	for _, opt := range opts {
+		if opt.Encryption != nil {
+			merged.Encryption = opt.Encryption
+		}
+		if opt.ExpiresAt != nil {
+			merged.ExpiresAt = opt.ExpiresAt
+		}
+		if opt.TTL != 0 {
+			merged.TTL = opt.TTL
+		}
+		for key, value := range opt.Metadata {
+			if merged.Metadata == nil {
+				merged.Metadata = make(map[string]string)
+			}
+			merged.Metadata[strings.ToLower(key)] = value
+		}
+	}
+
+	return merged
+}
+
+// ReadOptions permet de ne lire qu'une partie d'un fichier
+type ReadOptions struct {
+	// Position du premier octet a lire
+	Offset int64
+	// Nombre d'octets a lire, 0 pour lire jusqu'a la fin du fichier
+	Length int64
+}
+
+// MergeReadOptions fusionne les options recues, les dernieres etant prioritaires
+func MergeReadOptions(opts []ReadOptions) ReadOptions {
+	merged := ReadOptions{}
+	for _, opt := range opts {
+		merged = opt
+	}
+
+	return merged
+}
+
+// ErrNotExist est renvoyee par les backends lorsque le fichier demande n'existe pas.
+// Elle est compatible avec errors.Is(err, fs.ErrNotExist)
+var ErrNotExist error = notExistError{}
+
+type notExistError struct{}
+
+func (notExistError) Error() string {
+	return "filepath does not exists"
+}
+
+func (notExistError) Is(target error) bool {
+	return target == fs.ErrNotExist
+}
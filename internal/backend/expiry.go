@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"context"
+	"time"
+)
+
+// META_EXPIRES_AT est la metadonnee utilisee par les backends sans fichier annexe pour enregistrer l'expiration
+const META_EXPIRES_AT = "gofs-expires-at"
+
+// Expirer est implemente par les backends gerant l'expiration des fichiers
+type Expirer interface {
+	// ListExpired renvoie les fichiers expires a la date indiquee sous le chemin
+	ListExpired(ctx context.Context, path string, now time.Time) ([]string, error)
+}
+
+// IsExpired indique si une date d'expiration est depassee
+func IsExpired(expiresAt time.Time, now time.Time) bool {
+	return !expiresAt.IsZero() && !now.Before(expiresAt)
+}
+
+// ListExpired transmet l'appel aux backends decores, ErrNotSupported etant renvoyee s'ils ne gerent pas l'expiration
+func ListExpired(ctx context.Context, b Backend, path string, now time.Time) ([]string, error) {
+	expirer, ok := b.(Expirer)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	return expirer.ListExpired(ctx, path, now)
+}
@@ -0,0 +1,300 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SortOrder string
+
+const (
+	SORT_NAME  SortOrder = "name"
+	SORT_SIZE  SortOrder = "size"
+	SORT_MTIME SortOrder = "mtime"
+)
+
+// ListOptions filtre et trie un listing. Les filtres s'appliquent au chemin relatif au dossier liste
+type ListOptions struct {
+	Recursive bool
+	// Globs appliques au chemin relatif, ou au nom du fichier s'ils ne contiennent pas de "/".
+	// Si Include ou IncludeRegex sont renseignes, seuls les fichiers correspondant a l'un d'eux sont gardes
+	Include      []string
+	IncludeRegex []string
+	// Exclusions, prioritaires sur les inclusions
+	Exclude      []string
+	ExcludeRegex []string
+	// Taille minimum et maximum en octets, 0 pour ne pas limiter
+	MinSize int64
+	MaxSize int64
+	// Date de modification, zero pour ne pas limiter
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// Ignore les fichiers dont le nom, ou celui d'un dossier parent, commence par un "."
+	SkipHidden bool
+	// Ordre du listing, SORT_NAME par defaut
+	Sort    SortOrder
+	Reverse bool
+	// Nombre maximum de fichiers renvoyes, 0 pour ne pas limiter
+	MaxResults int
+}
+
+// ListEntry est un fichier liste, avec ses infos si le backend les fournit
+type ListEntry struct {
+	Path string
+	Info FileInfo
+}
+
+// FilteredLister est implemente par les backends pouvant appliquer eux memes les filtres
+type FilteredLister interface {
+	ListFiltered(ctx context.Context, path string, opts ListOptions) ([]string, error)
+}
+
+// ListFilter est la version compilee des options
+type ListFilter struct {
+	opts         ListOptions
+	includeRegex []*regexp.Regexp
+	excludeRegex []*regexp.Regexp
+}
+
+// NewListFilter verifie et compile les options
+func NewListFilter(opts ListOptions) (*ListFilter, error) {
+	// On applique les valeurs par defaut
+	if opts.Sort == "" {
+		opts.Sort = SORT_NAME
+	}
+
+	// On verifie les options
+	if opts.Sort != SORT_NAME && opts.Sort != SORT_SIZE && opts.Sort != SORT_MTIME {
+		return nil, errors.New("unknown sort order[" + string(opts.Sort) + "]")
+	}
+	if opts.MinSize < 0 || opts.MaxSize < 0 || (opts.MaxSize > 0 && opts.MinSize > opts.MaxSize) {
+		return nil, errors.New("invalid size range")
+	}
+	if opts.MaxResults < 0 {
+		return nil, errors.New("invalid max results")
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New("invalid glob[" + pattern + "] : " + err.Error())
+		}
+	}
+	filter := &ListFilter{opts: opts}
+	var err error
+	if filter.includeRegex, err = compileRegexps(opts.IncludeRegex); err != nil {
+		return nil, err
+	}
+	if filter.excludeRegex, err = compileRegexps(opts.ExcludeRegex); err != nil {
+		return nil, err
+	}
+
+	return filter, nil
+}
+
+func compileRegexps(patterns []string) ([]*regexp.Regexp, error) {
+	regexps := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, errors.New("invalid regex[" + pattern + "] : " + err.Error())
+		}
+		regexps = append(regexps, re)
+	}
+
+	return regexps, nil
+}
+
+// MatchGlob applique le glob au chemin, ou au nom du fichier si le glob ne contient pas de "/"
+func MatchGlob(pattern string, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		file = path.Base(file)
+	}
+	matched, _ := path.Match(pattern, file)
+
+	return matched
+}
+
+// NeedsInfo indique si les infos des fichiers sont necessaires pour filtrer ou trier
+func (f *ListFilter) NeedsInfo() bool {
+	o := f.opts
+	return o.MinSize > 0 || o.MaxSize > 0 || !o.ModifiedAfter.IsZero() || !o.ModifiedBefore.IsZero() || o.Sort != SORT_NAME
+}
+
+// LiteralPrefix renvoie le debut commun a tous les fichiers pouvant etre inclus, qui permet de restreindre le listing.
+// Ce n'est possible qu'en recursif, si tous les filtres d'inclusion sont des globs portant sur le chemin
+func (f *ListFilter) LiteralPrefix() string {
+	o := f.opts
+	if !o.Recursive || len(o.Include) == 0 || len(o.IncludeRegex) > 0 {
+		return ""
+	}
+	prefix := ""
+	for i, pattern := range o.Include {
+		if !strings.Contains(pattern, "/") {
+			return ""
+		}
+		literal := pattern
+		if index := strings.IndexAny(pattern, `*?[\`); index >= 0 {
+			literal = pattern[:index]
+		}
+		if i == 0 {
+			prefix = literal
+			continue
+		}
+		for !strings.HasPrefix(literal, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
+
+// MatchName indique si le chemin relatif passe les filtres portant sur le nom
+func (f *ListFilter) MatchName(file string) bool {
+	file = strings.TrimPrefix(file, "/")
+	o := f.opts
+
+	// On ignore les fichiers caches
+	if o.SkipHidden {
+		for _, part := range strings.Split(file, "/") {
+			if strings.HasPrefix(part, ".") {
+				return false
+			}
+		}
+	}
+
+	// Les exclusions sont prioritaires
+	for _, pattern := range o.Exclude {
+		if MatchGlob(pattern, file) {
+			return false
+		}
+	}
+	for _, re := range f.excludeRegex {
+		if re.MatchString(file) {
+			return false
+		}
+	}
+	if len(o.Include) == 0 && len(f.includeRegex) == 0 {
+		return true
+	}
+	for _, pattern := range o.Include {
+		if MatchGlob(pattern, file) {
+			return true
+		}
+	}
+	for _, re := range f.includeRegex {
+		if re.MatchString(file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchInfo indique si le fichier passe les filtres portant sur ses infos
+func (f *ListFilter) MatchInfo(fInfo FileInfo) bool {
+	o := f.opts
+	if fInfo.Size < o.MinSize || (o.MaxSize > 0 && fInfo.Size > o.MaxSize) {
+		return false
+	}
+	if !o.ModifiedAfter.IsZero() && !fInfo.LastModified.After(o.ModifiedAfter) {
+		return false
+	}
+	if !o.ModifiedBefore.IsZero() && !fInfo.LastModified.Before(o.ModifiedBefore) {
+		return false
+	}
+
+	return true
+}
+
+// Apply filtre, trie et limite les fichiers dont le nom a deja ete filtre
+func (f *ListFilter) Apply(entries []ListEntry) []string {
+	// On filtre sur les infos
+	kept := make([]ListEntry, 0, len(entries))
+	for _, entry := range entries {
+		if f.MatchInfo(entry.Info) {
+			kept = append(kept, entry)
+		}
+	}
+
+	// On trie, le nom departageant les egalites
+	less := func(i, j int) bool { return kept[i].Path < kept[j].Path }
+	switch f.opts.Sort {
+	case SORT_SIZE:
+		less = func(i, j int) bool {
+			if kept[i].Info.Size != kept[j].Info.Size {
+				return kept[i].Info.Size < kept[j].Info.Size
+			}
+			return kept[i].Path < kept[j].Path
+		}
+	case SORT_MTIME:
+		less = func(i, j int) bool {
+			if !kept[i].Info.LastModified.Equal(kept[j].Info.LastModified) {
+				return kept[i].Info.LastModified.Before(kept[j].Info.LastModified)
+			}
+			return kept[i].Path < kept[j].Path
+		}
+	}
+	if f.opts.Reverse {
+		sort.Slice(kept, func(i, j int) bool { return less(j, i) })
+	} else {
+		sort.Slice(kept, less)
+	}
+
+	// On limite le nombre de fichiers
+	if f.opts.MaxResults > 0 && len(kept) > f.opts.MaxResults {
+		kept = kept[:f.opts.MaxResults]
+	}
+	files := make([]string, 0, len(kept))
+	for _, entry := range kept {
+		files = append(files, entry.Path)
+	}
+
+	return files
+}
+
+// ListWithOptions liste avec le backend puis applique les filtres, en recuperant les infos des fichiers si necessaire.
+// Le listing est restreint au dossier du prefixe commun des globs
+func ListWithOptions(ctx context.Context, b Backend, dirPath string, opts ListOptions) ([]string, error) {
+	// On compile les options
+	filter, err := NewListFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// On restreint le listing au dossier commun, si le chemin liste est un dossier
+	subDir := ""
+	if dirPath == "" || strings.HasSuffix(dirPath, "/") {
+		if prefix := filter.LiteralPrefix(); strings.Contains(prefix, "/") {
+			subDir = prefix[:strings.LastIndex(prefix, "/")+1]
+		}
+	}
+	files, err := b.List(ctx, dirPath+subDir, opts.Recursive)
+	if err != nil {
+		return nil, err
+	}
+
+	// On filtre sur le nom, puis on recupere les infos des fichiers restants
+	entries := make([]ListEntry, 0, len(files))
+	for _, file := range files {
+		file = subDir + file
+		if !filter.MatchName(file) {
+			continue
+		}
+		entry := ListEntry{Path: file}
+		if filter.NeedsInfo() {
+			entry.Info, err = b.Stat(ctx, dirPath+file)
+			if errors.Is(err, ErrNotExist) {
+				continue
+			} else if err != nil {
+				return nil, errors.New("unable to stat file[" + dirPath + file + "] : " + err.Error())
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	return filter.Apply(entries), nil
+}
@@ -0,0 +1,159 @@
+package backend_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+func TestLiteralPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		opts backend.ListOptions
+		want string
+	}{
+		{"not recursive", backend.ListOptions{Include: []string{"docs/*.md"}}, ""},
+		{"no include", backend.ListOptions{Recursive: true}, ""},
+		{"include regex", backend.ListOptions{Recursive: true, Include: []string{"docs/*.md"}, IncludeRegex: []string{"^docs/"}}, ""},
+		{"name glob", backend.ListOptions{Recursive: true, Include: []string{"docs/*.md", "*.txt"}}, ""},
+		{"path glob", backend.ListOptions{Recursive: true, Include: []string{"docs/*.md"}}, "docs/"},
+		{"literal path", backend.ListOptions{Recursive: true, Include: []string{"logs/2024/app.log"}}, "logs/2024/app.log"},
+		{"escaped character", backend.ListOptions{Recursive: true, Include: []string{`docs/\*.md`}}, "docs/"},
+		{"common folder", backend.ListOptions{Recursive: true, Include: []string{"docs/a/*.md", "docs/b/?.md"}}, "docs/"},
+		{"common name start", backend.ListOptions{Recursive: true, Include: []string{"docs/*.md", "dir/[ab].txt"}}, "d"},
+		{"nothing in common", backend.ListOptions{Recursive: true, Include: []string{"docs/*.md", "logs/*.log"}}, ""},
+		{"exclusions ignored", backend.ListOptions{Recursive: true, Include: []string{"docs/*.md"}, Exclude: []string{"other/*"}}, "docs/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := backend.NewListFilter(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.LiteralPrefix(); got != tt.want {
+				t.Errorf("prefix = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// listRecorder garde les dossiers listes par le backend
+type listRecorder struct {
+	backend.Backend
+	listed []string
+}
+
+func (b *listRecorder) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	b.listed = append(b.listed, path)
+	return b.Backend.List(ctx, path, recursive)
+}
+
+// newTestBackend cree un backend local contenant des fichiers de tailles et de dates differentes
+func newTestBackend(t *testing.T) (*listRecorder, time.Time) {
+	t.Helper()
+	basePath := t.TempDir()
+	local, err := gofsbcklocal.New(gofsbcklocal.LocalConfig{BasePath: basePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Le fichier le plus gros est le plus ancien
+	now := time.Now().Truncate(time.Second)
+	files := map[string]int{
+		"a.txt":           1,
+		"b.log":           2,
+		"docs/guide.md":   3,
+		"docs/api/ref.md": 4,
+		"docs/notes.txt":  5,
+		".hidden/c.txt":   6,
+		"docs/.draft.md":  7,
+		"logs/app.log":    8,
+	}
+	for filePath, size := range files {
+		if err := local.WriteString(context.Background(), filePath, strings.Repeat("x", size)); err != nil {
+			t.Fatal(err)
+		}
+		modTime := now.Add(-time.Duration(size) * time.Hour)
+		if err := os.Chtimes(filepath.Join(basePath, filePath), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &listRecorder{Backend: local}, now
+}
+
+func TestListWithOptions(t *testing.T) {
+	_, now := newTestBackend(t)
+
+	tests := []struct {
+		name       string
+		dirPath    string
+		opts       backend.ListOptions
+		want       []string
+		wantListed string
+	}{
+		{"root folder", "", backend.ListOptions{}, []string{"a.txt", "b.log"}, ""},
+		{"recursive", "", backend.ListOptions{Recursive: true}, []string{".hidden/c.txt", "a.txt", "b.log", "docs/.draft.md", "docs/api/ref.md", "docs/guide.md", "docs/notes.txt", "logs/app.log"}, ""},
+		{"skip hidden", "", backend.ListOptions{Recursive: true, SkipHidden: true}, []string{"a.txt", "b.log", "docs/api/ref.md", "docs/guide.md", "docs/notes.txt", "logs/app.log"}, ""},
+		{"name glob", "", backend.ListOptions{Recursive: true, Include: []string{"*.log"}}, []string{"b.log", "logs/app.log"}, ""},
+		{"path glob restricts the listing", "", backend.ListOptions{Recursive: true, Include: []string{"docs/*.md"}}, []string{"docs/.draft.md", "docs/guide.md"}, "docs/"},
+		{"include regex", "", backend.ListOptions{Recursive: true, IncludeRegex: []string{`^docs/.*\.md$`}}, []string{"docs/.draft.md", "docs/api/ref.md", "docs/guide.md"}, ""},
+		{"exclude wins over include", "", backend.ListOptions{Recursive: true, Include: []string{"*.md"}, Exclude: []string{"docs/api/*"}}, []string{"docs/.draft.md", "docs/guide.md"}, ""},
+		{"exclude regex", "", backend.ListOptions{Recursive: true, ExcludeRegex: []string{`\.(md|txt)$`}}, []string{"b.log", "logs/app.log"}, ""},
+		{"sub folder", "docs/", backend.ListOptions{Recursive: true, Include: []string{"api/*"}}, []string{"api/ref.md"}, "api/"},
+		{"size range", "", backend.ListOptions{Recursive: true, MinSize: 3, MaxSize: 5}, []string{"docs/api/ref.md", "docs/guide.md", "docs/notes.txt"}, ""},
+		{"modified range", "", backend.ListOptions{Recursive: true, ModifiedAfter: now.Add(-4*time.Hour - time.Minute), ModifiedBefore: now.Add(-2 * time.Hour)}, []string{"docs/api/ref.md", "docs/guide.md"}, ""},
+		{"sort by size", "", backend.ListOptions{Recursive: true, SkipHidden: true, Sort: backend.SORT_SIZE}, []string{"a.txt", "b.log", "docs/guide.md", "docs/api/ref.md", "docs/notes.txt", "logs/app.log"}, ""},
+		{"sort by mtime", "", backend.ListOptions{Recursive: true, SkipHidden: true, Sort: backend.SORT_MTIME}, []string{"logs/app.log", "docs/notes.txt", "docs/api/ref.md", "docs/guide.md", "b.log", "a.txt"}, ""},
+		{"reverse sort", "", backend.ListOptions{Recursive: true, SkipHidden: true, Sort: backend.SORT_SIZE, Reverse: true}, []string{"logs/app.log", "docs/notes.txt", "docs/api/ref.md", "docs/guide.md", "b.log", "a.txt"}, ""},
+		{"reverse name sort with limit", "", backend.ListOptions{Recursive: true, Reverse: true, MaxResults: 2}, []string{"logs/app.log", "docs/notes.txt"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newTestBackend(t)
+			files, err := backend.ListWithOptions(context.Background(), b, tt.dirPath, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(files, tt.want) {
+				t.Errorf("files = %v, want %v", files, tt.want)
+			}
+			if want := []string{tt.dirPath + tt.wantListed}; !reflect.DeepEqual(b.listed, want) {
+				t.Errorf("listed = %v, want %v", b.listed, want)
+			}
+		})
+	}
+}
+
+func TestListWithOptionsInvalid(t *testing.T) {
+	b, _ := newTestBackend(t)
+
+	tests := []struct {
+		name string
+		opts backend.ListOptions
+	}{
+		{"unknown sort", backend.ListOptions{Sort: "owner"}},
+		{"negative size", backend.ListOptions{MinSize: -1}},
+		{"inverted size range", backend.ListOptions{MinSize: 10, MaxSize: 5}},
+		{"negative max results", backend.ListOptions{MaxResults: -1}},
+		{"invalid glob", backend.ListOptions{Include: []string{"[a"}}},
+		{"invalid regex", backend.ListOptions{ExcludeRegex: []string{"("}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := backend.ListWithOptions(context.Background(), b, "", tt.opts); err == nil {
+				t.Error("invalid options accepted")
+			}
+		})
+	}
+	if len(b.listed) > 0 {
+		t.Errorf("listed = %v, want no listing", b.listed)
+	}
+}
@@ -0,0 +1,78 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"time"
+)
+
+type RetentionMode string
+
+const (
+	RETENTION_NONE RetentionMode = ""
+	// La retention peut etre reduite ou retiree par un nouvel appel a SetRetention
+	RETENTION_GOVERNANCE RetentionMode = "GOVERNANCE"
+	// La retention ne peut qu'etre prolongee
+	RETENTION_COMPLIANCE RetentionMode = "COMPLIANCE"
+)
+
+// Lock decrit la protection d'un fichier contre la modification et la suppression
+type Lock struct {
+	Mode        RetentionMode
+	RetainUntil time.Time
+	LegalHold   bool
+}
+
+// IsLocked indique si le fichier est protege a la date indiquee
+func (l Lock) IsLocked(now time.Time) bool {
+	return l.LegalHold || (l.Mode != RETENTION_NONE && now.Before(l.RetainUntil))
+}
+
+// Locker est implemente par les backends pouvant proteger des fichiers (WORM)
+type Locker interface {
+	// SetRetention protege le fichier jusqu'a la date indiquee, RETENTION_NONE retire une retention GOVERNANCE
+	SetRetention(ctx context.Context, filepath string, mode RetentionMode, until time.Time) error
+	SetLegalHold(ctx context.Context, filepath string, on bool) error
+	GetLock(ctx context.Context, filepath string) (Lock, error)
+}
+
+// ErrLocked est renvoyee, via LockedError, lorsqu'un fichier protege devait etre modifie ou supprime
+var ErrLocked = errors.New("file is locked")
+
+// LockedError est compatible avec errors.Is(err, ErrLocked) et errors.Is(err, fs.ErrPermission)
+type LockedError struct {
+	Path string
+	Lock Lock
+}
+
+func (e *LockedError) Error() string {
+	if e.Lock.LegalHold {
+		return "file[" + e.Path + "] is under legal hold"
+	}
+	return "file[" + e.Path + "] is locked in " + string(e.Lock.Mode) + " mode until " + e.Lock.RetainUntil.Format(time.RFC3339)
+}
+
+func (e *LockedError) Is(target error) bool {
+	return target == ErrLocked || target == fs.ErrPermission
+}
+
+// ValidateRetention verifie qu'une nouvelle retention peut remplacer l'actuelle
+func ValidateRetention(filepath string, current Lock, mode RetentionMode, until time.Time, now time.Time) error {
+	// On verifie le mode
+	if mode != RETENTION_NONE && mode != RETENTION_GOVERNANCE && mode != RETENTION_COMPLIANCE {
+		return errors.New("invalid retention mode[" + string(mode) + "]")
+	}
+	if mode != RETENTION_NONE && !until.After(now) {
+		return errors.New("retention date must be in the future")
+	}
+
+	// Une retention COMPLIANCE en cours ne peut ni etre reduite ni changer de mode
+	if current.Mode == RETENTION_COMPLIANCE && now.Before(current.RetainUntil) {
+		if mode != RETENTION_COMPLIANCE || until.Before(current.RetainUntil) {
+			return &LockedError{Path: filepath, Lock: Lock{Mode: current.Mode, RetainUntil: current.RetainUntil}}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package backend
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// NewLogger renvoie le logger d'un backend, base sur celui fourni ou a defaut sur le logger global.
+// Sans debug, les messages de debug sont ignores pour cette instance uniquement
+func NewLogger(logger *zerolog.Logger, backendName string, debug bool) zerolog.Logger {
+	// On initialise
+	l := log.Logger
+	if logger != nil {
+		l = *logger
+	}
+
+	// On applique le niveau de l'instance
+	if !debug && l.GetLevel() < zerolog.InfoLevel {
+		l = l.Level(zerolog.InfoLevel)
+	}
+
+	return l.With().Str("backend", backendName).Logger()
+}
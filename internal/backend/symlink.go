@@ -0,0 +1,11 @@
+package backend
+
+import "context"
+
+// Symlinker est implemente par les backends gerant les liens symboliques
+type Symlinker interface {
+	// Symlink cree linkPath, un lien vers le fichier target du backend
+	Symlink(ctx context.Context, target string, linkPath string) error
+	// Readlink renvoie la cible du lien
+	Readlink(ctx context.Context, linkPath string) (string, error)
+}
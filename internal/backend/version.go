@@ -0,0 +1,30 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNotSupported est renvoyee lorsqu'une fonctionnalite optionnelle n'est pas disponible sur le backend
+var ErrNotSupported = errors.New("operation not supported by the backend")
+
+// Version decrit une version d'un fichier
+type Version struct {
+	VersionID    string
+	Size         int64
+	ETag         string
+	LastModified time.Time
+	// Indique la version courante du fichier
+	IsLatest bool
+	// Indique une suppression, le fichier n'existait plus a partir de cette version
+	DeleteMarker bool
+}
+
+// Versioner est implemente par les backends conservant les versions precedentes des fichiers
+type Versioner interface {
+	// ListVersions renvoie les versions du fichier, de la plus recente a la plus ancienne
+	ListVersions(ctx context.Context, filepath string) ([]Version, error)
+	ReadVersion(ctx context.Context, filepath string, versionID string, opts ...ReadOptions) (FileStream, error)
+	DeleteVersion(ctx context.Context, filepath string, versionID string) error
+}
@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// DirReader est implemente par les backends pouvant lister un seul niveau de dossier,
+// les sous dossiers etant renvoyes comme des entrees. Le dossier racine est "."
+type DirReader interface {
+	ReadDir(ctx context.Context, dir string) ([]fs.DirEntry, error)
+}
+
+// NewDirEntry cree une entree de dossier a partir des infos d'un fichier, ou d'un dossier si isDir
+func NewDirEntry(name string, isDir bool, fInfo FileInfo) fs.DirEntry {
+	return dirEntry{info: fileInfo{name: name, isDir: isDir, info: fInfo}}
+}
+
+type dirEntry struct {
+	info fileInfo
+}
+
+func (e dirEntry) Name() string               { return e.info.name }
+func (e dirEntry) IsDir() bool                { return e.info.isDir }
+func (e dirEntry) Type() fs.FileMode          { return e.info.Mode().Type() }
+func (e dirEntry) Info() (fs.FileInfo, error) { return e.info, nil }
+func (e dirEntry) String() string             { return fs.FormatDirEntry(e) }
+
+// fileInfo presente les infos d'un fichier comme un fs.FileInfo, Sys renvoie le FileInfo du backend
+type fileInfo struct {
+	name  string
+	isDir bool
+	info  FileInfo
+}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.info.Size }
+func (i fileInfo) ModTime() time.Time { return i.info.LastModified }
+func (i fileInfo) IsDir() bool        { return i.isDir }
+func (i fileInfo) Sys() interface{}   { return i.info }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.isDir {
+		return fs.ModeDir | 0755
+	}
+	return 0644
+}
+
+// CleanDir normalise un chemin de dossier, la racine etant "."
+func CleanDir(dir string) string {
+	dir = path.Clean("/" + dir)
+	if dir == "/" {
+		return "."
+	}
+	return dir[1:]
+}
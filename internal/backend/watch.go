@@ -0,0 +1,269 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+)
+
+type EventType string
+
+const (
+	EVENT_CREATE EventType = "create"
+	EVENT_MODIFY EventType = "modify"
+	EVENT_DELETE EventType = "delete"
+
+	DEFAULT_WATCH_POLL_INTERVAL = 5 * time.Second
+	DEFAULT_WATCH_DEBOUNCE      = 100 * time.Millisecond
+
+	// Taille du tampon des canaux d'evenements
+	WATCH_BUFFER_SIZE = 64
+)
+
+// Event decrit un changement sur un fichier, Info est vide pour une suppression
+type Event struct {
+	Type EventType
+	Path string
+	Info FileInfo
+	Time time.Time
+}
+
+type WatchOptions struct {
+	// Intervalle entre deux listings, pour les backends sans notification. DEFAULT_WATCH_POLL_INTERVAL par defaut
+	PollInterval time.Duration
+	// Delai regroupant les evenements successifs d'un fichier, DEFAULT_WATCH_DEBOUNCE par defaut, negatif pour ne pas regrouper
+	Debounce time.Duration
+}
+
+// MergeWatchOptions fusionne les options et applique les valeurs par defaut
+func MergeWatchOptions(opts []WatchOptions) WatchOptions {
+	merged := WatchOptions{}
+	for _, opt := range opts {
+		if opt.PollInterval != 0 {
+			merged.PollInterval = opt.PollInterval
+		}
+		if opt.Debounce != 0 {
+			merged.Debounce = opt.Debounce
+		}
+	}
+	if merged.PollInterval <= 0 {
+		merged.PollInterval = DEFAULT_WATCH_POLL_INTERVAL
+	}
+	if merged.Debounce == 0 {
+		merged.Debounce = DEFAULT_WATCH_DEBOUNCE
+	}
+
+	return merged
+}
+
+// Watcher est implemente par les backends pouvant notifier les changements.
+// Le canal est ferme a l'annulation du contexte
+type Watcher interface {
+	Watch(ctx context.Context, prefix string, opts WatchOptions) (<-chan Event, error)
+}
+
+// Snapshot associe le chemin complet de chaque fichier a ses infos
+type Snapshot map[string]FileInfo
+
+// ListSnapshot liste les fichiers sous le prefixe et recupere leurs infos
+func ListSnapshot(ctx context.Context, b Backend, prefix string) (Snapshot, error) {
+	files, err := b.List(ctx, prefix, true)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := make(Snapshot, len(files))
+	for _, file := range files {
+		filePath := prefix + file
+		fInfo, err := b.Stat(ctx, filePath)
+		if errors.Is(err, ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, errors.New("unable to stat file[" + filePath + "] : " + err.Error())
+		}
+		snapshot[filePath] = fInfo
+	}
+
+	return snapshot, nil
+}
+
+// PollBackend compare periodiquement les listings du backend
+func PollBackend(ctx context.Context, b Backend, prefix string, interval time.Duration) (<-chan Event, error) {
+	snapshot := func(ctx context.Context) (Snapshot, error) {
+		return ListSnapshot(ctx, b, prefix)
+	}
+	initial, err := snapshot(ctx)
+	if err != nil {
+		return nil, errors.New("unable to list files : " + err.Error())
+	}
+
+	return PollWatch(ctx, interval, initial, snapshot), nil
+}
+
+// PollWatch compare a chaque intervalle un nouveau listing au precedent.
+// Un listing en erreur est ignore, le suivant est compare au dernier listing reussi
+func PollWatch(ctx context.Context, interval time.Duration, initial Snapshot, snapshot func(ctx context.Context) (Snapshot, error)) <-chan Event {
+	if interval <= 0 {
+		interval = DEFAULT_WATCH_POLL_INTERVAL
+	}
+	events := make(chan Event, WATCH_BUFFER_SIZE)
+
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		previous := initial
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, err := snapshot(ctx)
+			if err != nil {
+				continue
+			}
+			for _, event := range DiffSnapshots(previous, current, time.Now()) {
+				if !SendEvent(ctx, events, event) {
+					return
+				}
+			}
+			previous = current
+		}
+	}()
+
+	return events
+}
+
+// DiffSnapshots renvoie les evenements permettant de passer d'un listing a l'autre, tries par chemin
+func DiffSnapshots(previous Snapshot, current Snapshot, now time.Time) []Event {
+	events := make([]Event, 0)
+	for filePath, fInfo := range current {
+		previousInfo, exists := previous[filePath]
+		if !exists {
+			events = append(events, Event{Type: EVENT_CREATE, Path: filePath, Info: fInfo, Time: now})
+		} else if fileChanged(previousInfo, fInfo) {
+			events = append(events, Event{Type: EVENT_MODIFY, Path: filePath, Info: fInfo, Time: now})
+		}
+	}
+	for filePath := range previous {
+		if _, exists := current[filePath]; !exists {
+			events = append(events, Event{Type: EVENT_DELETE, Path: filePath, Time: now})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Path < events[j].Path })
+
+	return events
+}
+
+func fileChanged(previous FileInfo, current FileInfo) bool {
+	if previous.Size != current.Size || !previous.LastModified.Equal(current.LastModified) {
+		return true
+	}
+
+	// L'ETag n'est pas fourni par tous les backends
+	return previous.ETag != "" && current.ETag != "" && previous.ETag != current.ETag
+}
+
+// SendEvent envoie l'evenement, sauf si le contexte est annule
+func SendEvent(ctx context.Context, events chan<- Event, event Event) bool {
+	select {
+	case events <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// pendingEvent est un evenement en attente de la fin du delai de regroupement
+type pendingEvent struct {
+	event    Event
+	deadline time.Time
+}
+
+// Debounce regroupe les evenements successifs d'un fichier, qui est emis une fois le delai ecoule sans nouveau changement.
+// Une creation suivie d'une suppression n'est pas emise, une suppression suivie d'une creation devient une modification
+func Debounce(ctx context.Context, in <-chan Event, delay time.Duration) <-chan Event {
+	out := make(chan Event, WATCH_BUFFER_SIZE)
+
+	go func() {
+		defer close(out)
+		pending := make(map[string]*pendingEvent)
+
+		// flush envoie les evenements dont le delai est ecoule, ou tous
+		flush := func(all bool) bool {
+			now := time.Now()
+			ready := make([]*pendingEvent, 0)
+			for filePath, p := range pending {
+				if all || !now.Before(p.deadline) {
+					ready = append(ready, p)
+					delete(pending, filePath)
+				}
+			}
+			sort.Slice(ready, func(i, j int) bool { return ready[i].deadline.Before(ready[j].deadline) })
+			for _, p := range ready {
+				if !SendEvent(ctx, out, p.event) {
+					return false
+				}
+			}
+			return true
+		}
+
+		for {
+			// On attend le prochain evenement ou la fin du premier delai
+			var wait <-chan time.Time
+			if len(pending) > 0 {
+				first := time.Time{}
+				for _, p := range pending {
+					if first.IsZero() || p.deadline.Before(first) {
+						first = p.deadline
+					}
+				}
+				wait = time.After(time.Until(first))
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-wait:
+				if !flush(false) {
+					return
+				}
+			case event, ok := <-in:
+				if !ok {
+					flush(true)
+					return
+				}
+				p, exists := pending[event.Path]
+				if !exists {
+					pending[event.Path] = &pendingEvent{event: event, deadline: time.Now().Add(delay)}
+					continue
+				}
+				merged, keep := mergeEvents(p.event, event)
+				if !keep {
+					delete(pending, event.Path)
+					continue
+				}
+				p.event = merged
+				p.deadline = time.Now().Add(delay)
+			}
+		}
+	}()
+
+	return out
+}
+
+// mergeEvents combine deux evenements successifs d'un fichier, false si le fichier est revenu a son etat initial
+func mergeEvents(previous Event, next Event) (Event, bool) {
+	switch {
+	case previous.Type == EVENT_CREATE && next.Type == EVENT_DELETE:
+		return next, false
+	case previous.Type == EVENT_CREATE:
+		next.Type = EVENT_CREATE
+	case previous.Type == EVENT_DELETE && next.Type != EVENT_DELETE:
+		next.Type = EVENT_MODIFY
+	}
+
+	return next, true
+}
@@ -0,0 +1,184 @@
+package backend
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	now := time.Now()
+	before := now.Add(-time.Hour)
+	previous := Snapshot{
+		"same":       {Size: 1, LastModified: before, ETag: "a"},
+		"resized":    {Size: 1, LastModified: before},
+		"touched":    {Size: 1, LastModified: before},
+		"retagged":   {Size: 1, LastModified: before, ETag: "a"},
+		"tag_lost":   {Size: 1, LastModified: before, ETag: "a"},
+		"dir/delete": {Size: 1, LastModified: before},
+	}
+	current := Snapshot{
+		"same":       {Size: 1, LastModified: before, ETag: "a"},
+		"resized":    {Size: 2, LastModified: before},
+		"touched":    {Size: 1, LastModified: now},
+		"retagged":   {Size: 1, LastModified: before, ETag: "b"},
+		"tag_lost":   {Size: 1, LastModified: before},
+		"dir/create": {Size: 3, LastModified: now},
+	}
+
+	tests := []struct {
+		name     string
+		previous Snapshot
+		current  Snapshot
+		want     []Event
+	}{
+		{"no change", previous, previous, []Event{}},
+		{"empty listings", Snapshot{}, nil, []Event{}},
+		{"changes", previous, current, []Event{
+			{Type: EVENT_CREATE, Path: "dir/create", Info: current["dir/create"], Time: now},
+			{Type: EVENT_DELETE, Path: "dir/delete", Time: now},
+			{Type: EVENT_MODIFY, Path: "resized", Info: current["resized"], Time: now},
+			{Type: EVENT_MODIFY, Path: "retagged", Info: current["retagged"], Time: now},
+			{Type: EVENT_MODIFY, Path: "touched", Info: current["touched"], Time: now},
+		}},
+		{"everything created", nil, Snapshot{"b": {Size: 1}, "a": {Size: 1}}, []Event{
+			{Type: EVENT_CREATE, Path: "a", Info: FileInfo{Size: 1}, Time: now},
+			{Type: EVENT_CREATE, Path: "b", Info: FileInfo{Size: 1}, Time: now},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffSnapshots(tt.previous, tt.current, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeEvents(t *testing.T) {
+	tests := []struct {
+		previous EventType
+		next     EventType
+		want     EventType
+		wantKeep bool
+	}{
+		{EVENT_CREATE, EVENT_MODIFY, EVENT_CREATE, true},
+		{EVENT_CREATE, EVENT_DELETE, EVENT_DELETE, false},
+		{EVENT_MODIFY, EVENT_MODIFY, EVENT_MODIFY, true},
+		{EVENT_MODIFY, EVENT_DELETE, EVENT_DELETE, true},
+		{EVENT_DELETE, EVENT_CREATE, EVENT_MODIFY, true},
+		{EVENT_DELETE, EVENT_DELETE, EVENT_DELETE, true},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.previous)+"+"+string(tt.next), func(t *testing.T) {
+			next := Event{Type: tt.next, Path: "file", Info: FileInfo{Size: 2}}
+			merged, keep := mergeEvents(Event{Type: tt.previous, Path: "file", Info: FileInfo{Size: 1}}, next)
+			if keep != tt.wantKeep {
+				t.Fatalf("keep = %v, want %v", keep, tt.wantKeep)
+			}
+			if keep && (merged.Type != tt.want || merged.Info.Size != 2) {
+				t.Errorf("merged = %+v, want type %s with the latest infos", merged, tt.want)
+			}
+		})
+	}
+}
+
+// collect lit les evenements jusqu'a la fermeture du canal
+func collect(t *testing.T, events <-chan Event) []Event {
+	t.Helper()
+	collected := make([]Event, 0)
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return collected
+			}
+			collected = append(collected, event)
+		case <-timeout:
+			t.Fatal("events channel not closed")
+		}
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	tests := []struct {
+		name string
+		in   []Event
+		want []Event
+	}{
+		{"single event", []Event{
+			{Type: EVENT_MODIFY, Path: "a"},
+		}, []Event{
+			{Type: EVENT_MODIFY, Path: "a"},
+		}},
+		{"successive writes", []Event{
+			{Type: EVENT_CREATE, Path: "a", Info: FileInfo{Size: 1}},
+			{Type: EVENT_MODIFY, Path: "a", Info: FileInfo{Size: 2}},
+			{Type: EVENT_MODIFY, Path: "a", Info: FileInfo{Size: 3}},
+		}, []Event{
+			{Type: EVENT_CREATE, Path: "a", Info: FileInfo{Size: 3}},
+		}},
+		{"temporary file", []Event{
+			{Type: EVENT_CREATE, Path: "tmp"},
+			{Type: EVENT_MODIFY, Path: "tmp"},
+			{Type: EVENT_DELETE, Path: "tmp"},
+		}, []Event{}},
+		{"replaced file", []Event{
+			{Type: EVENT_DELETE, Path: "a"},
+			{Type: EVENT_CREATE, Path: "a", Info: FileInfo{Size: 1}},
+		}, []Event{
+			{Type: EVENT_MODIFY, Path: "a", Info: FileInfo{Size: 1}},
+		}},
+		{"files kept apart", []Event{
+			{Type: EVENT_CREATE, Path: "a"},
+			{Type: EVENT_CREATE, Path: "b"},
+			{Type: EVENT_DELETE, Path: "a"},
+			{Type: EVENT_DELETE, Path: "c"},
+		}, []Event{
+			{Type: EVENT_CREATE, Path: "b"},
+			{Type: EVENT_DELETE, Path: "c"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Le delai est assez long pour que tous les evenements soient regroupes
+			in := make(chan Event, len(tt.in))
+			for _, event := range tt.in {
+				in <- event
+			}
+			close(in)
+
+			if got := collect(t, Debounce(context.Background(), in, time.Hour)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDebounceDelay(t *testing.T) {
+	in := make(chan Event)
+	out := Debounce(context.Background(), in, 20*time.Millisecond)
+
+	// L'evenement est emis une fois le delai ecoule, sans attendre la fermeture
+	start := time.Now()
+	in <- Event{Type: EVENT_CREATE, Path: "a"}
+	select {
+	case event := <-out:
+		if event.Path != "a" || time.Since(start) < 20*time.Millisecond {
+			t.Errorf("event = %+v after %s, want a after the delay", event, time.Since(start))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("event not emitted after the delay")
+	}
+
+	// L'annulation du contexte ferme le canal
+	ctx, cancel := context.WithCancel(context.Background())
+	out = Debounce(ctx, in, time.Hour)
+	in <- Event{Type: EVENT_CREATE, Path: "b"}
+	cancel()
+	if got := collect(t, out); len(got) != 0 {
+		t.Errorf("events = %+v, want none after cancellation", got)
+	}
+}
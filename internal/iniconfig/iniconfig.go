@@ -0,0 +1,57 @@
+package iniconfig
+
+import (
+	"errors"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// RequiredString renvoie la valeur de la cle, ou une erreur si elle est absente ou vide
+func RequiredString(section *ini.Section, key string) (string, error) {
+	value := strings.TrimSpace(section.Key(key).String())
+	if !section.HasKey(key) || value == "" {
+		return "", errors.New("missing required key[" + key + "] in section[" + section.Name() + "]")
+	}
+
+	return value, nil
+}
+
+// String renvoie la valeur de la cle, ou la valeur par defaut si elle est absente
+func String(section *ini.Section, key string, defaultValue string) string {
+	if !section.HasKey(key) {
+		return defaultValue
+	}
+
+	return strings.TrimSpace(section.Key(key).String())
+}
+
+// Bool renvoie la valeur booleenne de la cle, ou la valeur par defaut si elle est absente.
+// Une valeur qui n'est pas un booleen renvoie une erreur
+func Bool(section *ini.Section, key string, defaultValue bool) (bool, error) {
+	if !section.HasKey(key) {
+		return defaultValue, nil
+	}
+
+	value, err := section.Key(key).Bool()
+	if err != nil {
+		return defaultValue, errors.New("invalid boolean value for key[" + key + "] in section[" + section.Name() + "]")
+	}
+
+	return value, nil
+}
+
+// Int renvoie la valeur entiere de la cle, ou la valeur par defaut si elle est absente.
+// Une valeur qui n'est pas un entier renvoie une erreur
+func Int(section *ini.Section, key string, defaultValue int) (int, error) {
+	if !section.HasKey(key) {
+		return defaultValue, nil
+	}
+
+	value, err := section.Key(key).Int()
+	if err != nil {
+		return defaultValue, errors.New("invalid integer value for key[" + key + "] in section[" + section.Name() + "]")
+	}
+
+	return value, nil
+}
@@ -0,0 +1,64 @@
+package urlconfig
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+// CheckParams verifie que la requete ne contient que des parametres connus
+func CheckParams(query url.Values, allowed ...string) error {
+	for param := range query {
+		known := false
+		for _, allowedParam := range allowed {
+			if param == allowedParam {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return errors.New("unknown url parameter[" + param + "]")
+		}
+	}
+
+	return nil
+}
+
+// String renvoie la valeur du parametre, ou la valeur par defaut s'il est absent
+func String(query url.Values, param string, defaultValue string) string {
+	if !query.Has(param) {
+		return defaultValue
+	}
+
+	return query.Get(param)
+}
+
+// Bool renvoie la valeur booleenne du parametre, ou la valeur par defaut s'il est absent.
+// Une valeur qui n'est pas un booleen renvoie une erreur
+func Bool(query url.Values, param string, defaultValue bool) (bool, error) {
+	if !query.Has(param) {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.ParseBool(query.Get(param))
+	if err != nil {
+		return defaultValue, errors.New("invalid boolean value for url parameter[" + param + "]")
+	}
+
+	return value, nil
+}
+
+// Int renvoie la valeur entiere du parametre, ou la valeur par defaut s'il est absent.
+// Une valeur qui n'est pas un entier renvoie une erreur
+func Int(query url.Values, param string, defaultValue int) (int, error) {
+	if !query.Has(param) {
+		return defaultValue, nil
+	}
+
+	value, err := strconv.Atoi(query.Get(param))
+	if err != nil {
+		return defaultValue, errors.New("invalid integer value for url parameter[" + param + "]")
+	}
+
+	return value, nil
+}
@@ -0,0 +1,233 @@
+package gofs
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+const DEFAULT_JANITOR_BATCH_SIZE = 100
+
+type JanitorOptions struct {
+	// Dossier a nettoyer, tout le backend par defaut
+	Path string
+	// Nombre de fichiers supprimes en parallele, DEFAULT_JANITOR_BATCH_SIZE par defaut
+	BatchSize int
+	// N'effectue aucune suppression, le rapport indique ce qui serait supprime
+	DryRun bool
+}
+
+type JanitorError struct {
+	Path string
+	Err  error
+}
+
+func (e JanitorError) Error() string {
+	return e.Path + " : " + e.Err.Error()
+}
+
+// JanitorReport liste les fichiers expires trouves lors d'un passage
+type JanitorReport struct {
+	Expired []string
+	Deleted []string
+	Failed  []JanitorError
+}
+
+// JanitorStats cumule les passages d'un janitor
+type JanitorStats struct {
+	Runs      int64
+	Expired   int64
+	Deleted   int64
+	Failed    int64
+	LastRun   time.Time
+	LastError error
+}
+
+// Janitor supprime periodiquement les fichiers expires
+type Janitor struct {
+	gfs      GoFS
+	interval time.Duration
+	opts     JanitorOptions
+	mu       sync.Mutex
+	stats    JanitorStats
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// RunJanitor supprime par lots les fichiers expires.
+// Les erreurs propres a un fichier sont indiquees dans le rapport, seules les erreurs globales sont renvoyees
+func (gfs *GoFS) RunJanitor(opts ...JanitorOptions) (JanitorReport, error) {
+	start := time.Now()
+	o := JanitorOptions{}
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	report, err := gfs.runJanitor(gfs.Context(), o)
+	gfs.logCall("RunJanitor", o.Path, start, -1, err)
+	return report, err
+}
+
+func (gfs *GoFS) runJanitor(ctx context.Context, opts JanitorOptions) (JanitorReport, error) {
+	// On initialise
+	report := JanitorReport{}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DEFAULT_JANITOR_BATCH_SIZE
+	}
+
+	// On recupere les fichiers expires, a travers les decorateurs du backend
+	expired, err := backend.ListExpired(ctx, gfs.b, opts.Path, time.Now())
+	if errors.Is(err, ErrNotSupported) {
+		return report, err
+	} else if err != nil {
+		return report, errors.New("unable to list expired files : " + err.Error())
+	}
+	sort.Strings(expired)
+	report.Expired = expired
+	if opts.DryRun {
+		return report, nil
+	}
+
+	// On supprime par lots
+	var mu sync.Mutex
+	for i := 0; i < len(expired); i += opts.BatchSize {
+		if ctx.Err() != nil {
+			return report, ctx.Err()
+		}
+		end := i + opts.BatchSize
+		if end > len(expired) {
+			end = len(expired)
+		}
+		var wg sync.WaitGroup
+		for _, filePath := range expired[i:end] {
+			wg.Add(1)
+			go func(filePath string) {
+				defer wg.Done()
+				deleted, err := gfs.deleteExpired(ctx, filePath)
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					report.Failed = append(report.Failed, JanitorError{Path: filePath, Err: err})
+				} else if deleted {
+					report.Deleted = append(report.Deleted, filePath)
+				}
+			}(filePath)
+		}
+		wg.Wait()
+	}
+
+	// On trie le rapport
+	sort.Strings(report.Deleted)
+	sort.Slice(report.Failed, func(i, j int) bool { return report.Failed[i].Path < report.Failed[j].Path })
+
+	return report, nil
+}
+
+// deleteExpired supprime le fichier s'il est toujours expire, il a pu etre reecrit depuis le listing
+func (gfs *GoFS) deleteExpired(ctx context.Context, filePath string) (bool, error) {
+	_, err := gfs.b.Stat(ctx, filePath)
+	if err == nil {
+		return false, nil
+	} else if !errors.Is(err, ErrNotExist) {
+		return false, err
+	}
+	err = gfs.b.Delete(ctx, filePath)
+	if errors.Is(err, ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// StartJanitor lance un janitor supprimant les fichiers expires a chaque intervalle,
+// jusqu'a l'annulation du contexte ou l'appel de Stop
+func (gfs *GoFS) StartJanitor(ctx context.Context, interval time.Duration, opts ...JanitorOptions) (*Janitor, error) {
+	// On verifie la configuration
+	if _, ok := gfs.b.(backend.Expirer); !ok {
+		return nil, ErrNotSupported
+	}
+	if interval <= 0 {
+		return nil, errors.New("invalid janitor interval[" + interval.String() + "]")
+	}
+
+	// On initialise
+	j := &Janitor{
+		gfs:      *gfs,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if len(opts) > 0 {
+		j.opts = opts[0]
+	}
+
+	go j.loop(ctx)
+
+	return j, nil
+}
+
+func (j *Janitor) loop(ctx context.Context) {
+	defer close(j.done)
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.run(ctx)
+		}
+	}
+}
+
+func (j *Janitor) run(ctx context.Context) {
+	report, err := j.gfs.runJanitor(ctx, j.opts)
+
+	// On met a jour les statistiques
+	j.mu.Lock()
+	j.stats.Runs++
+	j.stats.Expired += int64(len(report.Expired))
+	j.stats.Deleted += int64(len(report.Deleted))
+	j.stats.Failed += int64(len(report.Failed))
+	j.stats.LastRun = time.Now()
+	j.stats.LastError = err
+	j.mu.Unlock()
+
+	// On informe
+	if err != nil {
+		j.gfs.logger.Warn().
+			Str("path", j.opts.Path).
+			Err(err).
+			Msg("Janitor failed")
+		return
+	}
+	j.gfs.logger.Debug().
+		Str("op", "Janitor").
+		Str("path", j.opts.Path).
+		Int("expired", len(report.Expired)).
+		Int("deleted", len(report.Deleted)).
+		Int("failed", len(report.Failed)).
+		Bool("dry_run", j.opts.DryRun).
+		Send()
+}
+
+// Stats renvoie les statistiques cumulees des passages
+func (j *Janitor) Stats() JanitorStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.stats
+}
+
+// Stop arrete le janitor et attend la fin du passage en cours
+func (j *Janitor) Stop() {
+	j.once.Do(func() { close(j.stop) })
+	<-j.done
+}
@@ -0,0 +1,155 @@
+package gofs
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcktrash"
+)
+
+// writeExpiringFiles ecrit des fichiers deja expires, d'autres expirant plus tard et d'autres sans expiration
+func writeExpiringFiles(t *testing.T, goFS GoFS) {
+	t.Helper()
+	past := time.Now().Add(-time.Minute)
+	files := map[string]WriteOptions{
+		"expired":       {ExpiresAt: &past},
+		"dir/expired":   {ExpiresAt: &past},
+		"dir/sub/old":   {ExpiresAt: &past},
+		"later":         {TTL: time.Hour},
+		"dir/no_expiry": {},
+		"other/later":   {TTL: time.Hour},
+	}
+	for filePath, opts := range files {
+		if err := goFS.WriteString(filePath, "content", opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRunJanitor(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        JanitorOptions
+		wantExpired []string
+		wantDeleted []string
+	}{
+		{"all files", JanitorOptions{}, []string{"dir/expired", "dir/sub/old", "expired"}, []string{"dir/expired", "dir/sub/old", "expired"}},
+		{"single file batches", JanitorOptions{BatchSize: 1}, []string{"dir/expired", "dir/sub/old", "expired"}, []string{"dir/expired", "dir/sub/old", "expired"}},
+		{"folder", JanitorOptions{Path: "dir/"}, []string{"dir/expired", "dir/sub/old"}, []string{"dir/expired", "dir/sub/old"}},
+		{"dry run", JanitorOptions{DryRun: true}, []string{"dir/expired", "dir/sub/old", "expired"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basePath := t.TempDir()
+			goFS, err := New(BACKEND_TYPE_LOCAL, gofsbcklocal.LocalConfig{BasePath: basePath})
+			if err != nil {
+				t.Fatal(err)
+			}
+			writeExpiringFiles(t, goFS)
+
+			// Les fichiers expires ne sont plus visibles, meme avant leur suppression
+			files, err := goFS.List("", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(files)
+			if want := []string{"dir/no_expiry", "later", "other/later"}; !reflect.DeepEqual(files, want) {
+				t.Errorf("files = %v, want %v", files, want)
+			}
+
+			report, err := goFS.RunJanitor(tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(report.Expired, tt.wantExpired) || !reflect.DeepEqual(report.Deleted, tt.wantDeleted) || len(report.Failed) > 0 {
+				t.Errorf("report = %+v, want expired %v and deleted %v", report, tt.wantExpired, tt.wantDeleted)
+			}
+
+			// Les fichiers supprimes ont disparu du disque, les autres sont conserves
+			deleted := make(map[string]bool)
+			for _, filePath := range tt.wantDeleted {
+				deleted[filePath] = true
+			}
+			for _, filePath := range []string{"expired", "dir/expired", "dir/sub/old", "later", "dir/no_expiry"} {
+				_, err := os.Stat(filepath.Join(basePath, filePath))
+				if deleted[filePath] != os.IsNotExist(err) {
+					t.Errorf("file[%s] stat error = %v, want deleted %v", filePath, err, deleted[filePath])
+				}
+			}
+		})
+	}
+}
+
+func TestRunJanitorThroughDecorators(t *testing.T) {
+	basePath := t.TempDir()
+	goFS, err := New(BACKEND_TYPE_LOCAL, gofsbcklocal.LocalConfig{BasePath: basePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trash, err := gofsbcktrash.New(goFS.Backend(), gofsbcktrash.TrashConfig{PurgeInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trash.Close()
+	trashFS := goFS.WithBackend(trash)
+	writeExpiringFiles(t, trashFS)
+
+	// Les fichiers expires sont supprimes definitivement, sans passer par la corbeille
+	report, err := trashFS.RunJanitor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Deleted) != 3 || len(report.Failed) > 0 {
+		t.Errorf("report = %+v, want 3 deleted files", report)
+	}
+	entries, err := trash.ListTrash(context.Background(), "")
+	if err != nil || len(entries) != 0 {
+		t.Errorf("trash = %+v, %v, want an empty trash", entries, err)
+	}
+}
+
+func TestJanitorNotSupported(t *testing.T) {
+	goFS := newTestGoFS(t)
+	goFS = goFS.WithBackend(struct{ backend.Backend }{goFS.Backend()})
+
+	if _, err := goFS.RunJanitor(); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("run error = %v, want %v", err, ErrNotSupported)
+	}
+	if _, err := goFS.StartJanitor(context.Background(), time.Second); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("start error = %v, want %v", err, ErrNotSupported)
+	}
+}
+
+func TestStartJanitor(t *testing.T) {
+	goFS := newTestGoFS(t)
+	writeExpiringFiles(t, goFS)
+
+	if _, err := goFS.StartJanitor(context.Background(), 0); err == nil {
+		t.Error("janitor started without interval")
+	}
+
+	// Le janitor supprime les fichiers expires au premier passage
+	janitor, err := goFS.StartJanitor(context.Background(), 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for janitor.Stats().Deleted < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	janitor.Stop()
+	janitor.Stop()
+
+	stats := janitor.Stats()
+	if stats.Runs == 0 || stats.Deleted != 3 || stats.Failed != 0 || stats.LastError != nil {
+		t.Errorf("stats = %+v, want 3 deleted files", stats)
+	}
+}
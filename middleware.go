@@ -0,0 +1,363 @@
+package gofs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// Noms des operations vues par les middlewares.
+// ReadString et WriteString sont presentees comme Read et Write
+const (
+	OP_LIST         = "List"
+	OP_STAT         = "Stat"
+	OP_READ         = "Read"
+	OP_READ_STREAM  = "ReadStream"
+	OP_WRITE        = "Write"
+	OP_WRITE_STREAM = "WriteStream"
+	OP_COPY         = "Copy"
+	OP_MOVE         = "Move"
+	OP_DELETE       = "Delete"
+	OP_SET_METADATA = "SetMetadata"
+	// Operations optionnelles, qui renvoient ErrNotSupported si le backend ne les propose pas
+	OP_LIST_FILTERED  = "ListFiltered"
+	OP_READ_DIR       = "ReadDir"
+	OP_LIST_VERSIONS  = "ListVersions"
+	OP_READ_VERSION   = "ReadVersion"
+	OP_DELETE_VERSION = "DeleteVersion"
+	OP_SET_RETENTION  = "SetRetention"
+	OP_SET_LEGAL_HOLD = "SetLegalHold"
+	OP_GET_LOCK       = "GetLock"
+	OP_LIST_EXPIRED   = "ListExpired"
+	OP_SYMLINK        = "Symlink"
+	OP_READLINK       = "Readlink"
+	OP_WATCH          = "Watch"
+)
+
+// Operation decrit un appel au backend, un middleware peut la modifier avant de la transmettre
+type Operation struct {
+	Name string
+	Path string
+	// Destination de Copy et Move
+	DstPath string
+	// Options de List
+	Recursive bool
+	// Options de ReadStream
+	ReadOptions ReadOptions
+	// Contenu et options de Write et WriteStream
+	Data         []byte
+	Stream       io.ReadCloser
+	Length       int64
+	WriteOptions WriteOptions
+	// Metadonnees de SetMetadata
+	Metadata map[string]string
+	// Options de ListFiltered et Watch
+	ListOptions  ListOptions
+	WatchOptions WatchOptions
+	// Version de ReadVersion et DeleteVersion
+	VersionID string
+	// Protection de SetRetention et SetLegalHold
+	RetentionMode RetentionMode
+	RetainUntil   time.Time
+	LegalHold     bool
+	// Date de reference de ListExpired
+	Now time.Time
+	// Cible de Symlink, Path etant le lien
+	Target string
+}
+
+// Result contient le retour d'une operation, seul le champ correspondant a l'operation est renseigne
+type Result struct {
+	Files    []string
+	Info     FileInfo
+	Data     []byte
+	Stream   FileStream
+	Entries  []fs.DirEntry
+	Versions []Version
+	Lock     Lock
+	Target   string
+	Events   <-chan Event
+	Err      error
+}
+
+// Handler execute une operation
+type Handler func(ctx context.Context, op *Operation) Result
+
+// Middleware enveloppe le handler suivant, il peut agir avant et apres l'appel, le modifier ou l'interrompre
+type Middleware func(next Handler) Handler
+
+// Before renvoie un middleware appelant hook avant chaque operation.
+// Le hook peut modifier l'operation, ou l'annuler en renvoyant une erreur
+func Before(hook func(ctx context.Context, op *Operation) error) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op *Operation) Result {
+			if err := hook(ctx, op); err != nil {
+				return Result{Err: err}
+			}
+			return next(ctx, op)
+		}
+	}
+}
+
+// After renvoie un middleware appelant hook apres chaque operation, le hook pouvant modifier le resultat
+func After(hook func(ctx context.Context, op *Operation, result *Result)) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, op *Operation) Result {
+			result := next(ctx, op)
+			hook(ctx, op, &result)
+			return result
+		}
+	}
+}
+
+// WithMiddleware ajoute des middlewares autour du backend, le premier fourni etant le premier appele
+func WithMiddleware(mw ...Middleware) Option {
+	return func(o *options) {
+		o.middlewares = append(o.middlewares, mw...)
+	}
+}
+
+// NewMiddlewareBackend enveloppe un backend avec des middlewares, par exemple pour les placer
+// autour d'un backend de chiffrement ou de compression utilise avec WithBackend.
+// Les fonctionnalites optionnelles passent aussi par les middlewares, et renvoient ErrNotSupported
+// si le backend enveloppe ne les propose pas
+func NewMiddlewareBackend(next backend.Backend, mw ...Middleware) backend.Backend {
+	// On construit la chaine en partant du backend
+	handler := Handler(func(ctx context.Context, op *Operation) Result {
+		return dispatch(ctx, next, op)
+	})
+	for i := len(mw) - 1; i >= 0; i-- {
+		handler = mw[i](handler)
+	}
+
+	return &middlewareBackend{next: next, handler: handler}
+}
+
+// dispatch execute l'operation sur le backend
+func dispatch(ctx context.Context, b backend.Backend, op *Operation) Result {
+	result := Result{}
+
+	switch op.Name {
+	case OP_LIST:
+		result.Files, result.Err = b.List(ctx, op.Path, op.Recursive)
+	case OP_STAT:
+		result.Info, result.Err = b.Stat(ctx, op.Path)
+	case OP_READ:
+		result.Data, result.Err = b.Read(ctx, op.Path)
+	case OP_READ_STREAM:
+		result.Stream, result.Err = b.ReadStream(ctx, op.Path, op.ReadOptions)
+	case OP_WRITE:
+		result.Err = b.Write(ctx, op.Path, op.Data, op.WriteOptions)
+	case OP_WRITE_STREAM:
+		result.Err = b.WriteStream(ctx, op.Path, op.Stream, op.Length, op.WriteOptions)
+	case OP_COPY:
+		result.Err = b.Copy(ctx, op.Path, op.DstPath)
+	case OP_MOVE:
+		result.Err = b.Move(ctx, op.Path, op.DstPath)
+	case OP_DELETE:
+		result.Err = b.Delete(ctx, op.Path)
+	case OP_SET_METADATA:
+		result.Err = b.SetMetadata(ctx, op.Path, op.Metadata)
+	default:
+		return dispatchOptional(ctx, b, op)
+	}
+
+	return result
+}
+
+// dispatchOptional execute une operation optionnelle, si le backend la propose
+func dispatchOptional(ctx context.Context, b backend.Backend, op *Operation) Result {
+	result := Result{Err: ErrNotSupported}
+
+	switch op.Name {
+	case OP_LIST_FILTERED:
+		if lister, ok := b.(backend.FilteredLister); ok {
+			result.Files, result.Err = lister.ListFiltered(ctx, op.Path, op.ListOptions)
+		}
+	case OP_READ_DIR:
+		if dirReader, ok := b.(backend.DirReader); ok {
+			result.Entries, result.Err = dirReader.ReadDir(ctx, op.Path)
+		}
+	case OP_LIST_VERSIONS:
+		if versioner, ok := b.(backend.Versioner); ok {
+			result.Versions, result.Err = versioner.ListVersions(ctx, op.Path)
+		}
+	case OP_READ_VERSION:
+		if versioner, ok := b.(backend.Versioner); ok {
+			result.Stream, result.Err = versioner.ReadVersion(ctx, op.Path, op.VersionID, op.ReadOptions)
+		}
+	case OP_DELETE_VERSION:
+		if versioner, ok := b.(backend.Versioner); ok {
+			result.Err = versioner.DeleteVersion(ctx, op.Path, op.VersionID)
+		}
+	case OP_SET_RETENTION:
+		if locker, ok := b.(backend.Locker); ok {
+			result.Err = locker.SetRetention(ctx, op.Path, op.RetentionMode, op.RetainUntil)
+		}
+	case OP_SET_LEGAL_HOLD:
+		if locker, ok := b.(backend.Locker); ok {
+			result.Err = locker.SetLegalHold(ctx, op.Path, op.LegalHold)
+		}
+	case OP_GET_LOCK:
+		if locker, ok := b.(backend.Locker); ok {
+			result.Lock, result.Err = locker.GetLock(ctx, op.Path)
+		}
+	case OP_LIST_EXPIRED:
+		if expirer, ok := b.(backend.Expirer); ok {
+			result.Files, result.Err = expirer.ListExpired(ctx, op.Path, op.Now)
+		}
+	case OP_SYMLINK:
+		if symlinker, ok := b.(backend.Symlinker); ok {
+			result.Err = symlinker.Symlink(ctx, op.Target, op.Path)
+		}
+	case OP_READLINK:
+		if symlinker, ok := b.(backend.Symlinker); ok {
+			result.Target, result.Err = symlinker.Readlink(ctx, op.Path)
+		}
+	case OP_WATCH:
+		if watcher, ok := b.(backend.Watcher); ok {
+			result.Events, result.Err = watcher.Watch(ctx, op.Path, op.WatchOptions)
+		}
+	default:
+		result.Err = errors.New("unknown operation[" + op.Name + "]")
+	}
+
+	return result
+}
+
+// middlewareBackend transforme chaque appel en Operation transmise a la chaine de middlewares.
+// Il propose toutes les interfaces optionnelles, next permettant de savoir lesquelles sont reellement disponibles
+type middlewareBackend struct {
+	next    backend.Backend
+	handler Handler
+}
+
+func (b *middlewareBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	result := b.handler(ctx, &Operation{Name: OP_LIST, Path: path, Recursive: recursive})
+	return result.Files, result.Err
+}
+
+func (b *middlewareBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	result := b.handler(ctx, &Operation{Name: OP_STAT, Path: filePath})
+	return result.Info, result.Err
+}
+
+func (b *middlewareBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	result := b.handler(ctx, &Operation{Name: OP_READ, Path: filePath})
+	return result.Data, result.Err
+}
+
+func (b *middlewareBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	data, err := b.Read(ctx, filePath)
+	return string(data), err
+}
+
+func (b *middlewareBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	result := b.handler(ctx, &Operation{Name: OP_READ_STREAM, Path: filePath, ReadOptions: backend.MergeReadOptions(opts)})
+	return result.Stream, result.Err
+}
+
+func (b *middlewareBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	return b.handler(ctx, &Operation{
+		Name:         OP_WRITE,
+		Path:         filePath,
+		Data:         data,
+		Length:       int64(len(data)),
+		WriteOptions: backend.MergeWriteOptions(opts),
+	}).Err
+}
+
+func (b *middlewareBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	return b.Write(ctx, filePath, []byte(content), opts...)
+}
+
+func (b *middlewareBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	return b.handler(ctx, &Operation{
+		Name:         OP_WRITE_STREAM,
+		Path:         filePath,
+		Stream:       stream,
+		Length:       length,
+		WriteOptions: backend.MergeWriteOptions(opts),
+	}).Err
+}
+
+func (b *middlewareBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.handler(ctx, &Operation{Name: OP_COPY, Path: filePathSrc, DstPath: filePathDst}).Err
+}
+
+func (b *middlewareBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.handler(ctx, &Operation{Name: OP_MOVE, Path: filePathSrc, DstPath: filePathDst}).Err
+}
+
+func (b *middlewareBackend) Delete(ctx context.Context, filePath string) error {
+	return b.handler(ctx, &Operation{Name: OP_DELETE, Path: filePath}).Err
+}
+
+func (b *middlewareBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	return b.handler(ctx, &Operation{Name: OP_SET_METADATA, Path: filePath, Metadata: metadata}).Err
+}
+
+func (b *middlewareBackend) ListFiltered(ctx context.Context, path string, opts backend.ListOptions) ([]string, error) {
+	result := b.handler(ctx, &Operation{Name: OP_LIST_FILTERED, Path: path, Recursive: opts.Recursive, ListOptions: opts})
+	return result.Files, result.Err
+}
+
+func (b *middlewareBackend) ReadDir(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+	result := b.handler(ctx, &Operation{Name: OP_READ_DIR, Path: dir})
+	return result.Entries, result.Err
+}
+
+func (b *middlewareBackend) ListVersions(ctx context.Context, filePath string) ([]backend.Version, error) {
+	result := b.handler(ctx, &Operation{Name: OP_LIST_VERSIONS, Path: filePath})
+	return result.Versions, result.Err
+}
+
+func (b *middlewareBackend) ReadVersion(ctx context.Context, filePath string, versionID string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	result := b.handler(ctx, &Operation{
+		Name:        OP_READ_VERSION,
+		Path:        filePath,
+		VersionID:   versionID,
+		ReadOptions: backend.MergeReadOptions(opts),
+	})
+	return result.Stream, result.Err
+}
+
+func (b *middlewareBackend) DeleteVersion(ctx context.Context, filePath string, versionID string) error {
+	return b.handler(ctx, &Operation{Name: OP_DELETE_VERSION, Path: filePath, VersionID: versionID}).Err
+}
+
+func (b *middlewareBackend) SetRetention(ctx context.Context, filePath string, mode backend.RetentionMode, until time.Time) error {
+	return b.handler(ctx, &Operation{Name: OP_SET_RETENTION, Path: filePath, RetentionMode: mode, RetainUntil: until}).Err
+}
+
+func (b *middlewareBackend) SetLegalHold(ctx context.Context, filePath string, on bool) error {
+	return b.handler(ctx, &Operation{Name: OP_SET_LEGAL_HOLD, Path: filePath, LegalHold: on}).Err
+}
+
+func (b *middlewareBackend) GetLock(ctx context.Context, filePath string) (backend.Lock, error) {
+	result := b.handler(ctx, &Operation{Name: OP_GET_LOCK, Path: filePath})
+	return result.Lock, result.Err
+}
+
+func (b *middlewareBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	result := b.handler(ctx, &Operation{Name: OP_LIST_EXPIRED, Path: path, Now: now})
+	return result.Files, result.Err
+}
+
+func (b *middlewareBackend) Symlink(ctx context.Context, target string, linkPath string) error {
+	return b.handler(ctx, &Operation{Name: OP_SYMLINK, Path: linkPath, Target: target}).Err
+}
+
+func (b *middlewareBackend) Readlink(ctx context.Context, linkPath string) (string, error) {
+	result := b.handler(ctx, &Operation{Name: OP_READLINK, Path: linkPath})
+	return result.Target, result.Err
+}
+
+func (b *middlewareBackend) Watch(ctx context.Context, prefix string, opts backend.WatchOptions) (<-chan backend.Event, error) {
+	result := b.handler(ctx, &Operation{Name: OP_WATCH, Path: prefix, WatchOptions: opts})
+	return result.Events, result.Err
+}
@@ -0,0 +1,31 @@
+package gofs
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// Option modifie la creation d'une instance
+type Option func(o *options)
+
+type options struct {
+	logger      *zerolog.Logger
+	middlewares []Middleware
+}
+
+// WithLogger utilise le logger fourni pour l'instance et son backend au lieu du logger global.
+// Le niveau debug reste controle par l'option Debug de la configuration du backend.
+// Seul zerolog est supporte, il n'existe pas d'option equivalente pour log/slog
+func WithLogger(logger zerolog.Logger) Option {
+	return func(o *options) {
+		o.logger = &logger
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
@@ -0,0 +1,262 @@
+package gofsbckaudit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/rs/zerolog"
+)
+
+type actorKey struct{}
+
+// WithActor renvoie un contexte indiquant l'auteur des operations, a utiliser avec GoFS.WithContext
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext renvoie l'auteur indique par WithActor, vide sinon
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+type AuditConfig struct {
+	// Destination du journal (FileSink, BackendSink, FuncSink, ...)
+	Sink Sink
+	// Journalise egalement les lectures
+	AuditReads bool
+	// Recupere l'auteur depuis le contexte, ActorFromContext par defaut
+	Actor func(ctx context.Context) string
+	// Ne renvoie pas les erreurs d'ecriture du journal, elles sont seulement tracees
+	IgnoreSinkErrors bool
+	// Active les logs de debug de l'instance
+	Debug bool
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
+}
+
+// AuditBackend enregistre chaque modification faite sur le backend suivant dans un journal chaine
+type AuditBackend struct {
+	Config   AuditConfig
+	next     backend.Backend
+	logger   zerolog.Logger
+	mu       sync.Mutex
+	seq      uint64
+	prevHash string
+}
+
+func New(next backend.Backend, config AuditConfig) (*AuditBackend, error) {
+	// On applique les valeurs par defaut
+	if config.Actor == nil {
+		config.Actor = ActorFromContext
+	}
+
+	// On verifie la configuration
+	if next == nil {
+		return nil, errors.New("missing backend to audit")
+	}
+	if config.Sink == nil {
+		return nil, errors.New("missing audit sink")
+	}
+
+	// On reprend la chaine la ou elle s'etait arretee
+	b := &AuditBackend{
+		Config: config,
+		next:   next,
+		logger: backend.NewLogger(config.Logger, "audit", config.Debug),
+	}
+	line, err := config.Sink.LastLine()
+	if err != nil {
+		return nil, errors.New("unable to resume audit log : " + err.Error())
+	}
+	if len(line) > 0 {
+		var last Record
+		if err = json.Unmarshal(line, &last); err != nil {
+			return nil, errors.New("invalid last audit record : " + err.Error())
+		}
+		b.seq = last.Seq
+		b.prevHash = last.Hash
+	}
+
+	// On informe
+	b.logger.Debug().
+		Uint64("seq", b.seq).
+		Msg("Starting backend ...")
+
+	return b, nil
+}
+
+func (b *AuditBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	return b.next.List(ctx, path, recursive)
+}
+
+func (b *AuditBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	return b.next.Stat(ctx, filePath)
+}
+
+func (b *AuditBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	data, err := b.next.Read(ctx, filePath)
+	if !b.Config.AuditReads {
+		return data, err
+	}
+
+	// On journalise la lecture
+	record := Record{Op: "Read", Path: filePath}
+	if err == nil {
+		record.Size = int64(len(data))
+		record.Checksum = checksum(data)
+	}
+	return data, b.record(ctx, record, err)
+}
+
+func (b *AuditBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	// On utilise la methode existante
+	data, err := b.Read(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// On converti en string
+	return string(data), err
+}
+
+func (b *AuditBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	fileStream, err := b.next.ReadStream(ctx, filePath, opts...)
+	if !b.Config.AuditReads {
+		return fileStream, err
+	}
+
+	// On journalise l'ouverture, le contenu n'etant pas encore lu
+	record := Record{Op: "ReadStream", Path: filePath}
+	if err == nil {
+		record.Size = fileStream.Size
+	}
+	if err = b.record(ctx, record, err); err != nil && fileStream.Content != nil {
+		fileStream.Content.Close()
+	}
+	return fileStream, err
+}
+
+func (b *AuditBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	err := b.next.Write(ctx, filePath, data, opts...)
+	return b.record(ctx, Record{Op: "Write", Path: filePath, Size: int64(len(data)), Checksum: checksum(data)}, err)
+}
+
+func (b *AuditBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	// On utilise la methode existante
+	return b.Write(ctx, filePath, []byte(content), opts...)
+}
+
+func (b *AuditBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	// On calcule l'empreinte du contenu au fur et a mesure de son envoi
+	hasher := &hashingReadCloser{ReadCloser: stream, hash: sha256.New()}
+	err := b.next.WriteStream(ctx, filePath, hasher, length, opts...)
+
+	return b.record(ctx, Record{
+		Op:       "WriteStream",
+		Path:     filePath,
+		Size:     hasher.size,
+		Checksum: hex.EncodeToString(hasher.hash.Sum(nil)),
+	}, err)
+}
+
+func (b *AuditBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	err := b.next.Copy(ctx, filePathSrc, filePathDst)
+	return b.record(ctx, Record{Op: "Copy", Path: filePathSrc, DstPath: filePathDst}, err)
+}
+
+func (b *AuditBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	err := b.next.Move(ctx, filePathSrc, filePathDst)
+	return b.record(ctx, Record{Op: "Move", Path: filePathSrc, DstPath: filePathDst}, err)
+}
+
+func (b *AuditBackend) Delete(ctx context.Context, filePath string) error {
+	err := b.next.Delete(ctx, filePath)
+	return b.record(ctx, Record{Op: "Delete", Path: filePath}, err)
+}
+
+func (b *AuditBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	err := b.next.SetMetadata(ctx, filePath, metadata)
+	return b.record(ctx, Record{Op: "SetMetadata", Path: filePath}, err)
+}
+
+// ListExpired transmet la recherche des fichiers expires au backend decore
+func (b *AuditBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	return backend.ListExpired(ctx, b.next, path, now)
+}
+
+// Close ferme la destination du journal
+func (b *AuditBackend) Close() error {
+	return b.Config.Sink.Close()
+}
+
+// record complete l'enregistrement avec le resultat de l'operation, le chaine au precedent et l'ecrit.
+// Renvoie l'erreur de l'operation, ou a defaut celle du journal
+func (b *AuditBackend) record(ctx context.Context, record Record, opErr error) error {
+	// On complete l'enregistrement
+	record.Time = time.Now().UTC()
+	record.Actor = b.Config.Actor(ctx)
+	record.Result = RESULT_OK
+	if opErr != nil {
+		record.Result = RESULT_ERROR
+		record.Error = opErr.Error()
+		record.Size = 0
+		record.Checksum = ""
+	}
+
+	// On chaine et on ecrit l'enregistrement, un seul a la fois
+	b.mu.Lock()
+	record.Seq = b.seq + 1
+	record.PrevHash = b.prevHash
+	line, err := record.seal()
+	if err == nil {
+		err = b.Config.Sink.Write(line)
+	}
+	if err == nil {
+		b.seq = record.Seq
+		b.prevHash = record.Hash
+	}
+	b.mu.Unlock()
+
+	// On gere l'erreur du journal
+	if err != nil {
+		b.logger.Error().
+			Err(err).
+			Str("op", record.Op).
+			Str("path", record.Path).
+			Msg("unable to write audit record")
+		if opErr == nil && !b.Config.IgnoreSinkErrors {
+			return errors.New("audit log error : " + err.Error())
+		}
+	}
+
+	return opErr
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+type hashingReadCloser struct {
+	io.ReadCloser
+	hash hash.Hash
+	size int64
+}
+
+func (r *hashingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.hash.Write(p[:n])
+		r.size += int64(n)
+	}
+	return n, err
+}
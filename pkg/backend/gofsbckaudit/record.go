@@ -0,0 +1,112 @@
+package gofsbckaudit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	RESULT_OK    = "ok"
+	RESULT_ERROR = "error"
+)
+
+// ErrTampered est renvoyee par Verify lorsque la chaine des enregistrements est rompue
+var ErrTampered = errors.New("audit log has been tampered with")
+
+// Record est un enregistrement du journal d'audit, ecrit sur une ligne JSON
+type Record struct {
+	// Numero de l'enregistrement, croissant depuis le debut de la chaine
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Auteur de l'operation, voir WithActor
+	Actor   string `json:"actor,omitempty"`
+	Op      string `json:"op"`
+	Path    string `json:"path"`
+	DstPath string `json:"path_dst,omitempty"`
+	// Taille et empreinte SHA-256 du contenu ecrit ou lu
+	Size     int64  `json:"size,omitempty"`
+	Checksum string `json:"checksum,omitempty"`
+	Result   string `json:"result"`
+	Error    string `json:"error,omitempty"`
+	// Empreinte de l'enregistrement precedent et de celui-ci
+	PrevHash string `json:"prev_hash"`
+	Hash     string `json:"hash"`
+}
+
+// seal calcule l'empreinte de l'enregistrement, qui couvre tous ses champs dont PrevHash,
+// et renvoie la ligne JSON a ecrire
+func (r *Record) seal() ([]byte, error) {
+	hash, err := r.computeHash()
+	if err != nil {
+		return nil, err
+	}
+	r.Hash = hash
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
+
+func (r Record) computeHash() (string, error) {
+	// L'empreinte est calculee sur l'enregistrement sans son propre hash
+	r.Hash = ""
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Verify relit un journal et verifie le chainage de ses enregistrements.
+// prevHash est le hash du dernier enregistrement du journal precedent en cas de rotation, vide sinon.
+// Renvoie le hash du dernier enregistrement, a fournir pour verifier le journal suivant, et le nombre d'enregistrements
+func Verify(r io.Reader, prevHash string) (string, int, error) {
+	// On initialise
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	count := 0
+
+	// On parcours les lignes
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		count++
+
+		// On relit l'enregistrement
+		var record Record
+		if err := json.Unmarshal(line, &record); err != nil {
+			return prevHash, count - 1, errors.New("invalid audit record at line[" + strconv.Itoa(count) + "] : " + err.Error())
+		}
+
+		// On verifie le lien avec le precedent puis son empreinte
+		if record.PrevHash != prevHash {
+			return prevHash, count - 1, fmt.Errorf("%w : broken chain at seq[%d]", ErrTampered, record.Seq)
+		}
+		hash, err := record.computeHash()
+		if err != nil {
+			return prevHash, count - 1, err
+		}
+		if hash != record.Hash {
+			return prevHash, count - 1, fmt.Errorf("%w : invalid hash at seq[%d]", ErrTampered, record.Seq)
+		}
+		prevHash = record.Hash
+	}
+	if err := scanner.Err(); err != nil {
+		return prevHash, count, errors.New("unable to read audit log : " + err.Error())
+	}
+
+	return prevHash, count, nil
+}
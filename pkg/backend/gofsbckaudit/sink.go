@@ -0,0 +1,231 @@
+package gofsbckaudit
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+const (
+	DEFAULT_SEGMENT_MAX_SIZE = 1024 * 1024
+	DEFAULT_SEGMENT_MAX_AGE  = time.Hour
+	SEGMENT_EXTENSION        = ".jsonl"
+	// Format des noms de segments, triables par ordre chronologique
+	SEGMENT_TIME_FORMAT = "20060102T150405.000000000Z"
+)
+
+// Sink recoit les lignes du journal d'audit
+type Sink interface {
+	// Write ecrit une ligne JSON terminee par un retour a la ligne
+	Write(line []byte) error
+	// LastLine renvoie la derniere ligne deja ecrite, afin de poursuivre la chaine, ou nil
+	LastLine() ([]byte, error)
+	Close() error
+}
+
+// FuncSink transmet chaque ligne a une fonction, la chaine repart de zero a chaque demarrage
+type FuncSink func(line []byte) error
+
+func (f FuncSink) Write(line []byte) error {
+	return f(line)
+}
+
+func (f FuncSink) LastLine() ([]byte, error) {
+	return nil, nil
+}
+
+func (f FuncSink) Close() error {
+	return nil
+}
+
+// FileSink ajoute les lignes a la fin d'un fichier local
+type FileSink struct {
+	mu   sync.Mutex
+	fd   *os.File
+	last []byte
+}
+
+func NewFileSink(filePath string) (*FileSink, error) {
+	// On recupere la derniere ligne du fichier existant
+	data, err := os.ReadFile(filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.New("unable to read audit file[" + filePath + "] : " + err.Error())
+	}
+
+	// On ouvre le fichier en ajout
+	if err = os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, errors.New("unable to create audit folder : " + err.Error())
+	}
+	fd, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.New("unable to open audit file[" + filePath + "] : " + err.Error())
+	}
+
+	return &FileSink{fd: fd, last: lastLine(data)}, nil
+}
+
+func (s *FileSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// On ecrit puis on force l'ecriture sur le disque
+	if _, err := s.fd.Write(line); err != nil {
+		return err
+	}
+	return s.fd.Sync()
+}
+
+func (s *FileSink) LastLine() ([]byte, error) {
+	return s.last, nil
+}
+
+func (s *FileSink) Close() error {
+	return s.fd.Close()
+}
+
+type BackendSinkConfig struct {
+	// Dossier des segments dans le backend
+	Path string
+	// Taille et age maximum d'un segment avant d'en commencer un nouveau
+	MaxSize int64
+	MaxAge  time.Duration
+}
+
+// BackendSink ecrit le journal dans un backend GoFS, sous forme de segments horodates.
+// Les backends ne permettant pas d'ajouter a un fichier, le segment courant est reecrit a chaque ligne
+type BackendSink struct {
+	Config  BackendSinkConfig
+	b       backend.Backend
+	mu      sync.Mutex
+	segment string
+	started time.Time
+	buffer  bytes.Buffer
+}
+
+// NewBackendSink cree le sink, b ne doit pas etre le backend audite afin de ne pas journaliser le journal
+func NewBackendSink(b backend.Backend, config BackendSinkConfig) (*BackendSink, error) {
+	// On applique les valeurs par defaut
+	if config.MaxSize == 0 {
+		config.MaxSize = DEFAULT_SEGMENT_MAX_SIZE
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = DEFAULT_SEGMENT_MAX_AGE
+	}
+	if config.Path != "" {
+		config.Path = strings.Trim(config.Path, "/") + "/"
+	}
+
+	// On verifie la configuration
+	if b == nil {
+		return nil, errors.New("missing audit log backend")
+	}
+	if config.MaxSize < 0 || config.MaxAge < 0 {
+		return nil, errors.New("invalid audit segment limits")
+	}
+
+	return &BackendSink{Config: config, b: b}, nil
+}
+
+func (s *BackendSink) Write(line []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// On commence un nouveau segment si besoin
+	now := time.Now().UTC()
+	if s.segment == "" || int64(s.buffer.Len()+len(line)) > s.Config.MaxSize || now.Sub(s.started) > s.Config.MaxAge {
+		s.segment = s.Config.Path + now.Format(SEGMENT_TIME_FORMAT) + SEGMENT_EXTENSION
+		s.started = now
+		s.buffer.Reset()
+	}
+
+	// On reecrit le segment avec la nouvelle ligne
+	s.buffer.Write(line)
+	if err := s.b.Write(context.Background(), s.segment, s.buffer.Bytes()); err != nil {
+		s.buffer.Truncate(s.buffer.Len() - len(line))
+		return errors.New("unable to write audit segment[" + s.segment + "] : " + err.Error())
+	}
+
+	return nil
+}
+
+func (s *BackendSink) LastLine() ([]byte, error) {
+	// On recupere le dernier segment
+	segments, err := s.Segments()
+	if err != nil || len(segments) == 0 {
+		return nil, err
+	}
+	data, err := s.b.Read(context.Background(), segments[len(segments)-1])
+	if err != nil {
+		return nil, errors.New("unable to read audit segment : " + err.Error())
+	}
+
+	return lastLine(data), nil
+}
+
+// Segments renvoie les chemins des segments, par ordre chronologique
+func (s *BackendSink) Segments() ([]string, error) {
+	files, err := s.b.List(context.Background(), s.Config.Path, false)
+	if err != nil {
+		return nil, errors.New("unable to list audit segments : " + err.Error())
+	}
+
+	segments := make([]string, 0, len(files))
+	for _, file := range files {
+		if strings.HasSuffix(file, SEGMENT_EXTENSION) {
+			segments = append(segments, s.Config.Path+strings.TrimPrefix(file, "/"))
+		}
+	}
+	sort.Strings(segments)
+
+	return segments, nil
+}
+
+// Verify verifie la chaine sur l'ensemble des segments et renvoie le nombre d'enregistrements
+func (s *BackendSink) Verify(ctx context.Context) (int, error) {
+	segments, err := s.Segments()
+	if err != nil {
+		return 0, err
+	}
+
+	// La chaine se poursuit d'un segment a l'autre
+	prevHash, total := "", 0
+	for _, segment := range segments {
+		fileStream, err := s.b.ReadStream(ctx, segment)
+		if err != nil {
+			return total, errors.New("unable to read audit segment[" + segment + "] : " + err.Error())
+		}
+		var count int
+		prevHash, count, err = Verify(fileStream.Content, prevHash)
+		fileStream.Content.Close()
+		total += count
+		if err != nil {
+			return total, errors.New("segment[" + segment + "] : " + err.Error())
+		}
+	}
+
+	return total, nil
+}
+
+func (s *BackendSink) Close() error {
+	return nil
+}
+
+// lastLine renvoie la derniere ligne non vide
+func lastLine(data []byte) []byte {
+	data = bytes.TrimRight(data, "\r\n")
+	if len(data) == 0 {
+		return nil
+	}
+	if i := bytes.LastIndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return data
+}
@@ -0,0 +1,127 @@
+package gofsbckcompress
+
+import (
+	"compress/gzip"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	CODEC_GZIP = "gzip"
+	CODEC_ZSTD = "zstd"
+)
+
+// DEFAULT_SKIP_CONTENT_TYPES liste les types de contenu deja compresses,
+// ceux se terminant par "/" s'appliquent a toute la famille
+var DEFAULT_SKIP_CONTENT_TYPES = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-xz",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/vnd.rar",
+	"application/pdf",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+	"application/vnd.openxmlformats-officedocument.presentationml.presentation",
+	"application/epub+zip",
+	"application/java-archive",
+}
+
+// Ces images ne sont pas deja compressees, elles le seront sauf si elles sont listees explicitement
+var compressibleImages = []string{"image/svg+xml", "image/bmp", "image/x-ms-bmp"}
+
+func checkCodec(codec string) error {
+	if codec != CODEC_GZIP && codec != CODEC_ZSTD {
+		return errors.New("unknown compression codec[" + codec + "]")
+	}
+
+	return nil
+}
+
+// newCompressWriter renvoie un writer compressant vers w, qu'il faut fermer pour terminer le flux
+func newCompressWriter(w io.Writer, codec string, level int) (io.WriteCloser, error) {
+	switch codec {
+	case CODEC_GZIP:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CODEC_ZSTD:
+		if level == 0 {
+			return zstd.NewWriter(w)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+
+	return nil, checkCodec(codec)
+}
+
+// newDecompressReader renvoie un reader decompressant r, dont la fermeture ferme aussi r
+func newDecompressReader(r io.ReadCloser, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case CODEC_GZIP:
+		gzipReader, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, errors.New("invalid gzip content : " + err.Error())
+		}
+		return decompressReadCloser{gzipReader, r, gzipReader.Close}, nil
+	case CODEC_ZSTD:
+		zstdReader, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, errors.New("invalid zstd content : " + err.Error())
+		}
+		return decompressReadCloser{zstdReader, r, func() error { zstdReader.Close(); return nil }}, nil
+	}
+
+	return nil, checkCodec(codec)
+}
+
+type decompressReadCloser struct {
+	io.Reader
+	src   io.Closer
+	close func() error
+}
+
+func (r decompressReadCloser) Close() error {
+	r.close()
+	return r.src.Close()
+}
+
+// isCompressed indique si le type de contenu fait partie de la liste
+func isCompressed(contentType string, skipContentTypes []string) bool {
+	// On ignore les parametres du type
+	contentType = strings.ToLower(strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0]))
+
+	// On cherche d'abord le type exact
+	for _, skipped := range skipContentTypes {
+		if contentType == skipped {
+			return true
+		}
+	}
+
+	// Puis la famille, hors images vectorielles ou non compressees
+	for _, compressible := range compressibleImages {
+		if contentType == compressible {
+			return false
+		}
+	}
+	for _, skipped := range skipContentTypes {
+		if strings.HasSuffix(skipped, "/") && strings.HasPrefix(contentType, skipped) {
+			return true
+		}
+	}
+
+	return false
+}
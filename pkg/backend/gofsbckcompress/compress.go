@@ -0,0 +1,357 @@
+package gofsbckcompress
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Metadonnees enregistrees avec chaque fichier compresse
+	META_CODEC        = "gofs-codec"
+	META_SIZE         = "gofs-size"
+	META_CONTENT_TYPE = "gofs-content-type"
+
+	// Nombre d'octets utilises pour detecter le type de contenu
+	SNIFF_SIZE = 512
+)
+
+type CompressConfig struct {
+	// Algorithme utilise pour les ecritures, CODEC_GZIP par defaut
+	Codec string
+	// Niveau de compression propre a l'algorithme, 0 pour celui par defaut
+	Level int
+	// Types de contenu a ne pas compresser, DEFAULT_SKIP_CONTENT_TYPES si non renseigne
+	SkipContentTypes []string
+	// Dossier ou le contenu est compresse avant d'etre transmis, celui du systeme par defaut
+	TempDir string
+	// Active les logs de debug de l'instance
+	Debug bool
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
+}
+
+// CompressBackend compresse le contenu des fichiers avant de les transmettre au backend suivant,
+// et les decompresse a la lecture quel que soit l'algorithme utilise lors de l'ecriture
+type CompressBackend struct {
+	Config CompressConfig
+	next   backend.Backend
+	logger zerolog.Logger
+}
+
+func New(next backend.Backend, config CompressConfig) (*CompressBackend, error) {
+	// On applique les valeurs par defaut
+	if config.Codec == "" {
+		config.Codec = CODEC_GZIP
+	}
+	if config.SkipContentTypes == nil {
+		config.SkipContentTypes = DEFAULT_SKIP_CONTENT_TYPES
+	}
+
+	// On verifie la configuration
+	if next == nil {
+		return nil, errors.New("missing backend to compress")
+	}
+	if err := checkCodec(config.Codec); err != nil {
+		return nil, err
+	}
+	// On verifie le niveau en creant un writer de test
+	if _, err := newCompressWriter(io.Discard, config.Codec, config.Level); err != nil {
+		return nil, errors.New("invalid compression level[" + strconv.Itoa(config.Level) + "] : " + err.Error())
+	}
+
+	// On initialise le logger
+	logger := backend.NewLogger(config.Logger, "compress", config.Debug)
+
+	// On informe
+	logger.Debug().
+		Str("codec", config.Codec).
+		Int("level", config.Level).
+		Msg("Starting backend ...")
+
+	return &CompressBackend{
+		Config: config,
+		logger: logger,
+		next:   next,
+	}, nil
+}
+
+func (b *CompressBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	return b.next.List(ctx, path, recursive)
+}
+
+func (b *CompressBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	// On recupere les infos du fichier stocke
+	fInfo, err := b.next.Stat(ctx, filePath)
+	if err != nil || fInfo.Metadata[META_CODEC] == "" {
+		return fInfo, err
+	}
+
+	// On renvoie la taille et le type du contenu decompresse
+	if fInfo.Size, err = logicalSize(fInfo.Metadata); err != nil {
+		return fInfo, errors.New("file[" + filePath + "] " + err.Error())
+	}
+	if contentType := fInfo.Metadata[META_CONTENT_TYPE]; contentType != "" {
+		fInfo.ContentType = contentType
+	}
+	fInfo.Metadata = userMetadata(fInfo.Metadata)
+
+	return fInfo, nil
+}
+
+func (b *CompressBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	// On utilise le stream
+	fileStream, err := b.ReadStream(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fileStream.Content.Close()
+
+	return io.ReadAll(fileStream.Content)
+}
+
+func (b *CompressBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	// On utilise la methode existante
+	data, err := b.Read(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// On converti en string
+	return string(data), err
+}
+
+func (b *CompressBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	// On initialise
+	fileStream := backend.FileStream{}
+	readOpts := backend.MergeReadOptions(opts)
+
+	// Si le fichier n'est pas compresse, le backend suivant gere la lecture partielle
+	storedInfo, err := b.next.Stat(ctx, filePath)
+	if err != nil {
+		return fileStream, err
+	}
+	codec := storedInfo.Metadata[META_CODEC]
+	if codec == "" {
+		return b.next.ReadStream(ctx, filePath, opts...)
+	}
+	size, err := logicalSize(storedInfo.Metadata)
+	if err != nil {
+		return fileStream, errors.New("file[" + filePath + "] " + err.Error())
+	}
+
+	// On calcule la partie a renvoyer
+	if readOpts.Offset > size {
+		return fileStream, errors.New("read offset is beyond the end of file")
+	}
+	fileStream.ContentType = storedInfo.ContentType
+	if contentType := storedInfo.Metadata[META_CONTENT_TYPE]; contentType != "" {
+		fileStream.ContentType = contentType
+	}
+	fileStream.Size = size - readOpts.Offset
+	if readOpts.Length > 0 && readOpts.Length < fileStream.Size {
+		fileStream.Size = readOpts.Length
+	}
+
+	// On lit tout le fichier compresse
+	storedStream, err := b.next.ReadStream(ctx, filePath)
+	if err != nil {
+		return fileStream, err
+	}
+	content, err := newDecompressReader(storedStream.Content, codec)
+	if err != nil {
+		storedStream.Content.Close()
+		return fileStream, errors.New("file[" + filePath + "] " + err.Error())
+	}
+
+	// On ignore le debut puis on limite a la taille demandee
+	if readOpts.Offset > 0 {
+		if _, err = io.CopyN(io.Discard, content, readOpts.Offset); err != nil {
+			content.Close()
+			return fileStream, errors.New("unable to reach read offset : " + err.Error())
+		}
+	}
+	fileStream.Content = limitedReadCloser{io.LimitReader(content, fileStream.Size), content}
+
+	return fileStream, nil
+}
+
+func (b *CompressBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	// On utilise le stream
+	return b.WriteStream(ctx, filePath, io.NopCloser(bytes.NewReader(data)), int64(len(data)), opts...)
+}
+
+func (b *CompressBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	// On utilise la methode existante
+	return b.Write(ctx, filePath, []byte(content), opts...)
+}
+
+func (b *CompressBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	// On detecte le type de contenu depuis l'extension, sinon depuis les premiers octets
+	contentType := mime.TypeByExtension(filepath.Ext(filePath))
+	if contentType == "" {
+		sniffer := bufio.NewReaderSize(stream, SNIFF_SIZE)
+		head, _ := sniffer.Peek(SNIFF_SIZE)
+		contentType = http.DetectContentType(head)
+		stream = limitedReadCloser{sniffer, stream}
+	}
+
+	// Si le contenu est deja compresse, on l'ecrit tel quel
+	if isCompressed(contentType, b.Config.SkipContentTypes) {
+		b.logger.Debug().
+			Str("op", "WriteStream").
+			Str("path", filePath).
+			Str("content_type", contentType).
+			Msg("Content already compressed")
+		return b.next.WriteStream(ctx, filePath, stream, length, opts...)
+	}
+
+	// On enregistre l'algorithme et la taille avec le fichier
+	writeOpts := backend.MergeWriteOptions(opts)
+	metadata := make(map[string]string, len(writeOpts.Metadata)+3)
+	for key, value := range writeOpts.Metadata {
+		metadata[key] = value
+	}
+	metadata[META_CODEC] = b.Config.Codec
+	metadata[META_CONTENT_TYPE] = contentType
+	writeOpts.Metadata = metadata
+
+	// On compresse dans un fichier temporaire afin de connaitre les tailles avant l'ecriture,
+	// le fichier et toutes ses metadonnees etant ainsi ecrits en une seule fois
+	spool, size, compressedSize, err := b.spool(stream)
+	if err != nil {
+		return errors.New("unable to compress file[" + filePath + "] : " + err.Error())
+	}
+	defer os.Remove(spool.Name())
+	metadata[META_SIZE] = strconv.FormatInt(size, 10)
+
+	return b.next.WriteStream(ctx, filePath, spool, compressedSize, writeOpts)
+}
+
+// spool compresse le flux dans un fichier temporaire, relu depuis le debut,
+// et renvoie la taille du contenu et celle du contenu compresse
+func (b *CompressBackend) spool(stream io.ReadCloser) (*os.File, int64, int64, error) {
+	defer stream.Close()
+
+	// On cree le fichier temporaire
+	spool, err := os.CreateTemp(b.Config.TempDir, "gofs-compress-*")
+	if err != nil {
+		return nil, 0, 0, errors.New("unable to create temporary file : " + err.Error())
+	}
+
+	// On compresse le contenu
+	counter := &countingReader{Reader: stream}
+	compressor, err := newCompressWriter(spool, b.Config.Codec, b.Config.Level)
+	if err == nil {
+		_, err = io.Copy(compressor, counter)
+		if closeErr := compressor.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	var compressedSize int64
+	if err == nil {
+		compressedSize, err = spool.Seek(0, io.SeekCurrent)
+	}
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, 0, 0, err
+	}
+
+	return spool, counter.count, compressedSize, nil
+}
+
+func (b *CompressBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// Les metadonnees sont copiees avec le contenu
+	return b.next.Copy(ctx, filePathSrc, filePathDst)
+}
+
+func (b *CompressBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.next.Move(ctx, filePathSrc, filePathDst)
+}
+
+func (b *CompressBackend) Delete(ctx context.Context, filePath string) error {
+	return b.next.Delete(ctx, filePath)
+}
+
+func (b *CompressBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	// On recupere les metadonnees de compression du fichier
+	fInfo, err := b.next.Stat(ctx, filePath)
+	if err != nil {
+		return err
+	} else if fInfo.Metadata[META_CODEC] == "" {
+		return b.next.SetMetadata(ctx, filePath, metadata)
+	}
+
+	// On les conserve avec les nouvelles metadonnees
+	merged := make(map[string]string, len(metadata)+3)
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	for _, key := range []string{META_CODEC, META_SIZE, META_CONTENT_TYPE} {
+		if value, exists := fInfo.Metadata[key]; exists {
+			merged[key] = value
+		}
+	}
+
+	return b.next.SetMetadata(ctx, filePath, merged)
+}
+
+// ListExpired transmet la recherche des fichiers expires au backend decore
+func (b *CompressBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	return backend.ListExpired(ctx, b.next, path, now)
+}
+
+func logicalSize(metadata map[string]string) (int64, error) {
+	size, err := strconv.ParseInt(metadata[META_SIZE], 10, 64)
+	if err != nil || size < 0 {
+		return 0, errors.New("invalid uncompressed size")
+	}
+
+	return size, nil
+}
+
+// userMetadata renvoie les metadonnees sans celles de la compression
+func userMetadata(metadata map[string]string) map[string]string {
+	filtered := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if key != META_CODEC && key != META_SIZE && key != META_CONTENT_TYPE {
+			filtered[key] = value
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+
+	return filtered
+}
+
+type countingReader struct {
+	io.Reader
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
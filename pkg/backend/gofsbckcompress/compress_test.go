@@ -0,0 +1,102 @@
+package gofsbckcompress
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+// recordingBackend compte les operations transmises au backend local
+type recordingBackend struct {
+	*gofsbcklocal.LocalBackend
+	writes       int
+	setMetadatas int
+}
+
+func (b *recordingBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	b.writes++
+	return b.LocalBackend.WriteStream(ctx, filePath, stream, length, opts...)
+}
+
+func (b *recordingBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	b.setMetadatas++
+	return b.LocalBackend.SetMetadata(ctx, filePath, metadata)
+}
+
+func TestWriteStream(t *testing.T) {
+	ctx := context.Background()
+	data := bytes.Repeat([]byte("compressible content "), 1000)
+
+	tests := []struct {
+		name     string
+		codec    string
+		length   int64
+		filePath string
+		wantSize int64
+	}{
+		{"gzip known length", CODEC_GZIP, int64(len(data)), "file.txt", -1},
+		{"gzip unknown length", CODEC_GZIP, -1, "file.txt", -1},
+		{"zstd unknown length", CODEC_ZSTD, -1, "file.txt", -1},
+		{"already compressed", CODEC_GZIP, -1, "file.zip", int64(len(data))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, err := gofsbcklocal.New(gofsbcklocal.LocalConfig{BasePath: t.TempDir()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			next := &recordingBackend{LocalBackend: local}
+			b, err := New(next, CompressConfig{Codec: tt.codec})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err = b.WriteStream(ctx, tt.filePath, io.NopCloser(bytes.NewReader(data)), tt.length); err != nil {
+				t.Fatalf("write stream : %v", err)
+			}
+
+			// Le fichier et ses metadonnees sont ecrits en une seule operation
+			if next.writes != 1 || next.setMetadatas != 0 {
+				t.Errorf("writes, set metadatas = %d, %d, want 1, 0", next.writes, next.setMetadatas)
+			}
+
+			// Le contenu stocke est compresse, sauf s'il l'etait deja
+			storedInfo, err := next.Stat(ctx, tt.filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			wantSize := tt.wantSize
+			if wantSize < 0 {
+				if storedInfo.Size >= int64(len(data)) {
+					t.Errorf("stored size = %d, want less than %d", storedInfo.Size, len(data))
+				}
+				if storedInfo.Metadata[META_SIZE] != strconv.Itoa(len(data)) || storedInfo.Metadata[META_CODEC] != tt.codec {
+					t.Errorf("metadata = %v, want the codec and size", storedInfo.Metadata)
+				}
+			} else if storedInfo.Size != wantSize {
+				t.Errorf("stored size = %d, want %d", storedInfo.Size, wantSize)
+			}
+
+			// La lecture renvoie le contenu et la taille d'origine
+			got, err := b.Read(ctx, tt.filePath)
+			if err != nil {
+				t.Fatalf("read : %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("read %d bytes, want %d identical bytes", len(got), len(data))
+			}
+			fInfo, err := b.Stat(ctx, tt.filePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fInfo.Size != int64(len(data)) {
+				t.Errorf("stat size = %d, want %d", fInfo.Size, len(data))
+			}
+		})
+	}
+}
@@ -0,0 +1,414 @@
+package gofsbckcrypt
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// Metadonnees enregistrees avec chaque fichier chiffre
+	META_DATA_KEY   = "gofs-crypt-key"
+	META_KEY_ID     = "gofs-crypt-key-id"
+	META_CHUNK_SIZE = "gofs-crypt-chunk-size"
+
+	DEFAULT_CHUNK_SIZE = 64 * 1024
+)
+
+// ErrNotEncrypted est renvoyee lors de la lecture d'un fichier ecrit sans chiffrement
+var ErrNotEncrypted = errors.New("file is not encrypted")
+
+type CryptConfig struct {
+	// Cles maitres de 32 octets par identifiant, les anciennes cles restent necessaires a la lecture
+	MasterKeys map[string][]byte
+	// Identifiant de la cle maitre utilisee pour les ecritures et la rotation
+	ActiveKeyID string
+	// Taille des blocs chiffres, DEFAULT_CHUNK_SIZE si non renseignee
+	ChunkSize int
+	// Permet de lire les fichiers ecrits sans chiffrement, par exemple pendant une migration
+	AllowPlaintext bool
+	// Active les logs de debug de l'instance
+	Debug bool
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
+}
+
+// CryptBackend chiffre le contenu des fichiers avant de les transmettre au backend suivant,
+// qui ne voit jamais le contenu en clair
+type CryptBackend struct {
+	Config CryptConfig
+	next   backend.Backend
+	logger zerolog.Logger
+}
+
+// envelope decrit la cle de donnees d'un fichier chiffre
+type envelope struct {
+	keyID      string
+	wrappedKey string
+	chunkSize  int64
+}
+
+func New(next backend.Backend, config CryptConfig) (*CryptBackend, error) {
+	// On applique les valeurs par defaut
+	if config.ChunkSize == 0 {
+		config.ChunkSize = DEFAULT_CHUNK_SIZE
+	}
+
+	// On verifie la configuration
+	if next == nil {
+		return nil, errors.New("missing backend to encrypt")
+	}
+	if config.ChunkSize < 0 {
+		return nil, errors.New("invalid chunk size[" + strconv.Itoa(config.ChunkSize) + "]")
+	}
+	if _, exists := config.MasterKeys[config.ActiveKeyID]; !exists {
+		return nil, errors.New("unknown active master key[" + config.ActiveKeyID + "]")
+	}
+	for keyID, key := range config.MasterKeys {
+		if len(key) != KEY_SIZE {
+			return nil, errors.New("master key[" + keyID + "] must be " + strconv.Itoa(KEY_SIZE) + " bytes long")
+		}
+	}
+
+	// On initialise le logger
+	logger := backend.NewLogger(config.Logger, "crypt", config.Debug)
+
+	// On informe
+	logger.Debug().
+		Str("key_id", config.ActiveKeyID).
+		Int("chunk_size", config.ChunkSize).
+		Msg("Starting backend ...")
+
+	return &CryptBackend{
+		Config: config,
+		logger: logger,
+		next:   next,
+	}, nil
+}
+
+func (b *CryptBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	return b.next.List(ctx, path, recursive)
+}
+
+func (b *CryptBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	// On recupere les infos du fichier chiffre
+	fInfo, env, err := b.readEnvelope(ctx, filePath)
+	if err != nil || env == nil {
+		return fInfo, err
+	}
+
+	// On renvoie la taille en clair et les metadonnees de l'utilisateur
+	if fInfo.Size, err = plainSize(fInfo.Size, env.chunkSize); err != nil {
+		return fInfo, errors.New("file[" + filePath + "] " + err.Error())
+	}
+	fInfo.Metadata = userMetadata(fInfo.Metadata)
+
+	return fInfo, nil
+}
+
+func (b *CryptBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	// On utilise le stream afin de verifier chaque bloc
+	fileStream, err := b.ReadStream(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fileStream.Content.Close()
+
+	return io.ReadAll(fileStream.Content)
+}
+
+func (b *CryptBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	// On utilise la methode existante
+	data, err := b.Read(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// On converti en string
+	return string(data), err
+}
+
+func (b *CryptBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	// On initialise
+	fileStream := backend.FileStream{}
+	readOpts := backend.MergeReadOptions(opts)
+
+	// On recupere les infos du fichier chiffre
+	fInfo, env, err := b.readEnvelope(ctx, filePath)
+	if err != nil {
+		return fileStream, err
+	} else if env == nil {
+		return b.next.ReadStream(ctx, filePath, opts...)
+	}
+
+	// On calcule la partie en clair a renvoyer
+	size, err := plainSize(fInfo.Size, env.chunkSize)
+	if err != nil {
+		return fileStream, errors.New("file[" + filePath + "] " + err.Error())
+	}
+	if readOpts.Offset > size {
+		return fileStream, errors.New("read offset is beyond the end of file")
+	}
+	fileStream.ContentType = fInfo.ContentType
+	fileStream.Size = size - readOpts.Offset
+	if readOpts.Length > 0 && readOpts.Length < fileStream.Size {
+		fileStream.Size = readOpts.Length
+	}
+
+	// Si l'on a rien a lire
+	if fileStream.Size == 0 {
+		fileStream.Content = io.NopCloser(bytes.NewReader(nil))
+		return fileStream, nil
+	}
+
+	// On recupere la cle de donnees
+	aead, err := b.openEnvelope(env)
+	if err != nil {
+		return fileStream, err
+	}
+
+	// On ne lit que les blocs chiffres necessaires
+	stride := env.chunkSize + TAG_SIZE
+	firstChunk := readOpts.Offset / env.chunkSize
+	lastChunk := (readOpts.Offset + fileStream.Size - 1) / env.chunkSize
+	cipherOffset := firstChunk * stride
+	cipherLength := (lastChunk - firstChunk + 1) * stride
+	if cipherOffset+cipherLength > fInfo.Size {
+		cipherLength = fInfo.Size - cipherOffset
+	}
+	cipherStream, err := b.next.ReadStream(ctx, filePath, backend.ReadOptions{Offset: cipherOffset, Length: cipherLength})
+	if err != nil {
+		return fileStream, err
+	}
+
+	// On dechiffre a la volee
+	fileStream.Content = newDecryptReader(
+		aead,
+		cipherStream.Content,
+		env.chunkSize,
+		firstChunk,
+		chunkCount(fInfo.Size, env.chunkSize)-1,
+		readOpts.Offset-firstChunk*env.chunkSize,
+		fileStream.Size,
+	)
+
+	return fileStream, nil
+}
+
+func (b *CryptBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	// On utilise le stream
+	return b.WriteStream(ctx, filePath, io.NopCloser(bytes.NewReader(data)), int64(len(data)), opts...)
+}
+
+func (b *CryptBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	// On utilise la methode existante
+	return b.Write(ctx, filePath, []byte(content), opts...)
+}
+
+func (b *CryptBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	// On genere une cle de donnees propre au fichier
+	dataKey, err := newDataKey()
+	if err != nil {
+		return err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+	env := envelope{
+		keyID:     b.Config.ActiveKeyID,
+		chunkSize: int64(b.Config.ChunkSize),
+	}
+	if env.wrappedKey, err = wrapKey(b.Config.MasterKeys[env.keyID], env.keyID, dataKey); err != nil {
+		return errors.New("unable to wrap data key : " + err.Error())
+	}
+
+	// On ajoute la cle chiffree aux metadonnees
+	writeOpts := backend.MergeWriteOptions(opts)
+	writeOpts.Metadata = env.addTo(writeOpts.Metadata)
+
+	// On calcule la taille chiffree si elle est connue
+	cipherLength := int64(-1)
+	if length >= 0 {
+		cipherLength = cipherSize(length, env.chunkSize)
+	}
+
+	// On chiffre a la volee
+	return b.next.WriteStream(ctx, filePath, newEncryptReader(aead, stream, env.chunkSize), cipherLength, writeOpts)
+}
+
+func (b *CryptBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// Les metadonnees sont copiees avec le contenu, la cle de donnees reste donc valide
+	return b.next.Copy(ctx, filePathSrc, filePathDst)
+}
+
+func (b *CryptBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.next.Move(ctx, filePathSrc, filePathDst)
+}
+
+func (b *CryptBackend) Delete(ctx context.Context, filePath string) error {
+	return b.next.Delete(ctx, filePath)
+}
+
+func (b *CryptBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	// On recupere la cle de donnees du fichier
+	_, env, err := b.readEnvelope(ctx, filePath)
+	if err != nil {
+		return err
+	} else if env == nil {
+		return b.next.SetMetadata(ctx, filePath, metadata)
+	}
+
+	// On la conserve avec les nouvelles metadonnees
+	return b.next.SetMetadata(ctx, filePath, env.addTo(metadata))
+}
+
+// ListExpired transmet la recherche des fichiers expires au backend decore
+func (b *CryptBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	return backend.ListExpired(ctx, b.next, path, now)
+}
+
+// Rotate chiffre a nouveau la cle de donnees du fichier avec la cle maitre active, sans reecrire le contenu.
+// Elle renvoie true si la cle a ete modifiee
+func (b *CryptBackend) Rotate(ctx context.Context, filePath string) (bool, error) {
+	// On recupere la cle de donnees du fichier
+	fInfo, env, err := b.readEnvelope(ctx, filePath)
+	if err != nil {
+		return false, err
+	} else if env == nil {
+		return false, errors.New("unable to rotate file[" + filePath + "] : " + ErrNotEncrypted.Error())
+	}
+
+	// Si elle utilise deja la cle active
+	if env.keyID == b.Config.ActiveKeyID {
+		return false, nil
+	}
+
+	// On la dechiffre puis la chiffre avec la cle active
+	dataKey, err := b.unwrapDataKey(env)
+	if err != nil {
+		return false, err
+	}
+	env.keyID = b.Config.ActiveKeyID
+	if env.wrappedKey, err = wrapKey(b.Config.MasterKeys[env.keyID], env.keyID, dataKey); err != nil {
+		return false, errors.New("unable to wrap data key : " + err.Error())
+	}
+
+	// On remplace uniquement les metadonnees
+	if err = b.next.SetMetadata(ctx, filePath, env.addTo(userMetadata(fInfo.Metadata))); err != nil {
+		return false, err
+	}
+
+	b.logger.Debug().
+		Str("op", "Rotate").
+		Str("path", filePath).
+		Str("key_id", env.keyID).
+		Send()
+
+	return true, nil
+}
+
+// RotateAll applique Rotate a tous les fichiers du dossier et renvoie le nombre de cles modifiees
+func (b *CryptBackend) RotateAll(ctx context.Context, path string) (int, error) {
+	// On liste tous les fichiers
+	files, err := b.next.List(ctx, path, true)
+	if err != nil {
+		return 0, err
+	}
+
+	// On les passe un par un
+	rotated := 0
+	for _, file := range files {
+		done, err := b.Rotate(ctx, path+file)
+		if err != nil {
+			return rotated, err
+		}
+		if done {
+			rotated++
+		}
+	}
+
+	return rotated, nil
+}
+
+// readEnvelope renvoie les infos du fichier chiffre ainsi que son enveloppe,
+// qui est nil si le fichier n'est pas chiffre et que c'est autorise
+func (b *CryptBackend) readEnvelope(ctx context.Context, filePath string) (backend.FileInfo, *envelope, error) {
+	// On recupere les infos
+	fInfo, err := b.next.Stat(ctx, filePath)
+	if err != nil {
+		return fInfo, nil, err
+	}
+
+	// Si le fichier n'est pas chiffre
+	if fInfo.Metadata[META_DATA_KEY] == "" {
+		if b.Config.AllowPlaintext {
+			return fInfo, nil, nil
+		}
+		return fInfo, nil, errors.New("file[" + filePath + "] " + ErrNotEncrypted.Error())
+	}
+
+	// On lit l'enveloppe
+	env := envelope{
+		keyID:      fInfo.Metadata[META_KEY_ID],
+		wrappedKey: fInfo.Metadata[META_DATA_KEY],
+	}
+	if env.chunkSize, err = strconv.ParseInt(fInfo.Metadata[META_CHUNK_SIZE], 10, 64); err != nil || env.chunkSize <= 0 {
+		return fInfo, nil, errors.New("invalid chunk size for file[" + filePath + "]")
+	}
+
+	return fInfo, &env, nil
+}
+
+func (b *CryptBackend) unwrapDataKey(env *envelope) ([]byte, error) {
+	masterKey, exists := b.Config.MasterKeys[env.keyID]
+	if !exists {
+		return nil, errors.New("unknown master key[" + env.keyID + "]")
+	}
+
+	return unwrapKey(masterKey, env.keyID, env.wrappedKey)
+}
+
+func (b *CryptBackend) openEnvelope(env *envelope) (cipher.AEAD, error) {
+	dataKey, err := b.unwrapDataKey(env)
+	if err != nil {
+		return nil, err
+	}
+
+	return newAEAD(dataKey)
+}
+
+// addTo renvoie une copie des metadonnees avec celles de l'enveloppe
+func (env envelope) addTo(metadata map[string]string) map[string]string {
+	merged := make(map[string]string, len(metadata)+3)
+	for key, value := range metadata {
+		merged[key] = value
+	}
+	merged[META_DATA_KEY] = env.wrappedKey
+	merged[META_KEY_ID] = env.keyID
+	merged[META_CHUNK_SIZE] = strconv.FormatInt(env.chunkSize, 10)
+
+	return merged
+}
+
+// userMetadata renvoie les metadonnees sans celles de l'enveloppe
+func userMetadata(metadata map[string]string) map[string]string {
+	filtered := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		if key != META_DATA_KEY && key != META_KEY_ID && key != META_CHUNK_SIZE {
+			filtered[key] = value
+		}
+	}
+	if len(filtered) == 0 {
+		return nil
+	}
+
+	return filtered
+}
@@ -0,0 +1,263 @@
+package gofsbckcrypt
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+const TEST_CHUNK_SIZE = 16
+
+var (
+	testKey1 = bytes.Repeat([]byte{1}, KEY_SIZE)
+	testKey2 = bytes.Repeat([]byte{2}, KEY_SIZE)
+)
+
+// newTestBackend chiffre un backend local dans un dossier temporaire
+func newTestBackend(t *testing.T, basePath string, keys map[string][]byte, activeKeyID string) *CryptBackend {
+	t.Helper()
+	local, err := gofsbcklocal.New(gofsbcklocal.LocalConfig{BasePath: basePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(local, CryptConfig{MasterKeys: keys, ActiveKeyID: activeKeyID, ChunkSize: TEST_CHUNK_SIZE})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// testData renvoie un contenu de la taille demandee, different a chaque octet
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+
+	return data
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	b := newTestBackend(t, basePath, map[string][]byte{"k1": testKey1}, "k1")
+
+	tests := []struct {
+		name   string
+		size   int
+		stream bool
+	}{
+		{"empty", 0, false},
+		{"one byte", 1, false},
+		{"partial chunk", TEST_CHUNK_SIZE - 1, false},
+		{"exact chunk", TEST_CHUNK_SIZE, false},
+		{"chunk and one byte", TEST_CHUNK_SIZE + 1, false},
+		{"several chunks", 10*TEST_CHUNK_SIZE + 3, false},
+		{"stream exact chunks", 4 * TEST_CHUNK_SIZE, true},
+		{"stream several chunks", 10*TEST_CHUNK_SIZE + 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := testData(tt.size)
+			var err error
+			if tt.stream {
+				err = b.WriteStream(ctx, "file", io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+			} else {
+				err = b.Write(ctx, "file", data)
+			}
+			if err != nil {
+				t.Fatalf("write : %v", err)
+			}
+
+			// Le backend suivant ne voit pas le contenu en clair, les contenus trop courts pouvant apparaitre par hasard
+			raw, err := os.ReadFile(filepath.Join(basePath, "file"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(data) >= TEST_CHUNK_SIZE && bytes.Contains(raw, data[:TEST_CHUNK_SIZE]) {
+				t.Error("stored content is not encrypted")
+			}
+			if int64(len(raw)) != cipherSize(int64(len(data)), TEST_CHUNK_SIZE) {
+				t.Errorf("stored size = %d, want %d", len(raw), cipherSize(int64(len(data)), TEST_CHUNK_SIZE))
+			}
+
+			// On relit le contenu et sa taille en clair
+			got, err := b.Read(ctx, "file")
+			if err != nil {
+				t.Fatalf("read : %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("read %d bytes, want %d identical bytes", len(got), len(data))
+			}
+			fInfo, err := b.Stat(ctx, "file")
+			if err != nil {
+				t.Fatalf("stat : %v", err)
+			}
+			if fInfo.Size != int64(len(data)) {
+				t.Errorf("stat size = %d, want %d", fInfo.Size, len(data))
+			}
+		})
+	}
+}
+
+func TestRangeRead(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t, t.TempDir(), map[string][]byte{"k1": testKey1}, "k1")
+	data := testData(5*TEST_CHUNK_SIZE + 7)
+	if err := b.Write(ctx, "file", data); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		offset int64
+		length int64
+		want   []byte
+	}{
+		{"whole file", 0, 0, data},
+		{"inside first chunk", 2, 5, data[2:7]},
+		{"across chunks", TEST_CHUNK_SIZE - 3, 10, data[TEST_CHUNK_SIZE-3 : TEST_CHUNK_SIZE+7]},
+		{"exact chunk", TEST_CHUNK_SIZE, TEST_CHUNK_SIZE, data[TEST_CHUNK_SIZE : 2*TEST_CHUNK_SIZE]},
+		{"until end", 3*TEST_CHUNK_SIZE + 1, 0, data[3*TEST_CHUNK_SIZE+1:]},
+		{"final partial chunk", int64(len(data)) - 2, 2, data[len(data)-2:]},
+		{"length beyond end", int64(len(data)) - 4, 100, data[len(data)-4:]},
+		{"offset at end", int64(len(data)), 0, []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileStream, err := b.ReadStream(ctx, "file", backend.ReadOptions{Offset: tt.offset, Length: tt.length})
+			if err != nil {
+				t.Fatalf("read stream : %v", err)
+			}
+			defer fileStream.Content.Close()
+			got, err := io.ReadAll(fileStream.Content)
+			if err != nil {
+				t.Fatalf("read content : %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("read %v, want %v", got, tt.want)
+			}
+			if fileStream.Size != int64(len(tt.want)) {
+				t.Errorf("stream size = %d, want %d", fileStream.Size, len(tt.want))
+			}
+		})
+	}
+
+	// Une lecture au dela de la fin est refusee
+	if _, err := b.ReadStream(ctx, "file", backend.ReadOptions{Offset: int64(len(data)) + 1}); err == nil {
+		t.Error("read beyond the end of file succeeded")
+	}
+}
+
+func TestTamperDetection(t *testing.T) {
+	ctx := context.Background()
+	stride := TEST_CHUNK_SIZE + TAG_SIZE
+
+	tests := []struct {
+		name   string
+		tamper func(raw []byte) []byte
+	}{
+		{"flipped byte in first chunk", func(raw []byte) []byte {
+			raw[0] ^= 0xff
+			return raw
+		}},
+		{"flipped byte in last chunk", func(raw []byte) []byte {
+			raw[len(raw)-1] ^= 0xff
+			return raw
+		}},
+		{"dropped last chunk", func(raw []byte) []byte {
+			return raw[:2*stride]
+		}},
+		{"swapped chunks", func(raw []byte) []byte {
+			swapped := append([]byte{}, raw[stride:2*stride]...)
+			swapped = append(swapped, raw[:stride]...)
+			return append(swapped, raw[2*stride:]...)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basePath := t.TempDir()
+			b := newTestBackend(t, basePath, map[string][]byte{"k1": testKey1}, "k1")
+			if err := b.Write(ctx, "file", testData(2*TEST_CHUNK_SIZE+5)); err != nil {
+				t.Fatal(err)
+			}
+
+			// On modifie le contenu chiffre sans passer par le backend
+			rawPath := filepath.Join(basePath, "file")
+			raw, err := os.ReadFile(rawPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.WriteFile(rawPath, tt.tamper(raw), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err = b.Read(ctx, "file"); !errors.Is(err, ErrAuthentication) {
+				t.Errorf("read error = %v, want %v", err, ErrAuthentication)
+			}
+		})
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	data := testData(3*TEST_CHUNK_SIZE + 1)
+
+	// On ecrit avec la premiere cle
+	old := newTestBackend(t, basePath, map[string][]byte{"k1": testKey1}, "k1")
+	if err := old.Write(ctx, "file", data, backend.WriteOptions{Metadata: map[string]string{"owner": "test"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// On active la seconde, la premiere restant disponible pour la lecture
+	b := newTestBackend(t, basePath, map[string][]byte{"k1": testKey1, "k2": testKey2}, "k2")
+	tests := []struct {
+		name        string
+		wantRotated bool
+	}{
+		{"old key", true},
+		{"already active key", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rotated, err := b.Rotate(ctx, "file")
+			if err != nil {
+				t.Fatalf("rotate : %v", err)
+			}
+			if rotated != tt.wantRotated {
+				t.Errorf("rotated = %v, want %v", rotated, tt.wantRotated)
+			}
+		})
+	}
+
+	// La premiere cle n'est plus necessaire, le contenu et les metadonnees sont conserves
+	current := newTestBackend(t, basePath, map[string][]byte{"k2": testKey2}, "k2")
+	got, err := current.Read(ctx, "file")
+	if err != nil {
+		t.Fatalf("read after rotation : %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("content changed after rotation")
+	}
+	fInfo, err := current.Stat(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fInfo.Metadata["owner"] != "test" {
+		t.Errorf("metadata = %v, want owner kept", fInfo.Metadata)
+	}
+
+	// L'ancienne cle seule ne permet plus de lire
+	if _, err = old.Read(ctx, "file"); err == nil {
+		t.Error("read with the retired key succeeded")
+	}
+}
@@ -0,0 +1,71 @@
+package gofsbckcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+)
+
+// KEY_SIZE est la taille des cles maitres et des cles de donnees (AES-256)
+const KEY_SIZE = 32
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// newDataKey genere une cle de donnees aleatoire, unique pour chaque fichier
+func newDataKey() ([]byte, error) {
+	dataKey := make([]byte, KEY_SIZE)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, errors.New("unable to generate data key : " + err.Error())
+	}
+
+	return dataKey, nil
+}
+
+// wrapKey chiffre la cle de donnees avec la cle maitre, l'identifiant de la cle maitre etant authentifie
+func wrapKey(masterKey []byte, masterKeyID string, dataKey []byte) (string, error) {
+	// On initialise
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", errors.New("unable to generate nonce : " + err.Error())
+	}
+
+	// On chiffre la cle a la suite du nonce
+	wrapped := aead.Seal(nonce, nonce, dataKey, []byte(masterKeyID))
+
+	return base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// unwrapKey dechiffre une cle de donnees produite par wrapKey
+func unwrapKey(masterKey []byte, masterKeyID string, wrappedKey string) ([]byte, error) {
+	// On initialise
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(wrappedKey)
+	if err != nil || len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("invalid wrapped data key")
+	}
+
+	// On dechiffre la cle
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(masterKeyID))
+	if err != nil {
+		return nil, errors.New("unable to unwrap data key with master key[" + masterKeyID + "]")
+	}
+
+	return dataKey, nil
+}
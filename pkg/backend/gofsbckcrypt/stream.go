@@ -0,0 +1,204 @@
+package gofsbckcrypt
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Chaque bloc de contenu est chiffre separement avec AES-GCM, ce qui ajoute TAG_SIZE octets par bloc.
+// Le nonce est derive de l'index du bloc (la cle de donnees est unique par fichier),
+// et l'index ainsi qu'un indicateur de dernier bloc sont authentifies pour detecter les troncatures
+const TAG_SIZE = 16
+
+// ErrAuthentication est renvoyee lorsqu'un bloc chiffre a ete modifie ou tronque
+var ErrAuthentication = errors.New("encrypted content authentication failed")
+
+func chunkNonce(index int64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(index))
+	return nonce
+}
+
+func chunkAAD(index int64, final bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, uint64(index))
+	if final {
+		aad[8] = 1
+	}
+	return aad
+}
+
+// cipherSize renvoie la taille chiffree d'un contenu, un contenu vide occupant un bloc vide
+func cipherSize(plainSize int64, chunkSize int64) int64 {
+	if plainSize == 0 {
+		return TAG_SIZE
+	}
+	chunks := (plainSize + chunkSize - 1) / chunkSize
+	return plainSize + chunks*TAG_SIZE
+}
+
+// plainSize renvoie la taille en clair d'un contenu chiffre
+func plainSize(cipherSize int64, chunkSize int64) (int64, error) {
+	fullChunks := cipherSize / (chunkSize + TAG_SIZE)
+	rest := cipherSize % (chunkSize + TAG_SIZE)
+	if rest == 0 && fullChunks > 0 {
+		return fullChunks * chunkSize, nil
+	} else if rest < TAG_SIZE {
+		return 0, errors.New("invalid encrypted content size")
+	}
+	return fullChunks*chunkSize + rest - TAG_SIZE, nil
+}
+
+// chunkCount renvoie le nombre de blocs d'un contenu chiffre
+func chunkCount(cipherSize int64, chunkSize int64) int64 {
+	return (cipherSize + chunkSize + TAG_SIZE - 1) / (chunkSize + TAG_SIZE)
+}
+
+// encryptReader chiffre a la volee le contenu lu depuis src
+type encryptReader struct {
+	aead   cipher.AEAD
+	src    *bufio.Reader
+	closer io.Closer
+	plain  []byte
+	out    []byte
+	index  int64
+	done   bool
+}
+
+func newEncryptReader(aead cipher.AEAD, src io.ReadCloser, chunkSize int64) *encryptReader {
+	return &encryptReader{
+		aead:   aead,
+		src:    bufio.NewReader(src),
+		closer: src,
+		plain:  make([]byte, chunkSize),
+	}
+}
+
+func (r *encryptReader) Read(p []byte) (int, error) {
+	// Si l'on a plus rien en attente, on chiffre le bloc suivant
+	if len(r.out) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.sealNextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	// On renvoie ce que l'on peut
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *encryptReader) sealNextChunk() error {
+	// On lit un bloc complet
+	n, err := io.ReadFull(r.src, r.plain)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// Si le bloc est complet, on regarde s'il reste du contenu
+	final := err != nil
+	if !final {
+		if _, err := r.src.Peek(1); err == io.EOF {
+			final = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	// On chiffre le bloc
+	r.out = r.aead.Seal(r.out[:0], chunkNonce(r.index), r.plain[:n], chunkAAD(r.index, final))
+	r.index++
+	r.done = final
+
+	return nil
+}
+
+func (r *encryptReader) Close() error {
+	return r.closer.Close()
+}
+
+// decryptReader dechiffre a la volee des blocs lus depuis src, a partir du bloc first
+type decryptReader struct {
+	aead      cipher.AEAD
+	src       io.ReadCloser
+	chunk     []byte
+	out       []byte
+	index     int64
+	lastIndex int64
+	skip      int64
+	remaining int64
+}
+
+func newDecryptReader(aead cipher.AEAD, src io.ReadCloser, chunkSize int64, first int64, lastIndex int64, skip int64, length int64) *decryptReader {
+	return &decryptReader{
+		aead:      aead,
+		src:       src,
+		chunk:     make([]byte, chunkSize+TAG_SIZE),
+		index:     first,
+		lastIndex: lastIndex,
+		skip:      skip,
+		remaining: length,
+	}
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	// Si l'on a tout renvoye
+	if r.remaining <= 0 {
+		return 0, io.EOF
+	}
+
+	// Si l'on a plus rien en attente, on dechiffre le bloc suivant
+	for len(r.out) == 0 {
+		if err := r.openNextChunk(); err != nil {
+			return 0, err
+		}
+	}
+
+	// On renvoie ce que l'on peut
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+func (r *decryptReader) openNextChunk() error {
+	// On lit un bloc chiffre complet
+	if r.index > r.lastIndex {
+		return io.ErrUnexpectedEOF
+	}
+	n, err := io.ReadFull(r.src, r.chunk)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	// On le dechiffre
+	plain, err := r.aead.Open(r.chunk[:0], chunkNonce(r.index), r.chunk[:n], chunkAAD(r.index, r.index == r.lastIndex))
+	if err != nil {
+		return ErrAuthentication
+	}
+	r.index++
+
+	// On ignore le debut du premier bloc si la lecture commence au milieu
+	if r.skip > 0 {
+		plain = plain[r.skip:]
+		r.skip = 0
+	}
+	r.out = plain
+
+	return nil
+}
+
+func (r *decryptReader) Close() error {
+	return r.src.Close()
+}
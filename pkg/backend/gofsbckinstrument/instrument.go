@@ -0,0 +1,235 @@
+package gofsbckinstrument
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const TRACER_NAME = "github.com/craimbault/go-fs"
+
+type InstrumentConfig struct {
+	// Type du backend, utilise comme label des metriques et attribut des spans
+	BackendType string
+	// Registry recevant les metriques, DefaultRegistry par defaut
+	Registry *Registry
+	// Fournisseur des spans OpenTelemetry, celui global par defaut
+	TracerProvider trace.TracerProvider
+	// Indique si un appel doit etre trace, tous le sont par defaut (voir RatioSampler)
+	Sampler func(operation string, path string) bool
+}
+
+// InstrumentBackend mesure chaque appel au backend suivant et l'entoure d'un span OpenTelemetry
+type InstrumentBackend struct {
+	Config InstrumentConfig
+	next   backend.Backend
+	tracer trace.Tracer
+}
+
+// RatioSampler trace la proportion d'appels indiquee, entre 0 et 1
+func RatioSampler(ratio float64) func(operation string, path string) bool {
+	return func(operation string, path string) bool {
+		return rand.Float64() < ratio
+	}
+}
+
+func New(next backend.Backend, config InstrumentConfig) (*InstrumentBackend, error) {
+	// On applique les valeurs par defaut
+	if config.Registry == nil {
+		config.Registry = DefaultRegistry
+	}
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+
+	// On verifie la configuration
+	if next == nil {
+		return nil, errors.New("missing backend to instrument")
+	}
+	if config.BackendType == "" {
+		return nil, errors.New("missing backend type")
+	}
+
+	return &InstrumentBackend{
+		Config: config,
+		next:   next,
+		tracer: config.TracerProvider.Tracer(TRACER_NAME),
+	}, nil
+}
+
+func (b *InstrumentBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	var files []string
+	err := b.instrument(ctx, "List", path, "", func(ctx context.Context, span trace.Span) (err error) {
+		files, err = b.next.List(ctx, path, recursive)
+		span.SetAttributes(attribute.Bool("gofs.recursive", recursive), attribute.Int("gofs.files", len(files)))
+		return err
+	})
+
+	return files, err
+}
+
+func (b *InstrumentBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	var fInfo backend.FileInfo
+	err := b.instrument(ctx, "Stat", filePath, "", func(ctx context.Context, span trace.Span) (err error) {
+		fInfo, err = b.next.Stat(ctx, filePath)
+		return err
+	})
+
+	return fInfo, err
+}
+
+func (b *InstrumentBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	var data []byte
+	err := b.instrument(ctx, "Read", filePath, "", func(ctx context.Context, span trace.Span) (err error) {
+		data, err = b.next.Read(ctx, filePath)
+		b.addBytes(span, "Read", int64(len(data)), 0)
+		return err
+	})
+
+	return data, err
+}
+
+func (b *InstrumentBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	// On utilise la methode existante
+	data, err := b.Read(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// On converti en string
+	return string(data), err
+}
+
+func (b *InstrumentBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	// Le span couvre l'ouverture du stream, les octets sont comptes au fur et a mesure de la lecture
+	var fileStream backend.FileStream
+	err := b.instrument(ctx, "ReadStream", filePath, "", func(ctx context.Context, span trace.Span) (err error) {
+		fileStream, err = b.next.ReadStream(ctx, filePath, opts...)
+		if err == nil {
+			span.SetAttributes(attribute.Int64("gofs.size", fileStream.Size))
+			fileStream.Content = &countingReadCloser{ReadCloser: fileStream.Content, add: func(n int64) {
+				b.Config.Registry.addBytes(b.Config.BackendType, "ReadStream", n, 0)
+			}}
+		}
+		return err
+	})
+
+	return fileStream, err
+}
+
+func (b *InstrumentBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	return b.instrument(ctx, "Write", filePath, "", func(ctx context.Context, span trace.Span) error {
+		err := b.next.Write(ctx, filePath, data, opts...)
+		if err == nil {
+			b.addBytes(span, "Write", 0, int64(len(data)))
+		}
+		return err
+	})
+}
+
+func (b *InstrumentBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	// On utilise la methode existante
+	return b.Write(ctx, filePath, []byte(content), opts...)
+}
+
+func (b *InstrumentBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	return b.instrument(ctx, "WriteStream", filePath, "", func(ctx context.Context, span trace.Span) error {
+		// On compte les octets transmis au backend
+		var written int64
+		counter := &countingReadCloser{ReadCloser: stream, add: func(n int64) { written += n }}
+		err := b.next.WriteStream(ctx, filePath, counter, length, opts...)
+		b.addBytes(span, "WriteStream", 0, written)
+		return err
+	})
+}
+
+func (b *InstrumentBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.instrument(ctx, "Copy", filePathSrc, filePathDst, func(ctx context.Context, span trace.Span) error {
+		return b.next.Copy(ctx, filePathSrc, filePathDst)
+	})
+}
+
+func (b *InstrumentBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.instrument(ctx, "Move", filePathSrc, filePathDst, func(ctx context.Context, span trace.Span) error {
+		return b.next.Move(ctx, filePathSrc, filePathDst)
+	})
+}
+
+func (b *InstrumentBackend) Delete(ctx context.Context, filePath string) error {
+	return b.instrument(ctx, "Delete", filePath, "", func(ctx context.Context, span trace.Span) error {
+		return b.next.Delete(ctx, filePath)
+	})
+}
+
+func (b *InstrumentBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	return b.instrument(ctx, "SetMetadata", filePath, "", func(ctx context.Context, span trace.Span) error {
+		return b.next.SetMetadata(ctx, filePath, metadata)
+	})
+}
+
+// ListExpired transmet la recherche des fichiers expires au backend decore
+func (b *InstrumentBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	var files []string
+	err := b.instrument(ctx, "ListExpired", path, "", func(ctx context.Context, span trace.Span) (err error) {
+		files, err = backend.ListExpired(ctx, b.next, path, now)
+		span.SetAttributes(attribute.Int("gofs.files", len(files)))
+		return err
+	})
+
+	return files, err
+}
+
+// instrument mesure l'appel et l'entoure d'un span si l'echantillonnage le permet
+func (b *InstrumentBackend) instrument(ctx context.Context, operation string, path string, dstPath string, call func(ctx context.Context, span trace.Span) error) error {
+	// On cree le span
+	span := trace.SpanFromContext(context.Background())
+	if b.Config.Sampler == nil || b.Config.Sampler(operation, path) {
+		ctx, span = b.tracer.Start(ctx, "gofs."+operation, trace.WithAttributes(
+			attribute.String("gofs.backend", b.Config.BackendType),
+			attribute.String("gofs.path", path),
+		))
+		if dstPath != "" {
+			span.SetAttributes(attribute.String("gofs.path_dst", dstPath))
+		}
+	}
+	defer span.End()
+
+	// On appelle le backend
+	start := time.Now()
+	err := call(ctx, span)
+	b.Config.Registry.observe(b.Config.BackendType, operation, time.Since(start), err)
+
+	// On indique l'erreur dans le span
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return err
+}
+
+func (b *InstrumentBackend) addBytes(span trace.Span, operation string, read int64, written int64) {
+	b.Config.Registry.addBytes(b.Config.BackendType, operation, read, written)
+	span.SetAttributes(attribute.Int64("gofs.bytes", read+written))
+}
+
+type countingReadCloser struct {
+	io.ReadCloser
+	add func(n int64)
+}
+
+func (r *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,165 @@
+package gofsbckinstrument
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DEFAULT_BUCKETS sont les bornes en secondes de l'histogramme des durees
+var DEFAULT_BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60}
+
+// DefaultRegistry est utilise par les backends dont la configuration ne precise pas de Registry
+var DefaultRegistry = NewRegistry()
+
+// Registry conserve les metriques de un ou plusieurs backends et les expose au format texte de Prometheus
+type Registry struct {
+	mu      sync.Mutex
+	buckets []float64
+	series  map[seriesKey]*series
+}
+
+type seriesKey struct {
+	backend   string
+	operation string
+}
+
+type series struct {
+	count        uint64
+	errors       uint64
+	bytesRead    uint64
+	bytesWritten uint64
+	durationSum  float64
+	bucketCounts []uint64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		buckets: DEFAULT_BUCKETS,
+		series:  make(map[seriesKey]*series),
+	}
+}
+
+// observe enregistre un appel termine
+func (r *Registry) observe(backendType string, operation string, duration time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.get(backendType, operation)
+	s.count++
+	if err != nil {
+		s.errors++
+	}
+	seconds := duration.Seconds()
+	s.durationSum += seconds
+	for i, bound := range r.buckets {
+		if seconds <= bound {
+			s.bucketCounts[i]++
+		}
+	}
+}
+
+// addBytes ajoute des octets lus depuis ou ecrits vers le backend
+func (r *Registry) addBytes(backendType string, operation string, read int64, written int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := r.get(backendType, operation)
+	s.bytesRead += uint64(read)
+	s.bytesWritten += uint64(written)
+}
+
+func (r *Registry) get(backendType string, operation string) *series {
+	key := seriesKey{backend: backendType, operation: operation}
+	s, exists := r.series[key]
+	if !exists {
+		s = &series{bucketCounts: make([]uint64, len(r.buckets))}
+		r.series[key] = s
+	}
+
+	return s
+}
+
+// WritePrometheus ecrit toutes les metriques au format texte de Prometheus
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// On trie les series pour avoir une sortie stable
+	keys := make([]seriesKey, 0, len(r.series))
+	for key := range r.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].backend != keys[j].backend {
+			return keys[i].backend < keys[j].backend
+		}
+		return keys[i].operation < keys[j].operation
+	})
+
+	// On ecrit les compteurs
+	bw := bufio.NewWriter(w)
+	counters := []struct {
+		name  string
+		help  string
+		value func(s *series) uint64
+	}{
+		{"gofs_operations_total", "Number of backend operations.", func(s *series) uint64 { return s.count }},
+		{"gofs_operation_errors_total", "Number of backend operations that returned an error.", func(s *series) uint64 { return s.errors }},
+		{"gofs_read_bytes_total", "Number of bytes read from the backend.", func(s *series) uint64 { return s.bytesRead }},
+		{"gofs_written_bytes_total", "Number of bytes written to the backend.", func(s *series) uint64 { return s.bytesWritten }},
+	}
+	for _, counter := range counters {
+		bw.WriteString("# HELP " + counter.name + " " + counter.help + "\n")
+		bw.WriteString("# TYPE " + counter.name + " counter\n")
+		for _, key := range keys {
+			bw.WriteString(counter.name + labels(key, "") + " " + strconv.FormatUint(counter.value(r.series[key]), 10) + "\n")
+		}
+	}
+
+	// On ecrit l'histogramme des durees, dont les buckets sont cumulatifs
+	name := "gofs_operation_duration_seconds"
+	bw.WriteString("# HELP " + name + " Duration of backend operations.\n")
+	bw.WriteString("# TYPE " + name + " histogram\n")
+	for _, key := range keys {
+		s := r.series[key]
+		for i, bound := range r.buckets {
+			bw.WriteString(name + "_bucket" + labels(key, formatFloat(bound)) + " " + strconv.FormatUint(s.bucketCounts[i], 10) + "\n")
+		}
+		bw.WriteString(name + "_bucket" + labels(key, "+Inf") + " " + strconv.FormatUint(s.count, 10) + "\n")
+		bw.WriteString(name + "_sum" + labels(key, "") + " " + formatFloat(s.durationSum) + "\n")
+		bw.WriteString(name + "_count" + labels(key, "") + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+
+	return bw.Flush()
+}
+
+// Handler renvoie un handler HTTP exposant les metriques, a monter par exemple sur /metrics
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+func labels(key seriesKey, le string) string {
+	result := `{backend="` + escapeLabel(key.backend) + `",operation="` + escapeLabel(key.operation) + `"`
+	if le != "" {
+		result += `,le="` + le + `"`
+	}
+
+	return result + "}"
+}
+
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,80 @@
+package gofsbcklocal
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// isExpired indique si le fichier a expire, d'apres son fichier annexe
+func (b *LocalBackend) isExpired(filePath string) bool {
+	meta, err := b.readMeta(filePath)
+	return err == nil && meta.ExpiresAt != nil && backend.IsExpired(*meta.ExpiresAt, time.Now())
+}
+
+// withoutExpired retire les fichiers expires d'un listing, dont les chemins sont relatifs au dossier liste
+func (b *LocalBackend) withoutExpired(dirPath string, files []string) []string {
+	visible := make([]string, 0, len(files))
+	for _, file := range files {
+		if !b.isExpired(dirPath + file) {
+			visible = append(visible, file)
+		}
+	}
+
+	return visible
+}
+
+// ListExpired parcourt les fichiers annexes, seuls les fichiers ayant une expiration en ayant un
+func (b *LocalBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	// On initialise
+	metaFolder := filepath.Join(b.Config.BasePath, META_FOLDER, "meta")
+	files := make([]string, 0)
+
+	b.logger.Debug().
+		Str("op", "ListExpired").
+		Str("path", addPrefixedPath(b, path)).
+		Send()
+
+	// On parcours les fichiers annexes
+	err := filepath.Walk(metaFolder, func(currentPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if info.IsDir() || !strings.HasSuffix(currentPath, ".json") {
+			return nil
+		}
+
+		// On recupere le chemin du fichier
+		filePath := filepath.ToSlash(strings.TrimSuffix(currentPath[len(metaFolder)+1:], ".json"))
+		if !strings.HasPrefix(filePath, strings.TrimPrefix(path, "/")) {
+			return nil
+		}
+
+		// On verifie son expiration
+		data, err := os.ReadFile(currentPath)
+		if err != nil {
+			return err
+		}
+		meta := localMeta{}
+		if err = json.Unmarshal(data, &meta); err != nil {
+			return nil
+		}
+		if meta.ExpiresAt != nil && backend.IsExpired(*meta.ExpiresAt, now) && pathMustExists(addPrefixedPath(b, filePath)) {
+			files = append(files, filePath)
+		}
+		return nil
+	})
+
+	return files, err
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package gofsbcklocal
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// FS_IMMUTABLE_FL est l'attribut immuable des inodes (linux/fs.h)
+const FS_IMMUTABLE_FL = 0x00000010
+
+// setImmutable positionne l'attribut immuable du fichier (chattr +i). Ce n'est permis qu'avec
+// la capacite CAP_LINUX_IMMUTABLE et sur les systemes de fichiers qui le gerent
+func setImmutable(filePath string, immutable bool) error {
+	fd, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	// On ne modifie que l'attribut immuable
+	flags, err := unix.IoctlGetUint32(int(fd.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		return err
+	}
+	newFlags := flags &^ FS_IMMUTABLE_FL
+	if immutable {
+		newFlags |= FS_IMMUTABLE_FL
+	}
+	if newFlags == flags {
+		return nil
+	}
+
+	return unix.IoctlSetPointerInt(int(fd.Fd()), unix.FS_IOC_SETFLAGS, int(newFlags))
+}
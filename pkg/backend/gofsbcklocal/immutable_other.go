@@ -0,0 +1,10 @@
+//go:build !linux
+
+package gofsbcklocal
+
+import "github.com/craimbault/go-fs/internal/backend"
+
+// setImmutable n'est disponible que sous Linux, la protection repose alors uniquement sur le backend
+func setImmutable(filePath string, immutable bool) error {
+	return backend.ErrNotSupported
+}
@@ -1,15 +1,18 @@
 package gofsbcklocal
 
 import (
+	"context"
 	"errors"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/craimbault/go-fs/internal/backend"
-	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog"
 )
 
 const BACKEND_NAME = "local"
@@ -17,14 +20,27 @@ const BACKEND_NAME = "local"
 type LocalConfig struct {
 	BasePath string
 	Debug    bool
+	// Nombre de versions precedentes conservees pour chaque fichier, 0 pour ne pas les conserver
+	MaxVersions int
+	// Politique appliquee aux liens symboliques (SYMLINK_*), SYMLINK_FOLLOW par defaut
+	SymlinkPolicy string
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
 }
 
 type LocalBackend struct {
-	Config LocalConfig
-	Mu     sync.Mutex
+	Config      LocalConfig
+	Mu          sync.Mutex
+	logger      zerolog.Logger
+	lastVersion time.Time
+	// BasePath dont les liens sont resolus
+	realBasePath string
 }
 
 func New(config LocalConfig) (*LocalBackend, error) {
+	// On initialise le logger
+	logger := backend.NewLogger(config.Logger, BACKEND_NAME, config.Debug)
+
 	// On verifie que le BasePath existe
 	basePathExists := true
 	if !pathMustExists(config.BasePath) {
@@ -38,69 +54,94 @@ func New(config LocalConfig) (*LocalBackend, error) {
 		}
 	}
 
+	// On verifie la politique des liens
+	if err := validateSymlinkPolicy(config.SymlinkPolicy); err != nil {
+		return &LocalBackend{}, err
+	}
+	realBasePath, err := filepath.EvalSymlinks(config.BasePath)
+	if err != nil {
+		return &LocalBackend{}, errors.New("unable to resolve base path : " + err.Error())
+	}
+
 	// On informe
-	log.Debug().
-		Str("backend", "local").
+	logger.Debug().
 		Str("basepath", config.BasePath).
 		Bool("exists", basePathExists).
+		Int("max_versions", config.MaxVersions).
+		Str("symlink_policy", config.SymlinkPolicy).
 		Msg("Starting backend ...")
 
 	// On initialise
 	backend := LocalBackend{
-		Config: config,
+		Config:       config,
+		logger:       logger,
+		realBasePath: realBasePath,
 	}
 	return &backend, nil
 }
 
-func (b *LocalBackend) List(path string, recursive bool) ([]string, error) {
+func (b *LocalBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
 	// On initialise
 	prefixedPath := addPrefixedPath(b, path)
 	files := make([]string, 0)
-	prefixedPathLen := len(prefixedPath)
 
-	log.Debug().
-		Str("backend", "local").
-		Str("action", "List").
+	b.logger.Debug().
+		Str("op", "List").
 		Str("path", prefixedPath).
 		Send()
 
-	// On parcours tous les elements
-	filepath.Walk(prefixedPath, func(currentPath string, info os.FileInfo, err error) error {
-		// Si ce n'est pas le chemin en cours
-		if prefixedPath != currentPath {
-			// On verifie si l'on a un dossier
-			isRecursiveFolder := len(strings.Split(currentPath[prefixedPathLen+1:], string(os.PathSeparator))) > 1
-			// Si l'on est en recursive ou que l'on y est pas (ni global, ni local) mais et que l'on a pas un dossier
-			if (recursive || (!recursive && !isRecursiveFolder)) && !info.IsDir() {
-				// On ajoute le nom du fichier dans la liste
-				files = append(files, currentPath[prefixedPathLen:])
-			}
-		}
-		return nil
+	// Les chemins sont relatifs au chemin liste
+	rel := ""
+	if path != "" && !strings.HasSuffix(path, "/") {
+		rel = "/"
+	}
+
+	// On parcours tous les elements, un dossier absent etant vide et un lien refuse renvoyant une erreur
+	if err := b.checkPath("list", path, false); err != nil {
+		return nil, err
+	}
+	err := b.walkFiles(prefixedPath, rel, recursive, make(map[string]bool), func(file string) {
+		files = append(files, file)
 	})
+	if err != nil && !os.IsNotExist(err) && !errors.Is(err, syscall.ENOTDIR) {
+		return nil, err
+	}
 
-	return files, nil
+	// Les fichiers expires ne sont plus visibles, comme pour Stat et Read
+	return b.withoutExpired(path, files), nil
 }
 
-func (b *LocalBackend) Stat(filePath string) (backend.FileInfo, error) {
+func (b *LocalBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
 	// On initialise
 	prefixedFilePath := addPrefixedPath(b, filePath)
 	fInfo := backend.FileInfo{}
 
-	log.Debug().
-		Str("backend", "local").
-		Str("action", "Stat").
+	b.logger.Debug().
+		Str("op", "Stat").
 		Str("path", prefixedFilePath).
 		Send()
 
+	// On applique la politique des liens
+	if err := b.checkPath("stat", filePath, false); err != nil {
+		return fInfo, err
+	}
+
 	// On recupere les infos
 	infos, err := os.Stat(prefixedFilePath)
 
 	// Si le fichier n'existe pas
 	if _, hasError := err.(*os.PathError); hasError {
-		return fInfo, errors.New("filepath does not exists")
+		return fInfo, backend.ErrNotExist
 	} else if err != nil {
 		return fInfo, errors.New("fs stat error : " + err.Error())
+	} else if infos.IsDir() { // Les dossiers ne sont pas des fichiers
+		return fInfo, backend.ErrNotExist
+	}
+
+	// On indique si le fichier est un lien
+	if linkInfo, err := os.Lstat(prefixedFilePath); err == nil && linkInfo.Mode()&os.ModeSymlink != 0 {
+		fInfo.IsSymlink = true
+		fInfo.SymlinkTarget, _ = b.linkTarget(prefixedFilePath)
 	}
 
 	// On les ajoute au retour
@@ -108,33 +149,55 @@ func (b *LocalBackend) Stat(filePath string) (backend.FileInfo, error) {
 	fInfo.LastModified = infos.ModTime()
 	fInfo.Size = infos.Size()
 
+	// On ajoute les metadonnees
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return fInfo, errors.New("unable to read file metadata : " + err.Error())
+	}
+	fInfo.Metadata = meta.Metadata
+	fInfo.Lock = meta.lock()
+	if meta.ExpiresAt != nil {
+		// Un fichier expire n'existe plus, en attendant sa suppression
+		if backend.IsExpired(*meta.ExpiresAt, time.Now()) {
+			return backend.FileInfo{}, backend.ErrNotExist
+		}
+		fInfo.ExpiresAt = *meta.ExpiresAt
+	}
+	if b.Config.MaxVersions > 0 {
+		fInfo.VersionID, _ = b.currentVersionID(filePath, infos)
+	}
+
 	// On renvoie les infos
 	return fInfo, nil
 }
 
-func (b *LocalBackend) Read(filePath string) ([]byte, error) {
+func (b *LocalBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
 	// On initialise
 	prefixedFilePath := addPrefixedPath(b, filePath)
 
-	log.Debug().
-		Str("backend", "local").
-		Str("action", "Read").
+	b.logger.Debug().
+		Str("op", "Read").
 		Str("path", prefixedFilePath).
 		Send()
 
-	// On verifie si le fichier existe
+	// On applique la politique des liens
+	if err := b.checkPath("read", filePath, false); err != nil {
+		return nil, err
+	}
+
+	// On verifie si le fichier existe et n'a pas expire
 	exists := pathMustExists(prefixedFilePath)
-	if !exists {
-		return nil, errors.New("filepath does not exists")
+	if !exists || b.isExpired(filePath) {
+		return nil, backend.ErrNotExist
 	}
 
 	// On lit le fichier
 	return os.ReadFile(prefixedFilePath)
 }
 
-func (b *LocalBackend) ReadString(filePath string) (string, error) {
+func (b *LocalBackend) ReadString(ctx context.Context, filePath string) (string, error) {
 	// On utilise la methode existante
-	data, err := b.Read(filePath)
+	data, err := b.Read(ctx, filePath)
 	if err != nil {
 		return "", err
 	}
@@ -143,53 +206,67 @@ func (b *LocalBackend) ReadString(filePath string) (string, error) {
 	return string(data), err
 }
 
-func (b *LocalBackend) ReadStream(filePath string) (backend.FileStream, error) {
+func (b *LocalBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
 	// On initialise
 	prefixedFilePath := addPrefixedPath(b, filePath)
 	fileStream := backend.FileStream{}
+	readOpts := backend.MergeReadOptions(opts)
 
-	log.Debug().
-		Str("backend", "local").
-		Str("action", "ReadStream").
+	b.logger.Debug().
+		Str("op", "ReadStream").
 		Str("path", prefixedFilePath).
 		Send()
 
+	// On applique la politique des liens
+	if err := b.checkPath("read", filePath, false); err != nil {
+		return fileStream, err
+	}
+
 	// On verifie si le fichier existe
 	exists := pathMustExists(prefixedFilePath)
 	if !exists {
-		return fileStream, errors.New("filepath does not exists")
+		return fileStream, backend.ErrNotExist
 	}
 
 	// On recupere les infos du fichier
-	objStat, err := b.Stat(filePath)
-	if err != nil {
+	objStat, err := b.Stat(ctx, filePath)
+	if errors.Is(err, backend.ErrNotExist) {
+		return fileStream, err
+	} else if err != nil {
 		return fileStream, errors.New("unable to get file info")
 	}
 
-	// On les ajoute au retour
-	fileStream.ContentType = objStat.ContentType
-	fileStream.Size = objStat.Size
-
 	// On ouvre le stream
-	fileStream.Content, err = os.OpenFile(prefixedFilePath, os.O_RDONLY, 0644)
+	fd, err := os.OpenFile(prefixedFilePath, os.O_RDONLY, 0644)
 	if err != nil {
 		return fileStream, errors.New("unable to read file")
 	}
+	fileStream, err = openStream(fd, readOpts)
+	fileStream.ContentType = objStat.ContentType
 
 	// On revoi les infos
-	return fileStream, nil
+	return fileStream, err
 }
 
-func (b *LocalBackend) Write(filePath string, data []byte) error {
+func (b *LocalBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
 	// On initialise
 	prefixedFilePath := addPrefixedPath(b, filePath)
 
-	log.Debug().
-		Str("backend", "local").
-		Str("action", "Write").
+	b.logger.Debug().
+		Str("op", "Write").
 		Str("path", prefixedFilePath).
 		Send()
 
+	// On applique la politique des liens
+	if err := b.checkPath("write", filePath, true); err != nil {
+		return err
+	}
+
+	// On verifie les options
+	if err := checkWriteOptions(backend.MergeWriteOptions(opts)); err != nil {
+		return err
+	}
+
 	// On recupere le nom du dossier
 	dirPath := filepath.Dir(prefixedFilePath)
 
@@ -199,25 +276,50 @@ func (b *LocalBackend) Write(filePath string, data []byte) error {
 		createFolder(dirPath)
 	}
 
+	// On verifie que le fichier n'est pas protege puis on conserve la version precedente
+	if err := b.checkLock(filePath); err != nil {
+		return err
+	}
+	if err := b.archiveVersion(filePath); err != nil {
+		return err
+	}
+
 	// On ecrit le fichier
-	return os.WriteFile(prefixedFilePath, data, 0644)
+	if err := os.WriteFile(prefixedFilePath, data, 0644); err != nil {
+		return err
+	}
+
+	// On remplace les metadonnees
+	if err := b.replaceWriteMeta(filePath, backend.MergeWriteOptions(opts)); err != nil {
+		return err
+	}
+	return b.setVersion(filePath)
 }
 
-func (b *LocalBackend) WriteString(filePath string, content string) error {
+func (b *LocalBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
 	// On utilise la methode existante
-	return b.Write(filePath, []byte(content))
+	return b.Write(ctx, filePath, []byte(content), opts...)
 }
 
-func (b *LocalBackend) WriteStream(filePath string, stream io.ReadCloser, length int64) error {
+func (b *LocalBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
 	// On initialise
 	prefixedFilePath := addPrefixedPath(b, filePath)
 
-	log.Debug().
-		Str("backend", "local").
-		Str("action", "Write").
+	b.logger.Debug().
+		Str("op", "WriteStream").
 		Str("path", prefixedFilePath).
 		Send()
 
+	// On applique la politique des liens
+	if err := b.checkPath("write", filePath, true); err != nil {
+		return err
+	}
+
+	// On verifie les options
+	if err := checkWriteOptions(backend.MergeWriteOptions(opts)); err != nil {
+		return err
+	}
+
 	// On recupere le nom du dossier
 	dirPath := filepath.Dir(prefixedFilePath)
 
@@ -227,8 +329,16 @@ func (b *LocalBackend) WriteStream(filePath string, stream io.ReadCloser, length
 		createFolder(dirPath)
 	}
 
+	// On verifie que le fichier n'est pas protege puis on conserve la version precedente
+	if err := b.checkLock(filePath); err != nil {
+		return err
+	}
+	if err := b.archiveVersion(filePath); err != nil {
+		return err
+	}
+
 	// On ouvre le fichier en ecriture
-	fd, err := os.OpenFile(prefixedFilePath, os.O_RDWR|os.O_CREATE, 0644)
+	fd, err := os.OpenFile(prefixedFilePath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
 		return err
 	}
@@ -240,40 +350,192 @@ func (b *LocalBackend) WriteStream(filePath string, stream io.ReadCloser, length
 	}
 	defer stream.Close()
 
-	// Tout est OK
-	return nil
+	// On remplace les metadonnees
+	if err = b.replaceWriteMeta(filePath, backend.MergeWriteOptions(opts)); err != nil {
+		return err
+	}
+	return b.setVersion(filePath)
 }
 
-func (b *LocalBackend) Move(filePathSrc string, filePathDst string) error {
+func (b *LocalBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
 	// On initialise
 	prefixedFilePathSrc := addPrefixedPath(b, filePathSrc)
 	prefixedFilePathDst := addPrefixedPath(b, filePathDst)
 
-	log.Debug().
-		Str("backend", "local").
-		Str("action", "Move").
+	b.logger.Debug().
+		Str("op", "Copy").
 		Str("src", prefixedFilePathSrc).
 		Str("dst", prefixedFilePathDst).
 		Send()
 
+	// On applique la politique des liens
+	if err := b.checkPath("copy", filePathSrc, false); err != nil {
+		return err
+	}
+	if err := b.checkPath("copy", filePathDst, true); err != nil {
+		return err
+	}
+
+	// On ouvre le fichier source, s'il n'a pas expire
+	if b.isExpired(filePathSrc) {
+		return backend.ErrNotExist
+	}
+	src, err := os.Open(prefixedFilePathSrc)
+	if os.IsNotExist(err) {
+		return backend.ErrNotExist
+	} else if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Si le dossier de destination existe pas
+	dirPath := filepath.Dir(prefixedFilePathDst)
+	if !pathMustExists(dirPath) {
+		// On le cree
+		createFolder(dirPath)
+	}
+
+	// On verifie que la destination n'est pas protegee puis on conserve sa version precedente
+	if err = b.checkLock(filePathDst); err != nil {
+		return err
+	}
+	if err = b.archiveVersion(filePathDst); err != nil {
+		return err
+	}
+
+	// On ouvre le fichier de destination
+	dst, err := os.OpenFile(prefixedFilePathDst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	// On copie le contenu
+	if _, err = io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+
+	// On copie les metadonnees
+	if err = b.copyMeta(filePathSrc, filePathDst); err != nil {
+		return err
+	}
+	return b.setVersion(filePathDst)
+}
+
+func (b *LocalBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// On initialise
+	prefixedFilePathSrc := addPrefixedPath(b, filePathSrc)
+	prefixedFilePathDst := addPrefixedPath(b, filePathDst)
+
+	b.logger.Debug().
+		Str("op", "Move").
+		Str("src", prefixedFilePathSrc).
+		Str("dst", prefixedFilePathDst).
+		Send()
+
+	// On applique la politique des liens
+	if err := b.checkPath("move", filePathSrc, true); err != nil {
+		return err
+	}
+	if err := b.checkPath("move", filePathDst, true); err != nil {
+		return err
+	}
+
+	// Si le dossier de destination existe pas
+	dirPath := filepath.Dir(prefixedFilePathDst)
+	if !pathMustExists(dirPath) {
+		// On le cree
+		createFolder(dirPath)
+	}
+
+	// On verifie que la source et la destination ne sont pas protegees
+	if err := b.checkLock(filePathSrc); err != nil {
+		return err
+	}
+	if err := b.checkLock(filePathDst); err != nil {
+		return err
+	}
+
+	// On conserve la version precedente de la destination
+	if pathMustExists(prefixedFilePathSrc) {
+		if err := b.archiveVersion(filePathDst); err != nil {
+			return err
+		}
+	}
+
 	// On deplace le fichier
 	err := os.Rename(prefixedFilePathSrc, prefixedFilePathDst)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	// On deplace les metadonnees
+	if err = b.moveMeta(filePathSrc, filePathDst); err != nil {
+		return err
+	}
+	return b.setVersion(filePathDst)
 }
 
-func (b *LocalBackend) Delete(filePath string) error {
+func (b *LocalBackend) Delete(ctx context.Context, filePath string) error {
 	// On initialise
 	prefixedFilePath := addPrefixedPath(b, filePath)
 
-	log.Debug().
-		Str("backend", "local").
-		Str("action", "Delete").
+	b.logger.Debug().
+		Str("op", "Delete").
 		Str("path", prefixedFilePath).
 		Send()
 
-	return os.Remove(prefixedFilePath)
+	// On applique la politique des liens
+	if err := b.checkPath("delete", filePath, true); err != nil {
+		return err
+	}
+
+	// On verifie que le fichier n'est pas protege
+	if err := b.checkLock(filePath); err != nil {
+		return err
+	}
+
+	// On conserve le contenu si les versions sont activees, sinon on supprime le fichier.
+	// Un fichier expire est supprime avec ses versions, afin que son contenu ne soit pas conserve
+	var err error
+	if b.Config.MaxVersions > 0 && pathMustExists(prefixedFilePath) && !b.isExpired(filePath) {
+		err = b.archiveVersion(filePath)
+	} else if err = os.Remove(prefixedFilePath); err == nil && b.isExpired(filePath) {
+		err = b.purgeVersions(filePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	// On supprime les metadonnees
+	return b.deleteMeta(filePath)
+}
+
+func (b *LocalBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	// On initialise
+	prefixedFilePath := addPrefixedPath(b, filePath)
+
+	b.logger.Debug().
+		Str("op", "SetMetadata").
+		Str("path", prefixedFilePath).
+		Send()
+
+	// On applique la politique des liens
+	if err := b.checkPath("setmetadata", filePath, true); err != nil {
+		return err
+	}
+
+	// Le fichier doit exister et ne pas etre protege
+	if _, err := b.Stat(ctx, filePath); err != nil {
+		return err
+	}
+	if err := b.checkLock(filePath); err != nil {
+		return err
+	}
+
+	// On remplace les metadonnees
+	return b.replaceMetadata(filePath, metadata)
 }
@@ -0,0 +1,124 @@
+package gofsbcklocal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// lock renvoie la protection enregistree dans le fichier annexe
+func (m localMeta) lock() backend.Lock {
+	lock := backend.Lock{
+		Mode:      m.RetentionMode,
+		LegalHold: m.LegalHold,
+	}
+	if m.RetainUntil != nil {
+		lock.RetainUntil = *m.RetainUntil
+	}
+
+	return lock
+}
+
+// checkLock renvoie une LockedError si le fichier est protege.
+// Une retention expiree est retiree, ainsi que l'attribut immuable du fichier
+func (b *LocalBackend) checkLock(filePath string) error {
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return errors.New("unable to read file metadata : " + err.Error())
+	}
+	lock := meta.lock()
+	if lock.IsLocked(time.Now()) {
+		return &backend.LockedError{Path: filePath, Lock: lock}
+	}
+
+	// Si la retention a expire
+	if lock.Mode != backend.RETENTION_NONE {
+		setImmutable(addPrefixedPath(b, filePath), false)
+		meta.RetentionMode = backend.RETENTION_NONE
+		meta.RetainUntil = nil
+		return b.writeMeta(filePath, meta)
+	}
+
+	return nil
+}
+
+func (b *LocalBackend) SetRetention(ctx context.Context, filePath string, mode backend.RetentionMode, until time.Time) error {
+	b.logger.Debug().
+		Str("op", "SetRetention").
+		Str("path", addPrefixedPath(b, filePath)).
+		Str("mode", string(mode)).
+		Time("until", until).
+		Send()
+
+	// Le fichier doit exister
+	if _, err := b.Stat(ctx, filePath); err != nil {
+		return err
+	}
+
+	// On verifie que la retention peut etre remplacee
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return errors.New("unable to read file metadata : " + err.Error())
+	}
+	now := time.Now()
+	if err = backend.ValidateRetention(filePath, meta.lock(), mode, until, now); err != nil {
+		return err
+	}
+
+	// On l'enregistre
+	meta.RetentionMode = mode
+	meta.RetainUntil = nil
+	if mode != backend.RETENTION_NONE {
+		until = until.UTC()
+		meta.RetainUntil = &until
+	}
+
+	return b.writeLock(filePath, meta)
+}
+
+func (b *LocalBackend) SetLegalHold(ctx context.Context, filePath string, on bool) error {
+	b.logger.Debug().
+		Str("op", "SetLegalHold").
+		Str("path", addPrefixedPath(b, filePath)).
+		Bool("on", on).
+		Send()
+
+	// Le fichier doit exister
+	if _, err := b.Stat(ctx, filePath); err != nil {
+		return err
+	}
+
+	// On l'enregistre
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return errors.New("unable to read file metadata : " + err.Error())
+	}
+	meta.LegalHold = on
+
+	return b.writeLock(filePath, meta)
+}
+
+func (b *LocalBackend) GetLock(ctx context.Context, filePath string) (backend.Lock, error) {
+	fInfo, err := b.Stat(ctx, filePath)
+	return fInfo.Lock, err
+}
+
+// writeLock enregistre la protection puis met a jour l'attribut immuable si le systeme le permet
+func (b *LocalBackend) writeLock(filePath string, meta localMeta) error {
+	if err := b.writeMeta(filePath, meta); err != nil {
+		return err
+	}
+
+	err := setImmutable(addPrefixedPath(b, filePath), meta.lock().IsLocked(time.Now()))
+	if err != nil && !os.IsNotExist(err) {
+		b.logger.Debug().
+			Str("path", addPrefixedPath(b, filePath)).
+			Err(err).
+			Msg("Unable to change the immutable attribute")
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+package gofsbcklocal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// TEST_RETENTION est assez courte pour que les retentions COMPLIANCE expirent avant le nettoyage du dossier
+const TEST_RETENTION = 300 * time.Millisecond
+
+func TestLockRefusal(t *testing.T) {
+	ctx := context.Background()
+
+	// Les protections, et la facon de les retirer afin que le dossier temporaire puisse etre supprime
+	locks := []struct {
+		name    string
+		lock    func(b *LocalBackend, filePath string) error
+		release func(b *LocalBackend, filePath string) error
+	}{
+		{
+			"legal hold",
+			func(b *LocalBackend, filePath string) error {
+				return b.SetLegalHold(ctx, filePath, true)
+			},
+			func(b *LocalBackend, filePath string) error {
+				return b.SetLegalHold(ctx, filePath, false)
+			},
+		},
+		{
+			"governance retention",
+			func(b *LocalBackend, filePath string) error {
+				return b.SetRetention(ctx, filePath, backend.RETENTION_GOVERNANCE, time.Now().Add(time.Hour))
+			},
+			func(b *LocalBackend, filePath string) error {
+				return b.SetRetention(ctx, filePath, backend.RETENTION_NONE, time.Time{})
+			},
+		},
+		{
+			"compliance retention",
+			func(b *LocalBackend, filePath string) error {
+				return b.SetRetention(ctx, filePath, backend.RETENTION_COMPLIANCE, time.Now().Add(TEST_RETENTION))
+			},
+			func(b *LocalBackend, filePath string) error {
+				// Elle ne peut pas etre retiree, on attend son expiration
+				time.Sleep(TEST_RETENTION)
+				return b.checkLock(filePath)
+			},
+		},
+	}
+
+	// Les operations devant etre refusees sur le fichier protege
+	ops := []struct {
+		name string
+		op   func(b *LocalBackend, filePath string) error
+	}{
+		{"write", func(b *LocalBackend, filePath string) error {
+			return b.Write(ctx, filePath, []byte("overwritten"))
+		}},
+		{"write stream", func(b *LocalBackend, filePath string) error {
+			return b.WriteStream(ctx, filePath, io.NopCloser(bytes.NewReader([]byte("overwritten"))), 11)
+		}},
+		{"delete", func(b *LocalBackend, filePath string) error {
+			return b.Delete(ctx, filePath)
+		}},
+		{"move source", func(b *LocalBackend, filePath string) error {
+			return b.Move(ctx, filePath, "moved")
+		}},
+		{"copy destination", func(b *LocalBackend, filePath string) error {
+			if err := b.Write(ctx, "other", []byte("other")); err != nil {
+				return err
+			}
+			return b.Copy(ctx, "other", filePath)
+		}},
+		{"move destination", func(b *LocalBackend, filePath string) error {
+			if err := b.Write(ctx, "other", []byte("other")); err != nil {
+				return err
+			}
+			return b.Move(ctx, "other", filePath)
+		}},
+		{"set metadata", func(b *LocalBackend, filePath string) error {
+			return b.SetMetadata(ctx, filePath, map[string]string{"changed": "true"})
+		}},
+	}
+
+	for _, lock := range locks {
+		for _, op := range ops {
+			t.Run(lock.name+"/"+op.name, func(t *testing.T) {
+				b := newTestBackend(t, LocalConfig{})
+				if err := b.Write(ctx, "file", []byte("original")); err != nil {
+					t.Fatal(err)
+				}
+				if err := lock.lock(b, "file"); err != nil {
+					t.Fatalf("lock : %v", err)
+				}
+				defer func() {
+					if err := lock.release(b, "file"); err != nil {
+						t.Errorf("release : %v", err)
+					}
+				}()
+
+				// L'operation est refusee avec une erreur typee
+				err := op.op(b, "file")
+				var lockedErr *backend.LockedError
+				if !errors.Is(err, backend.ErrLocked) || !errors.Is(err, fs.ErrPermission) || !errors.As(err, &lockedErr) {
+					t.Fatalf("error = %v, want a locked error", err)
+				}
+				if lockedErr.Path != "file" {
+					t.Errorf("locked path = %q, want %q", lockedErr.Path, "file")
+				}
+
+				// Le fichier et ses metadonnees sont intacts
+				if got, err := b.Read(ctx, "file"); err != nil || string(got) != "original" {
+					t.Errorf("content = %q, %v, want %q", got, err, "original")
+				}
+				fInfo, err := b.Stat(ctx, "file")
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !fInfo.Lock.IsLocked(time.Now()) {
+					t.Errorf("lock = %+v, want the file still locked", fInfo.Lock)
+				}
+				if fInfo.Metadata["changed"] != "" {
+					t.Error("metadata changed on a locked file")
+				}
+			})
+		}
+	}
+}
+
+func TestLockRelease(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t, LocalConfig{})
+	if err := b.Write(ctx, "file", []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Une retention COMPLIANCE ne peut ni etre reduite ni retiree
+	if err := b.SetRetention(ctx, "file", backend.RETENTION_COMPLIANCE, time.Now().Add(TEST_RETENTION)); err != nil {
+		t.Fatal(err)
+	}
+	for _, mode := range []backend.RetentionMode{backend.RETENTION_NONE, backend.RETENTION_GOVERNANCE} {
+		if err := b.SetRetention(ctx, "file", mode, time.Now().Add(TEST_RETENTION/2)); !errors.Is(err, backend.ErrLocked) {
+			t.Errorf("set retention[%s] error = %v, want %v", mode, err, backend.ErrLocked)
+		}
+	}
+
+	// Une fois expiree, le fichier peut etre supprime
+	time.Sleep(TEST_RETENTION)
+	if err := b.Delete(ctx, "file"); err != nil {
+		t.Fatalf("delete after retention : %v", err)
+	}
+}
+
+func TestMetaFolderRefusal(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t, LocalConfig{})
+	if err := b.Write(ctx, "file", []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SetLegalHold(ctx, "file", true); err != nil {
+		t.Fatal(err)
+	}
+	defer b.SetLegalHold(ctx, "file", false)
+
+	// Le fichier annexe portant la protection ne peut pas etre atteint
+	metaPath := META_FOLDER + "/meta/file.json"
+	tests := []struct {
+		name string
+		op   func() error
+	}{
+		{"delete", func() error { return b.Delete(ctx, metaPath) }},
+		{"write", func() error { return b.Write(ctx, metaPath, []byte("{}")) }},
+		{"write cleaned path", func() error { return b.Write(ctx, "dir/../"+metaPath, []byte("{}")) }},
+		{"read", func() error { _, err := b.Read(ctx, metaPath); return err }},
+		{"copy destination", func() error { return b.Copy(ctx, "file", metaPath) }},
+		{"move source", func() error { return b.Move(ctx, metaPath, "stolen") }},
+		{"list", func() error { _, err := b.List(ctx, META_FOLDER, true); return err }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.op(); !errors.Is(err, fs.ErrPermission) {
+				t.Errorf("error = %v, want %v", err, fs.ErrPermission)
+			}
+		})
+	}
+
+	// La protection est toujours en place
+	if err := b.Delete(ctx, "file"); !errors.Is(err, backend.ErrLocked) {
+		t.Errorf("delete error = %v, want %v", err, backend.ErrLocked)
+	}
+}
@@ -0,0 +1,180 @@
+package gofsbcklocal
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// META_FOLDER est le dossier cache, a la racine du BasePath, qui contient les donnees internes du backend.
+// Il n'apparait jamais dans les listes
+const META_FOLDER = ".gofs"
+
+// localMeta est le contenu du fichier annexe enregistre pour chaque fichier
+type localMeta struct {
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Identifiant de la version courante, si les versions sont conservees
+	VersionID string `json:"version_id,omitempty"`
+	// Protection du fichier
+	RetentionMode backend.RetentionMode `json:"retention_mode,omitempty"`
+	RetainUntil   *time.Time            `json:"retain_until,omitempty"`
+	LegalHold     bool                  `json:"legal_hold,omitempty"`
+	// Date d'expiration du fichier
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (m localMeta) isEmpty() bool {
+	return len(m.Metadata) == 0 && m.VersionID == "" && m.RetentionMode == backend.RETENTION_NONE && !m.LegalHold && m.ExpiresAt == nil
+}
+
+func metaFilePath(b *LocalBackend, filePath string) string {
+	return b.Config.BasePath + string(os.PathSeparator) + META_FOLDER + string(os.PathSeparator) + "meta" + string(os.PathSeparator) + cleanPath(filePath) + ".json"
+}
+
+func isMetaFolder(b *LocalBackend, path string) bool {
+	return filepath.Clean(path) == filepath.Clean(b.Config.BasePath+string(os.PathSeparator)+META_FOLDER)
+}
+
+// inMetaFolder indique si le chemin, relatif au BasePath, est dans le dossier interne du backend
+func inMetaFolder(rel string) bool {
+	return rel == META_FOLDER || strings.HasPrefix(rel, META_FOLDER+"/")
+}
+
+// checkMetaPath refuse les chemins qui designent le dossier interne du backend, directement ou a travers un lien
+func (b *LocalBackend) checkMetaPath(op string, filePath string) error {
+	// On verifie le chemin demande, puis le chemin reel s'il passe par un lien
+	denied := inMetaFolder(cleanPath(filePath))
+	if !denied {
+		if links := b.inspectPath(filePath); links.intermediate || links.final {
+			rel, err := filepath.Rel(b.realBasePath, links.resolved)
+			denied = err == nil && inMetaFolder(filepath.ToSlash(rel))
+		}
+	}
+	if !denied {
+		return nil
+	}
+
+	b.logger.Debug().
+		Str("op", op).
+		Str("path", filePath).
+		Msg("Access to the backend internal folder rejected")
+	return &fs.PathError{Op: op, Path: filePath, Err: fs.ErrPermission}
+}
+
+// checkPath verifie que le chemin peut etre utilise, hors du dossier interne et selon la politique des liens
+func (b *LocalBackend) checkPath(op string, filePath string, write bool) error {
+	if err := b.checkMetaPath(op, filePath); err != nil {
+		return err
+	}
+
+	return b.checkSymlink(op, filePath, write)
+}
+
+func (b *LocalBackend) readMeta(filePath string) (localMeta, error) {
+	// On initialise
+	meta := localMeta{}
+
+	// Si le fichier annexe n'existe pas, on a pas de metadonnees
+	data, err := os.ReadFile(metaFilePath(b, filePath))
+	if os.IsNotExist(err) {
+		return meta, nil
+	} else if err != nil {
+		return meta, err
+	}
+
+	return meta, json.Unmarshal(data, &meta)
+}
+
+func (b *LocalBackend) writeMeta(filePath string, meta localMeta) error {
+	// Si l'on a plus rien a enregistrer, on supprime le fichier annexe
+	if meta.isEmpty() {
+		return b.deleteMeta(filePath)
+	}
+
+	// Sinon on l'ecrit
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	metaPath := metaFilePath(b, filePath)
+	if err = createFolder(filepath.Dir(metaPath)); err != nil {
+		return err
+	}
+
+	return os.WriteFile(metaPath, data, 0644)
+}
+
+func (b *LocalBackend) replaceMetadata(filePath string, metadata map[string]string) error {
+	// On conserve les autres informations du fichier annexe
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return err
+	}
+	meta.Metadata = normalizeMetadata(metadata)
+
+	return b.writeMeta(filePath, meta)
+}
+
+// replaceWriteMeta remplace les metadonnees et l'expiration d'un fichier qui vient d'etre ecrit
+func (b *LocalBackend) replaceWriteMeta(filePath string, opts backend.WriteOptions) error {
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return err
+	}
+	meta.Metadata = normalizeMetadata(opts.Metadata)
+	meta.ExpiresAt = nil
+	if expiresAt := opts.Expiry(time.Now()); !expiresAt.IsZero() {
+		meta.ExpiresAt = &expiresAt
+	}
+
+	return b.writeMeta(filePath, meta)
+}
+
+func (b *LocalBackend) copyMeta(filePathSrc string, filePathDst string) error {
+	meta, err := b.readMeta(filePathSrc)
+	if err != nil {
+		return err
+	}
+
+	// La protection n'est pas transmise a la destination
+	meta.RetentionMode = backend.RETENTION_NONE
+	meta.RetainUntil = nil
+	meta.LegalHold = false
+
+	return b.writeMeta(filePathDst, meta)
+}
+
+func (b *LocalBackend) moveMeta(filePathSrc string, filePathDst string) error {
+	if err := b.copyMeta(filePathSrc, filePathDst); err != nil {
+		return err
+	}
+
+	return b.deleteMeta(filePathSrc)
+}
+
+func (b *LocalBackend) deleteMeta(filePath string) error {
+	err := os.Remove(metaFilePath(b, filePath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	return err
+}
+
+func normalizeMetadata(metadata map[string]string) map[string]string {
+	// Les cles sont toujours en minuscules, comme pour S3
+	if len(metadata) == 0 {
+		return nil
+	}
+	normalized := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		normalized[strings.ToLower(key)] = value
+	}
+
+	return normalized
+}
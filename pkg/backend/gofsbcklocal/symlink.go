@@ -0,0 +1,320 @@
+package gofsbcklocal
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// Politiques disponibles pour LocalConfig.SymlinkPolicy, qui s'appliquent de la meme facon aux listings et aux acces
+const (
+	// Les liens sont suivis, y compris vers l'exterieur du BasePath. Politique par defaut
+	SYMLINK_FOLLOW = "follow"
+	// Les liens sont ignores, comme s'ils n'existaient pas, et ne peuvent pas etre traverses
+	SYMLINK_SKIP = "skip"
+	// Un lien vers un fichier est un fichier, les liens vers des dossiers sont ignores
+	SYMLINK_FILE = "file"
+	// Les liens sont suivis tant que leur cible reste dans le BasePath
+	SYMLINK_REJECT_ESCAPING = "reject_escaping"
+)
+
+func validateSymlinkPolicy(policy string) error {
+	switch policy {
+	case "", SYMLINK_FOLLOW, SYMLINK_SKIP, SYMLINK_FILE, SYMLINK_REJECT_ESCAPING:
+		return nil
+	}
+
+	return errors.New("unknown symlink policy[" + policy + "]")
+}
+
+// pathLinks decrit les liens rencontres sur un chemin
+type pathLinks struct {
+	// Un dossier parent est un lien
+	intermediate bool
+	// Le fichier lui meme est un lien
+	final bool
+	// Chemin reel, liens resolus
+	resolved string
+}
+
+// inspectPath parcourt les elements du chemin a la recherche de liens, la fin du chemin pouvant ne pas exister
+func (b *LocalBackend) inspectPath(filePath string) pathLinks {
+	links := pathLinks{}
+	parts := strings.Split(cleanPath(filePath), "/")
+	current := b.Config.BasePath
+	existing := 0
+	lastIsLink := false
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if err != nil {
+			break
+		}
+		existing = i + 1
+		lastIsLink = info.Mode()&fs.ModeSymlink != 0
+		if lastIsLink {
+			if i == len(parts)-1 {
+				links.final = true
+			} else {
+				links.intermediate = true
+			}
+		}
+	}
+
+	// On resout la partie existante, un dernier lien casse est resolu a la main
+	existingPath := filepath.Join(append([]string{b.Config.BasePath}, parts[:existing]...)...)
+	resolved, err := filepath.EvalSymlinks(existingPath)
+	if err != nil && lastIsLink {
+		parent, _ := filepath.EvalSymlinks(filepath.Dir(existingPath))
+		target, _ := os.Readlink(existingPath)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(parent, target)
+		}
+		resolved = filepath.Clean(target)
+	} else if err != nil {
+		resolved = existingPath
+	}
+	links.resolved = filepath.Join(append([]string{resolved}, parts[existing:]...)...)
+
+	return links
+}
+
+// isInside indique si le chemin reel est dans le BasePath
+func (b *LocalBackend) isInside(resolved string) bool {
+	rel, err := filepath.Rel(b.realBasePath, resolved)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// checkSymlink applique la politique des liens au chemin. Un lien refuse n'existe pas pour une lecture,
+// une ecriture renvoie une erreur fs.ErrPermission
+func (b *LocalBackend) checkSymlink(op string, filePath string, write bool) error {
+	if b.Config.SymlinkPolicy == "" || b.Config.SymlinkPolicy == SYMLINK_FOLLOW {
+		return nil
+	}
+	links := b.inspectPath(filePath)
+	if !links.intermediate && !links.final {
+		return nil
+	}
+
+	// En fonction de la politique
+	allowed := true
+	switch b.Config.SymlinkPolicy {
+	case SYMLINK_SKIP:
+		allowed = false
+	case SYMLINK_FILE:
+		if links.intermediate {
+			allowed = false
+		} else if !write {
+			info, err := os.Stat(addPrefixedPath(b, filePath))
+			allowed = err == nil && info.Mode().IsRegular()
+		}
+	case SYMLINK_REJECT_ESCAPING:
+		allowed = b.isInside(links.resolved)
+	}
+	if allowed {
+		return nil
+	}
+
+	b.logger.Debug().
+		Str("op", op).
+		Str("path", filePath).
+		Str("policy", b.Config.SymlinkPolicy).
+		Msg("Symlink rejected by policy")
+	if write || b.Config.SymlinkPolicy == SYMLINK_REJECT_ESCAPING {
+		return &fs.PathError{Op: op, Path: filePath, Err: fs.ErrPermission}
+	}
+	return backend.ErrNotExist
+}
+
+// followLink renvoie les infos de la cible du lien, false si le lien doit etre ignore dans un listing
+func (b *LocalBackend) followLink(linkPath string) (os.FileInfo, bool) {
+	if b.Config.SymlinkPolicy == SYMLINK_SKIP {
+		return nil, false
+	}
+	info, err := os.Stat(linkPath)
+	if err != nil {
+		return nil, false
+	}
+	if b.Config.SymlinkPolicy == SYMLINK_FILE && !info.Mode().IsRegular() {
+		return nil, false
+	}
+
+	// Le dossier interne du backend n'est jamais liste, meme a travers un lien
+	resolved, err := filepath.EvalSymlinks(linkPath)
+	if err != nil {
+		return nil, false
+	}
+	if rel, err := filepath.Rel(b.realBasePath, resolved); err == nil && inMetaFolder(filepath.ToSlash(rel)) {
+		return nil, false
+	}
+	if b.Config.SymlinkPolicy == SYMLINK_REJECT_ESCAPING && !b.isInside(resolved) {
+		return nil, false
+	}
+
+	return info, true
+}
+
+// walkFiles appelle fn pour chaque fichier du dossier, en suivant les liens selon la politique.
+// Les dossiers reels deja parcourus sur la branche permettent d'eviter les boucles de liens
+func (b *LocalBackend) walkFiles(dirPath string, rel string, recursive bool, ancestors map[string]bool, fn func(file string)) error {
+	// On lit le dossier
+	entries, err := os.ReadDir(dirPath)
+	if err != nil {
+		return err
+	}
+	realDir, err := filepath.EvalSymlinks(dirPath)
+	if err != nil {
+		return err
+	}
+	ancestors[realDir] = true
+	defer delete(ancestors, realDir)
+
+	// On parcourt les entrees
+	for _, entry := range entries {
+		entryPath := filepath.Join(dirPath, entry.Name())
+
+		// On ignore le dossier interne du backend
+		if entry.IsDir() && isMetaFolder(b, entryPath) {
+			continue
+		}
+
+		// On applique la politique aux liens
+		isDir := entry.IsDir()
+		isRegular := entry.Type().IsRegular()
+		if entry.Type()&fs.ModeSymlink != 0 {
+			info, ok := b.followLink(entryPath)
+			if !ok {
+				continue
+			}
+			isDir = info.IsDir()
+			isRegular = info.Mode().IsRegular()
+			if isDir {
+				if realTarget, err := filepath.EvalSymlinks(entryPath); err != nil || ancestors[realTarget] {
+					continue
+				}
+			}
+		}
+
+		// On ajoute les fichiers, et ceux des sous dossiers en recursif
+		if isDir {
+			if recursive {
+				if err = b.walkFiles(entryPath, rel+entry.Name()+"/", recursive, ancestors, fn); err != nil {
+					return err
+				}
+			}
+		} else if isRegular {
+			fn(rel + entry.Name())
+		}
+	}
+
+	return nil
+}
+
+// ancestorsOf renvoie les dossiers reels du BasePath jusqu'au dossier, afin de detecter les boucles de liens
+func (b *LocalBackend) ancestorsOf(dir string) map[string]bool {
+	ancestors := map[string]bool{b.realBasePath: true}
+	current := b.Config.BasePath
+	if dir == "." {
+		return ancestors
+	}
+	for _, part := range strings.Split(dir, "/") {
+		current = filepath.Join(current, part)
+		if resolved, err := filepath.EvalSymlinks(current); err == nil {
+			ancestors[resolved] = true
+		}
+	}
+
+	return ancestors
+}
+
+// Symlink cree un lien relatif vers un fichier du backend
+func (b *LocalBackend) Symlink(ctx context.Context, target string, linkPath string) error {
+	// On initialise
+	prefixedTarget := addPrefixedPath(b, target)
+	prefixedLink := addPrefixedPath(b, linkPath)
+
+	b.logger.Debug().
+		Str("op", "Symlink").
+		Str("target", prefixedTarget).
+		Str("path", prefixedLink).
+		Send()
+
+	// On verifie le chemin du lien et sa cible
+	if err := b.checkPath("symlink", linkPath, true); err != nil {
+		return err
+	}
+	if err := b.checkMetaPath("symlink", target); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(prefixedLink); err == nil {
+		return &fs.PathError{Op: "symlink", Path: linkPath, Err: fs.ErrExist}
+	}
+
+	// On cree le dossier puis le lien, relatif afin de pouvoir deplacer le BasePath
+	dirPath := filepath.Dir(prefixedLink)
+	if !pathMustExists(dirPath) {
+		createFolder(dirPath)
+	}
+	relTarget, err := filepath.Rel(dirPath, prefixedTarget)
+	if err != nil {
+		return errors.New("unable to compute link target[" + target + "] : " + err.Error())
+	}
+
+	return os.Symlink(relTarget, prefixedLink)
+}
+
+// Readlink renvoie le chemin dans le backend de la cible du lien, ou la cible telle quelle si elle est en dehors du BasePath
+func (b *LocalBackend) Readlink(ctx context.Context, linkPath string) (string, error) {
+	// On initialise
+	prefixedLink := addPrefixedPath(b, linkPath)
+
+	b.logger.Debug().
+		Str("op", "Readlink").
+		Str("path", prefixedLink).
+		Send()
+
+	// On applique la politique des liens, le dossier interne du backend restant inaccessible
+	if err := b.checkPath("readlink", linkPath, false); err != nil {
+		return "", err
+	}
+
+	// Le fichier doit etre un lien
+	info, err := os.Lstat(prefixedLink)
+	if os.IsNotExist(err) {
+		return "", backend.ErrNotExist
+	} else if err != nil {
+		return "", err
+	}
+	if info.Mode()&fs.ModeSymlink == 0 {
+		return "", &fs.PathError{Op: "readlink", Path: linkPath, Err: fs.ErrInvalid}
+	}
+
+	return b.linkTarget(prefixedLink)
+}
+
+func (b *LocalBackend) linkTarget(prefixedLink string) (string, error) {
+	target, err := os.Readlink(prefixedLink)
+	if err != nil {
+		return "", err
+	}
+
+	// On exprime la cible relativement au BasePath si elle s'y trouve
+	absTarget := target
+	if !filepath.IsAbs(target) {
+		absTarget = filepath.Join(filepath.Dir(prefixedLink), target)
+	}
+	rel, err := filepath.Rel(filepath.Clean(b.Config.BasePath), absTarget)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+		return target, nil
+	}
+
+	return filepath.ToSlash(rel), nil
+}
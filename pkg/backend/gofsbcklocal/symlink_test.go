@@ -0,0 +1,260 @@
+package gofsbcklocal
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// newLinkedBackend cree un backend contenant des liens vers des fichiers et des dossiers, a l'interieur et a l'exterieur
+// du BasePath, ainsi que vers le dossier interne. Le dossier exterieur est renvoye
+func newLinkedBackend(t *testing.T, policy string) (*LocalBackend, string) {
+	t.Helper()
+	b := newTestBackend(t, LocalConfig{SymlinkPolicy: policy})
+	outside := t.TempDir()
+	files := map[string]string{
+		filepath.Join(b.Config.BasePath, "data", "file.txt"):            "inside",
+		filepath.Join(b.Config.BasePath, "data", "sub", "x.txt"):        "x",
+		filepath.Join(b.Config.BasePath, META_FOLDER, "meta", "m.json"): "{}",
+		filepath.Join(outside, "secret.txt"):                            "outside",
+		filepath.Join(outside, "dir", "y.txt"):                          "y",
+	}
+	links := map[string]string{
+		"file_link": "data/file.txt",
+		"dir_link":  "data/sub",
+		"out_file":  filepath.Join(outside, "secret.txt"),
+		"out_dir":   filepath.Join(outside, "dir"),
+		"meta_link": META_FOLDER,
+		"data/loop": "..",
+	}
+	for filePath, content := range files {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for linkPath, target := range links {
+		if err := os.Symlink(target, filepath.Join(b.Config.BasePath, linkPath)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return b, outside
+}
+
+func TestSymlinkPolicyList(t *testing.T) {
+	tests := []struct {
+		policy string
+		want   []string
+	}{
+		{SYMLINK_FOLLOW, []string{"data/file.txt", "data/sub/x.txt", "dir_link/x.txt", "file_link", "out_dir/y.txt", "out_file"}},
+		{SYMLINK_SKIP, []string{"data/file.txt", "data/sub/x.txt"}},
+		{SYMLINK_FILE, []string{"data/file.txt", "data/sub/x.txt", "file_link", "out_file"}},
+		{SYMLINK_REJECT_ESCAPING, []string{"data/file.txt", "data/sub/x.txt", "dir_link/x.txt", "file_link"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			b, _ := newLinkedBackend(t, tt.policy)
+
+			// Les boucles et le dossier interne ne sont jamais listes
+			files, err := b.List(context.Background(), "", true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(files)
+			if !reflect.DeepEqual(files, tt.want) {
+				t.Errorf("files = %v, want %v", files, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymlinkPolicyAccess(t *testing.T) {
+	read := func(b *LocalBackend, filePath string) error {
+		_, err := b.ReadString(context.Background(), filePath)
+		return err
+	}
+	write := func(b *LocalBackend, filePath string) error {
+		return b.WriteString(context.Background(), filePath, "written")
+	}
+
+	tests := []struct {
+		name     string
+		op       func(b *LocalBackend, filePath string) error
+		filePath string
+		want     map[string]error
+	}{
+		{"read file link", read, "file_link", map[string]error{
+			SYMLINK_FOLLOW: nil, SYMLINK_SKIP: backend.ErrNotExist, SYMLINK_FILE: nil, SYMLINK_REJECT_ESCAPING: nil,
+		}},
+		{"read through folder link", read, "dir_link/x.txt", map[string]error{
+			SYMLINK_FOLLOW: nil, SYMLINK_SKIP: backend.ErrNotExist, SYMLINK_FILE: backend.ErrNotExist, SYMLINK_REJECT_ESCAPING: nil,
+		}},
+		{"read escaping file link", read, "out_file", map[string]error{
+			SYMLINK_FOLLOW: nil, SYMLINK_SKIP: backend.ErrNotExist, SYMLINK_FILE: nil, SYMLINK_REJECT_ESCAPING: fs.ErrPermission,
+		}},
+		{"read through escaping folder link", read, "out_dir/y.txt", map[string]error{
+			SYMLINK_FOLLOW: nil, SYMLINK_SKIP: backend.ErrNotExist, SYMLINK_FILE: backend.ErrNotExist, SYMLINK_REJECT_ESCAPING: fs.ErrPermission,
+		}},
+		{"read through internal folder link", read, "meta_link/meta/m.json", map[string]error{
+			SYMLINK_FOLLOW: fs.ErrPermission, SYMLINK_SKIP: fs.ErrPermission, SYMLINK_FILE: fs.ErrPermission, SYMLINK_REJECT_ESCAPING: fs.ErrPermission,
+		}},
+		{"write file link", write, "file_link", map[string]error{
+			SYMLINK_FOLLOW: nil, SYMLINK_SKIP: fs.ErrPermission, SYMLINK_FILE: nil, SYMLINK_REJECT_ESCAPING: nil,
+		}},
+		{"write through escaping folder link", write, "out_dir/new.txt", map[string]error{
+			SYMLINK_FOLLOW: nil, SYMLINK_SKIP: fs.ErrPermission, SYMLINK_FILE: fs.ErrPermission, SYMLINK_REJECT_ESCAPING: fs.ErrPermission,
+		}},
+	}
+	for _, tt := range tests {
+		for policy, wantErr := range tt.want {
+			t.Run(tt.name+"/"+policy, func(t *testing.T) {
+				b, _ := newLinkedBackend(t, policy)
+				err := tt.op(b, tt.filePath)
+				if wantErr == nil && err != nil {
+					t.Errorf("error = %v, want nil", err)
+				} else if !errors.Is(err, wantErr) {
+					t.Errorf("error = %v, want %v", err, wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestReadlink(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   string
+		linkPath string
+		want     string
+		wantErr  error
+	}{
+		{"inside target", SYMLINK_FOLLOW, "file_link", "data/file.txt", nil},
+		{"not a link", SYMLINK_FOLLOW, "data/file.txt", "", fs.ErrInvalid},
+		{"missing link", SYMLINK_FOLLOW, "missing", "", backend.ErrNotExist},
+		{"internal folder link", SYMLINK_FOLLOW, "meta_link", "", fs.ErrPermission},
+		{"link in internal folder", SYMLINK_FOLLOW, META_FOLDER + "/meta/m.json", "", fs.ErrPermission},
+		{"skipped link", SYMLINK_SKIP, "file_link", "", backend.ErrNotExist},
+		{"file link", SYMLINK_FILE, "file_link", "data/file.txt", nil},
+		{"folder link ignored", SYMLINK_FILE, "dir_link", "", backend.ErrNotExist},
+		{"inside link", SYMLINK_REJECT_ESCAPING, "dir_link", "data/sub", nil},
+		{"escaping link rejected", SYMLINK_REJECT_ESCAPING, "out_file", "", fs.ErrPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newLinkedBackend(t, tt.policy)
+			target, err := b.Readlink(context.Background(), tt.linkPath)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if target != tt.want {
+				t.Errorf("target = %q, want %q", target, tt.want)
+			}
+		})
+	}
+
+	// Une cible en dehors du BasePath est renvoyee telle quelle
+	b, outside := newLinkedBackend(t, SYMLINK_FOLLOW)
+	if target, err := b.Readlink(context.Background(), "out_file"); err != nil || target != filepath.Join(outside, "secret.txt") {
+		t.Errorf("target = %q, %v, want %q", target, err, filepath.Join(outside, "secret.txt"))
+	}
+}
+
+func TestSymlink(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newLinkedBackend(t, SYMLINK_REJECT_ESCAPING)
+
+	// Le lien est relatif et resolu dans le BasePath
+	if err := b.Symlink(ctx, "/data/file.txt", "links/latest"); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(b.Config.BasePath, "links", "latest")); err != nil || target != filepath.Join("..", "data", "file.txt") {
+		t.Errorf("link target = %q, %v, want a relative target", target, err)
+	}
+	if content, err := b.ReadString(ctx, "links/latest"); err != nil || content != "inside" {
+		t.Errorf("content = %q, %v, want %q", content, err, "inside")
+	}
+	fInfo, err := b.Stat(ctx, "links/latest")
+	if err != nil || !fInfo.IsSymlink || fInfo.SymlinkTarget != "data/file.txt" {
+		t.Errorf("infos = %+v, %v, want a link to data/file.txt", fInfo, err)
+	}
+
+	tests := []struct {
+		name     string
+		target   string
+		linkPath string
+		wantErr  error
+	}{
+		{"existing link", "data/file.txt", "links/latest", fs.ErrExist},
+		{"internal folder target", META_FOLDER + "/meta/m.json", "meta", fs.ErrPermission},
+		{"link in internal folder", "data/file.txt", META_FOLDER + "/link", fs.ErrPermission},
+		{"link through escaping folder", "data/file.txt", "out_dir/link", fs.ErrPermission},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := b.Symlink(ctx, tt.target, tt.linkPath); !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEscapingPaths(t *testing.T) {
+	ctx := context.Background()
+	b, outside := newLinkedBackend(t, SYMLINK_REJECT_ESCAPING)
+	rel, err := filepath.Rel(b.Config.BasePath, outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel = filepath.ToSlash(rel)
+
+	// Les ".." ne remontent jamais au dessus du BasePath
+	if _, err := b.ReadString(ctx, rel+"/secret.txt"); !errors.Is(err, backend.ErrNotExist) {
+		t.Errorf("read error = %v, want %v", err, backend.ErrNotExist)
+	}
+	if err := b.WriteString(ctx, "../../escaped.txt", "written"); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := b.ReadString(ctx, "escaped.txt"); err != nil || content != "written" {
+		t.Errorf("content = %q, %v, want the file written in the BasePath", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(b.Config.BasePath), "escaped.txt")); !os.IsNotExist(err) {
+		t.Errorf("stat error = %v, want the file not written outside", err)
+	}
+	if err := b.Delete(ctx, rel+"/secret.txt"); err == nil {
+		t.Error("file outside the BasePath deleted")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "secret.txt")); err != nil {
+		t.Errorf("stat error = %v, want the outside file kept", err)
+	}
+
+	// Les ecritures a travers un lien sortant sont refusees et n'atteignent pas la cible
+	if err := b.WriteString(ctx, "out_dir/new.txt", "written"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("write error = %v, want %v", err, fs.ErrPermission)
+	}
+	if err := b.Move(ctx, "data/file.txt", "out_dir/moved.txt"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("move error = %v, want %v", err, fs.ErrPermission)
+	}
+	for _, name := range []string{"new.txt", "moved.txt"} {
+		if _, err := os.Stat(filepath.Join(outside, "dir", name)); !os.IsNotExist(err) {
+			t.Errorf("stat error = %v, want %s not written outside", err, name)
+		}
+	}
+
+	// Un lien sortant est refuse meme s'il est cree apres l'ouverture du backend
+	if err := os.Symlink(outside, filepath.Join(b.Config.BasePath, "data", "late")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Stat(ctx, "data/late/secret.txt"); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("stat error = %v, want %v", err, fs.ErrPermission)
+	}
+}
@@ -1,10 +1,19 @@
 package gofsbcklocal
 
 import (
+	"errors"
+	"io"
 	"mime"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/internal/iniconfig"
+	"github.com/craimbault/go-fs/internal/urlconfig"
 	"gopkg.in/ini.v1"
 )
 
@@ -47,13 +56,117 @@ func pathMustExists(path string) bool {
 	return exists
 }
 
-func addPrefixedPath(b *LocalBackend, path string) string {
-	return b.Config.BasePath + string(os.PathSeparator) + path
+func checkWriteOptions(opts backend.WriteOptions) error {
+	// Le chiffrement cote serveur n'est pas disponible, on refuse plutot que d'ecrire en clair
+	if opts.Encryption != nil && opts.Encryption.Mode != backend.ENCRYPTION_NONE {
+		return errors.New("server side encryption is not supported by the local backend")
+	}
+
+	return nil
 }
 
+// limitedReadCloser limite la lecture d'un fichier tout en permettant de le fermer
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func addPrefixedPath(b *LocalBackend, filePath string) string {
+	return b.Config.BasePath + string(os.PathSeparator) + cleanPath(filePath)
+}
+
+// cleanPath normalise le chemin relatif au BasePath, les ".." ne pouvant pas remonter au dessus
+func cleanPath(filePath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(filePath)), "/")
+}
+
+// NewConfigFromIniSection lit la section sans la verifier, une cle absente ou invalide prenant sa valeur par defaut
 func NewConfigFromIniSection(section *ini.Section) LocalConfig {
 	return LocalConfig{
-		BasePath: section.Key("base_path").MustString(""),
-		Debug:    section.Key("debug").MustBool(false),
+		BasePath:      section.Key("base_path").MustString(""),
+		Debug:         section.Key("debug").MustBool(false),
+		MaxVersions:   section.Key("max_versions").MustInt(0),
+		SymlinkPolicy: section.Key("symlinks").MustString(SYMLINK_FOLLOW),
+	}
+}
+
+// NewConfigFromIniSectionE lit la section en renvoyant une erreur si une cle obligatoire manque ou est invalide
+func NewConfigFromIniSectionE(section *ini.Section) (LocalConfig, error) {
+	// On initialise
+	config := LocalConfig{}
+	var err error
+
+	// On recupere les cles
+	if config.BasePath, err = iniconfig.RequiredString(section, "base_path"); err != nil {
+		return config, err
+	}
+	if config.Debug, err = iniconfig.Bool(section, "debug", false); err != nil {
+		return config, err
+	}
+	if config.MaxVersions, err = iniconfig.Int(section, "max_versions", 0); err != nil {
+		return config, err
 	}
+	config.SymlinkPolicy = iniconfig.String(section, "symlinks", SYMLINK_FOLLOW)
+	if err = validateSymlinkPolicy(config.SymlinkPolicy); err != nil {
+		return config, errors.New(err.Error() + " in section[" + section.Name() + "]")
+	}
+
+	return config, nil
+}
+
+// NewConfigFromURL lit une configuration de la forme file:///var/data?debug=true&max_versions=5&symlinks=skip
+func NewConfigFromURL(u *url.URL) (LocalConfig, error) {
+	// On initialise
+	query := u.Query()
+	config := LocalConfig{
+		BasePath: u.Path,
+	}
+	var err error
+
+	// On verifie les parametres
+	if err = urlconfig.CheckParams(query, "debug", "max_versions", "symlinks"); err != nil {
+		return config, err
+	}
+
+	// Un chemin relatif est indique sans slash (file:data)
+	if u.Opaque != "" {
+		config.BasePath = u.Opaque
+	} else if u.Host != "" {
+		return config, errors.New("file url must not have a host, use file:///" + u.Host + u.Path)
+	}
+	if config.BasePath == "" {
+		return config, errors.New("missing base path in file url")
+	}
+
+	// On recupere les options
+	if config.Debug, err = urlconfig.Bool(query, "debug", false); err != nil {
+		return config, err
+	}
+	if config.MaxVersions, err = urlconfig.Int(query, "max_versions", 0); err != nil {
+		return config, err
+	}
+	config.SymlinkPolicy = urlconfig.String(query, "symlinks", SYMLINK_FOLLOW)
+
+	return config, nil
+}
+
+// String renvoie la configuration sous forme d'URL
+func (c LocalConfig) String() string {
+	u := url.URL{
+		Scheme: "file",
+		Path:   c.BasePath,
+	}
+	query := url.Values{}
+	if c.Debug {
+		query.Set("debug", "true")
+	}
+	if c.MaxVersions > 0 {
+		query.Set("max_versions", strconv.Itoa(c.MaxVersions))
+	}
+	if c.SymlinkPolicy != "" && c.SymlinkPolicy != SYMLINK_FOLLOW {
+		query.Set("symlinks", c.SymlinkPolicy)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
 }
@@ -0,0 +1,332 @@
+package gofsbcklocal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// VERSION_ID_FORMAT donne des identifiants de version triables par ordre chronologique
+const VERSION_ID_FORMAT = "20060102T150405.000000000Z"
+
+func versionsFolderPath(b *LocalBackend, filePath string) string {
+	return b.Config.BasePath + string(os.PathSeparator) + META_FOLDER + string(os.PathSeparator) + "versions" + string(os.PathSeparator) + cleanPath(filePath)
+}
+
+// newVersionID renvoie un identifiant unique, toujours superieur au precedent
+func (b *LocalBackend) newVersionID() string {
+	b.Mu.Lock()
+	defer b.Mu.Unlock()
+
+	now := time.Now().UTC()
+	if !now.After(b.lastVersion) {
+		now = b.lastVersion.Add(time.Nanosecond)
+	}
+	b.lastVersion = now
+
+	return now.Format(VERSION_ID_FORMAT)
+}
+
+// currentVersionID renvoie l'identifiant de la version courante, deduit de sa date pour les fichiers
+// ecrits avant l'activation des versions
+func (b *LocalBackend) currentVersionID(filePath string, infos os.FileInfo) (string, error) {
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return "", err
+	}
+	if meta.VersionID != "" {
+		return meta.VersionID, nil
+	}
+
+	return infos.ModTime().UTC().Format(VERSION_ID_FORMAT), nil
+}
+
+// archiveVersion deplace le contenu courant du fichier dans le dossier des versions avant qu'il ne soit remplace
+func (b *LocalBackend) archiveVersion(filePath string) error {
+	// Si les versions ne sont pas conservees ou que le fichier n'existe pas, on a rien a faire
+	if b.Config.MaxVersions <= 0 {
+		return nil
+	}
+	infos, err := os.Stat(addPrefixedPath(b, filePath))
+	if os.IsNotExist(err) || (err == nil && infos.IsDir()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// On deplace le contenu
+	versionID, err := b.currentVersionID(filePath, infos)
+	if err != nil {
+		return errors.New("unable to read file metadata : " + err.Error())
+	}
+	versionsPath := versionsFolderPath(b, filePath)
+	if err = createFolder(versionsPath); err != nil {
+		return err
+	}
+	if err = os.Rename(addPrefixedPath(b, filePath), versionsPath+string(os.PathSeparator)+versionID); err != nil {
+		return errors.New("unable to archive file version : " + err.Error())
+	}
+
+	// On ne garde que les dernieres versions
+	return b.pruneVersions(filePath)
+}
+
+// setVersion enregistre un nouvel identifiant pour le contenu qui vient d'etre ecrit
+func (b *LocalBackend) setVersion(filePath string) error {
+	if b.Config.MaxVersions <= 0 {
+		return nil
+	}
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return err
+	}
+	meta.VersionID = b.newVersionID()
+
+	return b.writeMeta(filePath, meta)
+}
+
+// archivedVersions renvoie les identifiants des versions archivees, de la plus recente a la plus ancienne
+func (b *LocalBackend) archivedVersions(filePath string) ([]string, error) {
+	entries, err := os.ReadDir(versionsFolderPath(b, filePath))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	versionIDs := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			versionIDs = append(versionIDs, entry.Name())
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(versionIDs)))
+
+	return versionIDs, nil
+}
+
+func (b *LocalBackend) pruneVersions(filePath string) error {
+	versionIDs, err := b.archivedVersions(filePath)
+	if err != nil {
+		return err
+	}
+	for i := b.Config.MaxVersions; i < len(versionIDs); i++ {
+		if err = os.Remove(versionsFolderPath(b, filePath) + string(os.PathSeparator) + versionIDs[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purgeVersions supprime toutes les versions archivees du fichier
+func (b *LocalBackend) purgeVersions(filePath string) error {
+	if err := os.RemoveAll(versionsFolderPath(b, filePath)); err != nil {
+		return errors.New("unable to purge file versions : " + err.Error())
+	}
+
+	return nil
+}
+
+func (b *LocalBackend) ListVersions(ctx context.Context, filePath string) ([]backend.Version, error) {
+	b.logger.Debug().
+		Str("op", "ListVersions").
+		Str("path", addPrefixedPath(b, filePath)).
+		Send()
+
+	// Le dossier interne du backend n'est pas accessible
+	if err := b.checkMetaPath("listversions", filePath); err != nil {
+		return nil, err
+	}
+
+	// On ajoute la version courante
+	versions := make([]backend.Version, 0)
+	infos, err := os.Stat(addPrefixedPath(b, filePath))
+	if err == nil && !infos.IsDir() {
+		versionID, err := b.currentVersionID(filePath, infos)
+		if err != nil {
+			return nil, errors.New("unable to read file metadata : " + err.Error())
+		}
+		versions = append(versions, backend.Version{
+			VersionID:    versionID,
+			Size:         infos.Size(),
+			LastModified: infos.ModTime(),
+			IsLatest:     true,
+		})
+	}
+
+	// Puis les versions archivees
+	versionIDs, err := b.archivedVersions(filePath)
+	if err != nil {
+		return nil, errors.New("unable to list file versions : " + err.Error())
+	}
+	for _, versionID := range versionIDs {
+		versionInfos, err := os.Stat(versionsFolderPath(b, filePath) + string(os.PathSeparator) + versionID)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, backend.Version{
+			VersionID:    versionID,
+			Size:         versionInfos.Size(),
+			LastModified: versionInfos.ModTime(),
+		})
+	}
+
+	if len(versions) == 0 {
+		return nil, backend.ErrNotExist
+	}
+	return versions, nil
+}
+
+func (b *LocalBackend) ReadVersion(ctx context.Context, filePath string, versionID string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	b.logger.Debug().
+		Str("op", "ReadVersion").
+		Str("path", addPrefixedPath(b, filePath)).
+		Str("version", versionID).
+		Send()
+
+	// Le dossier interne du backend n'est pas accessible
+	if err := b.checkMetaPath("readversion", filePath); err != nil {
+		return backend.FileStream{}, err
+	}
+
+	// Si l'on demande la version courante
+	if infos, err := os.Stat(addPrefixedPath(b, filePath)); err == nil && !infos.IsDir() {
+		currentID, err := b.currentVersionID(filePath, infos)
+		if err != nil {
+			return backend.FileStream{}, errors.New("unable to read file metadata : " + err.Error())
+		}
+		if currentID == versionID {
+			return b.ReadStream(ctx, filePath, opts...)
+		}
+	}
+
+	// Sinon on ouvre la version archivee
+	versionPath, err := b.versionPath(filePath, versionID)
+	if err != nil {
+		return backend.FileStream{}, err
+	}
+	fd, err := os.Open(versionPath)
+	if os.IsNotExist(err) {
+		return backend.FileStream{}, backend.ErrNotExist
+	} else if err != nil {
+		return backend.FileStream{}, errors.New("unable to read file version : " + err.Error())
+	}
+	fileStream, err := openStream(fd, backend.MergeReadOptions(opts))
+	fileStream.ContentType = guessContentTypeFromFileExtention(filePath)
+
+	return fileStream, err
+}
+
+func (b *LocalBackend) DeleteVersion(ctx context.Context, filePath string, versionID string) error {
+	b.logger.Debug().
+		Str("op", "DeleteVersion").
+		Str("path", addPrefixedPath(b, filePath)).
+		Str("version", versionID).
+		Send()
+
+	// Le dossier interne du backend n'est pas accessible
+	if err := b.checkMetaPath("deleteversion", filePath); err != nil {
+		return err
+	}
+
+	// Si l'on supprime la version courante, la plus recente des versions archivees la remplace
+	if infos, err := os.Stat(addPrefixedPath(b, filePath)); err == nil && !infos.IsDir() {
+		currentID, err := b.currentVersionID(filePath, infos)
+		if err != nil {
+			return errors.New("unable to read file metadata : " + err.Error())
+		}
+		if currentID == versionID {
+			if err = b.checkLock(filePath); err != nil {
+				return err
+			}
+			return b.restoreLatestVersion(filePath)
+		}
+	}
+
+	// Sinon on supprime la version archivee
+	versionPath, err := b.versionPath(filePath, versionID)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(versionPath)
+	if os.IsNotExist(err) {
+		return backend.ErrNotExist
+	}
+
+	return err
+}
+
+// restoreLatestVersion remplace le fichier courant par sa version archivee la plus recente
+func (b *LocalBackend) restoreLatestVersion(filePath string) error {
+	versionIDs, err := b.archivedVersions(filePath)
+	if err != nil {
+		return err
+	}
+
+	// S'il n'y a pas de version precedente, le fichier est supprime
+	if len(versionIDs) == 0 {
+		if err = os.Remove(addPrefixedPath(b, filePath)); err != nil {
+			return err
+		}
+		return b.deleteMeta(filePath)
+	}
+
+	// Sinon on la remet en place
+	if err = os.Rename(versionsFolderPath(b, filePath)+string(os.PathSeparator)+versionIDs[0], addPrefixedPath(b, filePath)); err != nil {
+		return errors.New("unable to restore file version : " + err.Error())
+	}
+	meta, err := b.readMeta(filePath)
+	if err != nil {
+		return err
+	}
+	meta.VersionID = versionIDs[0]
+
+	return b.writeMeta(filePath, meta)
+}
+
+// versionPath renvoie le chemin d'une version archivee, en refusant les identifiants qui en sortiraient
+func (b *LocalBackend) versionPath(filePath string, versionID string) (string, error) {
+	if versionID == "" || versionID == "." || versionID == ".." || strings.ContainsAny(versionID, `/\`) {
+		return "", errors.New("invalid version id[" + versionID + "]")
+	}
+
+	return versionsFolderPath(b, filePath) + string(os.PathSeparator) + versionID, nil
+}
+
+// openStream renvoie le contenu d'un fichier ouvert, limite a la partie demandee
+func openStream(fd *os.File, readOpts backend.ReadOptions) (backend.FileStream, error) {
+	// On recupere la taille
+	fileStream := backend.FileStream{Content: fd}
+	infos, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return fileStream, err
+	}
+	fileStream.Size = infos.Size()
+
+	// Si l'on ne lit qu'une partie du fichier
+	if readOpts.Offset > 0 || readOpts.Length > 0 {
+		if readOpts.Offset > infos.Size() {
+			fd.Close()
+			return fileStream, errors.New("read offset is beyond the end of file")
+		}
+		if _, err = fd.Seek(readOpts.Offset, io.SeekStart); err != nil {
+			fd.Close()
+			return fileStream, errors.New("unable to seek file : " + err.Error())
+		}
+		fileStream.Size = infos.Size() - readOpts.Offset
+		if readOpts.Length > 0 && readOpts.Length < fileStream.Size {
+			fileStream.Size = readOpts.Length
+		}
+		fileStream.Content = limitedReadCloser{io.LimitReader(fd, fileStream.Size), fd}
+	}
+
+	return fileStream, nil
+}
@@ -0,0 +1,180 @@
+package gofsbcklocal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// newTestBackend initialise un backend local dans un dossier temporaire
+func newTestBackend(t *testing.T, config LocalConfig) *LocalBackend {
+	t.Helper()
+	config.BasePath = t.TempDir()
+	b, err := New(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// readVersion renvoie le contenu d'une version
+func readVersion(t *testing.T, b *LocalBackend, filePath string, versionID string, opts ...backend.ReadOptions) string {
+	t.Helper()
+	fileStream, err := b.ReadVersion(context.Background(), filePath, versionID, opts...)
+	if err != nil {
+		t.Fatalf("read version[%s] : %v", versionID, err)
+	}
+	defer fileStream.Content.Close()
+	content, err := io.ReadAll(fileStream.Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(content)
+}
+
+func TestListVersions(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t, LocalConfig{MaxVersions: 2})
+	for _, content := range []string{"v1", "v2-", "v3--", "v4---"} {
+		if err := b.WriteString(ctx, "file", content); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// La version courante puis les plus recentes versions archivees, dans la limite de MaxVersions
+	versions, err := b.ListVersions(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"v4---", "v3--", "v2-"}
+	if len(versions) != len(want) {
+		t.Fatalf("versions = %+v, want %d versions", versions, len(want))
+	}
+	for i, version := range versions {
+		if version.IsLatest != (i == 0) {
+			t.Errorf("version[%d] latest = %v, want %v", i, version.IsLatest, i == 0)
+		}
+		if version.Size != int64(len(want[i])) {
+			t.Errorf("version[%d] size = %d, want %d", i, version.Size, len(want[i]))
+		}
+		if got := readVersion(t, b, "file", version.VersionID); got != want[i] {
+			t.Errorf("version[%d] content = %q, want %q", i, got, want[i])
+		}
+	}
+
+	// La version courante est celle indiquee par Stat
+	fInfo, err := b.Stat(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fInfo.VersionID != versions[0].VersionID {
+		t.Errorf("stat version = %s, want %s", fInfo.VersionID, versions[0].VersionID)
+	}
+
+	// Une version archivee peut etre lue en partie
+	if got := readVersion(t, b, "file", versions[1].VersionID, backend.ReadOptions{Offset: 1, Length: 2}); got != "3-" {
+		t.Errorf("range content = %q, want %q", got, "3-")
+	}
+}
+
+func TestReadVersionErrors(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t, LocalConfig{MaxVersions: 2})
+	if err := b.WriteString(ctx, "file", "content"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		filePath  string
+		versionID string
+		wantErr   error
+	}{
+		{"unknown version", "file", "00000000000000000000-0000", backend.ErrNotExist},
+		{"missing file", "missing", "00000000000000000000-0000", backend.ErrNotExist},
+		{"version escaping the folder", "file", "../../../file", nil},
+		{"empty version", "file", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := b.ReadVersion(ctx, tt.filePath, tt.versionID)
+			if err == nil || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+	if _, err := b.ListVersions(ctx, "missing"); !errors.Is(err, backend.ErrNotExist) {
+		t.Errorf("list versions error = %v, want %v", err, backend.ErrNotExist)
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t, LocalConfig{MaxVersions: 5})
+	for _, content := range []string{"v1", "v2", "v3"} {
+		if err := b.WriteString(ctx, "file", content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions, err := b.ListVersions(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Supprimer la version courante remet en place la precedente
+	if err = b.DeleteVersion(ctx, "file", versions[0].VersionID); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := b.ReadString(ctx, "file"); err != nil || content != "v2" {
+		t.Errorf("content = %q, %v, want %q", content, err, "v2")
+	}
+	restored, err := b.ListVersions(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(restored) != 2 || restored[0].VersionID != versions[1].VersionID || !restored[0].IsLatest {
+		t.Errorf("versions = %+v, want %s as the latest of 2 versions", restored, versions[1].VersionID)
+	}
+
+	// Une version plus ancienne est restauree en la reecrivant, la version courante etant archivee
+	if err = b.WriteString(ctx, "file", readVersion(t, b, "file", versions[2].VersionID)); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := b.ReadString(ctx, "file"); err != nil || content != "v1" {
+		t.Errorf("content = %q, %v, want %q", content, err, "v1")
+	}
+	if restored, err = b.ListVersions(ctx, "file"); err != nil || len(restored) != 3 {
+		t.Errorf("versions = %+v, %v, want 3 versions", restored, err)
+	}
+
+	// Un fichier supprime reste dans ses versions et peut etre restaure
+	if err = b.Delete(ctx, "file"); err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := b.ListVersions(ctx, "file")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted) != 3 || deleted[0].IsLatest {
+		t.Fatalf("versions = %+v, want 3 archived versions", deleted)
+	}
+	if err = b.WriteString(ctx, "file", readVersion(t, b, "file", deleted[0].VersionID)); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := b.ReadString(ctx, "file"); err != nil || content != "v1" {
+		t.Errorf("content = %q, %v, want %q", content, err, "v1")
+	}
+
+	// Une version archivee peut etre supprimee
+	if err = b.DeleteVersion(ctx, "file", deleted[2].VersionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = b.ReadVersion(ctx, "file", deleted[2].VersionID); !errors.Is(err, backend.ErrNotExist) {
+		t.Errorf("read deleted version error = %v, want %v", err, backend.ErrNotExist)
+	}
+}
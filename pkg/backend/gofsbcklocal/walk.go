@@ -0,0 +1,66 @@
+package gofsbcklocal
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// ReadDir lit un seul niveau du dossier, sans le dossier interne du backend
+func (b *LocalBackend) ReadDir(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+	// On initialise
+	dir = backend.CleanDir(dir)
+	prefixedPath := addPrefixedPath(b, dir)
+
+	b.logger.Debug().
+		Str("op", "ReadDir").
+		Str("path", prefixedPath).
+		Send()
+
+	// On applique la politique des liens au dossier
+	if dir != "." {
+		if err := b.checkPath("readdir", dir, false); err != nil {
+			return nil, err
+		}
+	}
+
+	// On lit le dossier
+	entries, err := os.ReadDir(prefixedPath)
+	if os.IsNotExist(err) {
+		return nil, backend.ErrNotExist
+	} else if err != nil {
+		return nil, err
+	}
+	filtered := entries[:0]
+	var ancestors map[string]bool
+	for _, entry := range entries {
+		// On ignore le dossier interne du backend
+		if dir == "." && entry.IsDir() && entry.Name() == META_FOLDER {
+			continue
+		}
+
+		// Un lien est presente comme sa cible, sauf s'il est ignore ou forme une boucle
+		if entry.Type()&fs.ModeSymlink != 0 {
+			entryPath := filepath.Join(prefixedPath, entry.Name())
+			info, ok := b.followLink(entryPath)
+			if !ok {
+				continue
+			}
+			if info.IsDir() {
+				if ancestors == nil {
+					ancestors = b.ancestorsOf(dir)
+				}
+				if realTarget, err := filepath.EvalSymlinks(entryPath); err != nil || ancestors[realTarget] {
+					continue
+				}
+			}
+			entry = fs.FileInfoToDirEntry(info)
+		}
+		filtered = append(filtered, entry)
+	}
+
+	return filtered, nil
+}
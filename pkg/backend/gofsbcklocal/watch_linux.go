@@ -0,0 +1,263 @@
+//go:build linux
+
+package gofsbcklocal
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"golang.org/x/sys/unix"
+)
+
+// WATCH_MASK regroupe les evenements inotify suivis sur chaque dossier
+const WATCH_MASK = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// inotifyWatch suit les dossiers concernes par le prefixe, les chemins sont relatifs au BasePath
+type inotifyWatch struct {
+	b      *LocalBackend
+	fd     int
+	file   *os.File
+	prefix string
+	// Dossier de chaque watch
+	dirs map[int]string
+	// Fichiers existants, afin de distinguer une creation d'une modification
+	known  map[string]bool
+	events chan backend.Event
+}
+
+// Watch suit les changements avec inotify, ou compare des listings successifs si inotify n'est pas disponible.
+// Seuls les changements de contenu sont notifies, pas ceux des metadonnees
+func (b *LocalBackend) Watch(ctx context.Context, prefix string, opts backend.WatchOptions) (<-chan backend.Event, error) {
+	b.logger.Debug().
+		Str("op", "Watch").
+		Str("path", addPrefixedPath(b, prefix)).
+		Send()
+
+	// Le dossier interne du backend n'est pas accessible
+	if err := b.checkMetaPath("watch", prefix); err != nil {
+		return nil, err
+	}
+
+	// On initialise inotify, le descripteur non bloquant permet d'interrompre la lecture en le fermant
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		b.logger.Warn().
+			Err(err).
+			Msg("Unable to init inotify, falling back to polling")
+		return backend.PollBackend(ctx, b, prefix, opts.PollInterval)
+	}
+	w := &inotifyWatch{
+		b:      b,
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		prefix: strings.TrimPrefix(filepath.ToSlash(prefix), "/"),
+		dirs:   make(map[int]string),
+		known:  make(map[string]bool),
+		events: make(chan backend.Event, backend.WATCH_BUFFER_SIZE),
+	}
+
+	// On suit l'arborescence existante
+	files, err := w.addTree("")
+	if err != nil {
+		w.file.Close()
+		return nil, errors.New("unable to watch folder[" + b.Config.BasePath + "] : " + err.Error())
+	}
+	for _, file := range files {
+		w.known[file] = true
+	}
+
+	// On ferme le descripteur a l'annulation du contexte, ce qui interrompt la lecture
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		w.file.Close()
+	}()
+	go func() {
+		defer close(w.events)
+		defer close(done)
+		w.read(ctx)
+	}()
+
+	return w.events, nil
+}
+
+// relevantDir indique si le dossier peut contenir des fichiers concernes par le prefixe
+func (w *inotifyWatch) relevantDir(dir string) bool {
+	if dir == META_FOLDER || strings.HasPrefix(dir, META_FOLDER+"/") {
+		return false
+	}
+	return dir == "" || strings.HasPrefix(dir+"/", w.prefix) || strings.HasPrefix(w.prefix, dir+"/")
+}
+
+// addTree suit le dossier et ses sous dossiers concernes, et renvoie les fichiers concernes qu'ils contiennent
+func (w *inotifyWatch) addTree(dir string) ([]string, error) {
+	files := make([]string, 0)
+	root := filepath.Join(w.b.Config.BasePath, filepath.FromSlash(dir))
+	err := filepath.Walk(root, func(currentPath string, info os.FileInfo, err error) error {
+		// Un sous dossier supprime ou inaccessible est ignore
+		if err != nil {
+			if currentPath == root {
+				return err
+			}
+			return nil
+		}
+		rel, _ := filepath.Rel(w.b.Config.BasePath, currentPath)
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		if info.IsDir() {
+			if !w.relevantDir(rel) {
+				return filepath.SkipDir
+			}
+			wd, err := unix.InotifyAddWatch(w.fd, currentPath, WATCH_MASK)
+			if err != nil {
+				return err
+			}
+			w.dirs[wd] = rel
+		} else if strings.HasPrefix(rel, w.prefix) {
+			files = append(files, rel)
+		}
+		return nil
+	})
+
+	return files, err
+}
+
+// read traite les evenements inotify jusqu'a la fermeture du descripteur
+func (w *inotifyWatch) read(ctx context.Context) {
+	buf := make([]byte, 64*unix.SizeofInotifyEvent+unix.PathMax)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		// On decoupe les evenements
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			raw := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[nameStart:nameStart+int(raw.Len)]), "\x00")
+			offset = nameStart + int(raw.Len)
+
+			if !w.handle(ctx, int(raw.Wd), raw.Mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// handle convertit un evenement inotify, false si le contexte est annule
+func (w *inotifyWatch) handle(ctx context.Context, wd int, mask uint32, name string) bool {
+	// Des evenements ont ete perdus, on compare l'etat actuel aux fichiers connus
+	if mask&unix.IN_Q_OVERFLOW != 0 {
+		w.b.logger.Warn().
+			Msg("Inotify queue overflow, rescanning")
+		return w.rescan(ctx)
+	}
+
+	// Le dossier n'est plus suivi
+	if mask&unix.IN_IGNORED != 0 {
+		delete(w.dirs, wd)
+		return true
+	}
+	dir, exists := w.dirs[wd]
+	if !exists || name == "" {
+		return true
+	}
+	rel := name
+	if dir != "" {
+		rel = dir + "/" + name
+	}
+
+	// Pour un dossier, on suit son contenu ou on supprime ses fichiers
+	if mask&unix.IN_ISDIR != 0 {
+		if !w.relevantDir(rel) {
+			return true
+		}
+		if mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+			files, _ := w.addTree(rel)
+			for _, file := range files {
+				if !w.changed(ctx, file) {
+					return false
+				}
+			}
+		} else if mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0 {
+			for file := range w.known {
+				if strings.HasPrefix(file, rel+"/") && !w.deleted(ctx, file) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	// Pour un fichier, la creation est notifiee une fois le fichier ferme
+	if !strings.HasPrefix(rel, w.prefix) {
+		return true
+	}
+	switch {
+	case mask&(unix.IN_CLOSE_WRITE|unix.IN_MOVED_TO) != 0:
+		return w.changed(ctx, rel)
+	case mask&(unix.IN_DELETE|unix.IN_MOVED_FROM) != 0:
+		return w.deleted(ctx, rel)
+	}
+
+	return true
+}
+
+// changed notifie la creation ou la modification du fichier
+func (w *inotifyWatch) changed(ctx context.Context, file string) bool {
+	fInfo, err := w.b.Stat(ctx, file)
+	if err != nil {
+		return true
+	}
+	event := backend.Event{Type: backend.EVENT_MODIFY, Path: file, Info: fInfo, Time: time.Now()}
+	if !w.known[file] {
+		event.Type = backend.EVENT_CREATE
+		w.known[file] = true
+	}
+
+	return backend.SendEvent(ctx, w.events, event)
+}
+
+// deleted notifie la suppression du fichier
+func (w *inotifyWatch) deleted(ctx context.Context, file string) bool {
+	if !w.known[file] {
+		return true
+	}
+	delete(w.known, file)
+
+	return backend.SendEvent(ctx, w.events, backend.Event{Type: backend.EVENT_DELETE, Path: file, Time: time.Now()})
+}
+
+// rescan notifie les differences entre l'arborescence et les fichiers connus
+func (w *inotifyWatch) rescan(ctx context.Context) bool {
+	files, err := w.addTree("")
+	if err != nil {
+		return true
+	}
+	current := make(map[string]bool, len(files))
+	for _, file := range files {
+		current[file] = true
+		if !w.known[file] && !w.changed(ctx, file) {
+			return false
+		}
+	}
+	for file := range w.known {
+		if !current[file] && !w.deleted(ctx, file) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,24 @@
+//go:build !linux
+
+package gofsbcklocal
+
+import (
+	"context"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// Watch compare des listings successifs, inotify n'etant disponible que sous Linux
+func (b *LocalBackend) Watch(ctx context.Context, prefix string, opts backend.WatchOptions) (<-chan backend.Event, error) {
+	b.logger.Debug().
+		Str("op", "Watch").
+		Str("path", addPrefixedPath(b, prefix)).
+		Send()
+
+	// Le dossier interne du backend n'est pas accessible
+	if err := b.checkMetaPath("watch", prefix); err != nil {
+		return nil, err
+	}
+
+	return backend.PollBackend(ctx, b, prefix, opts.PollInterval)
+}
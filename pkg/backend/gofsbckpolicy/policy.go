@@ -0,0 +1,314 @@
+package gofsbckpolicy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// Actions controlees par les regles
+const (
+	ACTION_LIST   = "list"
+	ACTION_READ   = "read"
+	ACTION_WRITE  = "write"
+	ACTION_MOVE   = "move"
+	ACTION_DELETE = "delete"
+	ACTION_ALL    = "*"
+)
+
+type Effect string
+
+const (
+	EFFECT_ALLOW Effect = "allow"
+	EFFECT_DENY  Effect = "deny"
+)
+
+// ACTIONS liste les actions reconnues
+var ACTIONS = []string{ACTION_LIST, ACTION_READ, ACTION_WRITE, ACTION_MOVE, ACTION_DELETE}
+
+// Rule autorise ou interdit des actions sur les chemins correspondant a l'un des motifs.
+// Un motif termine par "/" est un prefixe, un motif contenant "/" est un glob sur le chemin complet,
+// sinon c'est un glob sur le nom du fichier ("*" correspond donc a tous les fichiers)
+type Rule struct {
+	Effect   Effect
+	Actions  []string
+	Patterns []string
+}
+
+type PolicyConfig struct {
+	Rules []Rule
+	// Effet applique lorsqu'aucune regle ne correspond, EFFECT_DENY par defaut
+	Default Effect
+}
+
+// ReadOnly renvoie une politique n'autorisant que le listing et la lecture
+func ReadOnly() PolicyConfig {
+	return PolicyConfig{
+		Rules: []Rule{
+			{Effect: EFFECT_ALLOW, Actions: []string{ACTION_LIST, ACTION_READ}, Patterns: []string{"*"}},
+		},
+		Default: EFFECT_DENY,
+	}
+}
+
+// PolicyBackend verifie chaque appel au backend suivant selon les regles configurees.
+// Une regle deny l'emporte sur une regle allow, les violations renvoient une erreur fs.ErrPermission
+type PolicyBackend struct {
+	Config PolicyConfig
+	next   backend.Backend
+}
+
+func New(next backend.Backend, config PolicyConfig) (*PolicyBackend, error) {
+	// On applique les valeurs par defaut
+	if config.Default == "" {
+		config.Default = EFFECT_DENY
+	}
+
+	// On verifie la configuration
+	if next == nil {
+		return nil, errors.New("missing backend to protect")
+	}
+	if err := validateEffect(config.Default); err != nil {
+		return nil, err
+	}
+	for _, rule := range config.Rules {
+		if err := validateEffect(rule.Effect); err != nil {
+			return nil, err
+		}
+		if len(rule.Actions) == 0 || len(rule.Patterns) == 0 {
+			return nil, errors.New("policy rule must have actions and patterns")
+		}
+		for _, action := range rule.Actions {
+			if err := validateAction(action); err != nil {
+				return nil, err
+			}
+		}
+		for _, pattern := range rule.Patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, errors.New("invalid policy pattern[" + pattern + "] : " + err.Error())
+			}
+		}
+	}
+
+	return &PolicyBackend{
+		Config: config,
+		next:   next,
+	}, nil
+}
+
+// Allowed indique si l'action est autorisee sur le chemin
+func (b *PolicyBackend) Allowed(action string, filePath string) bool {
+	// On normalise le chemin
+	filePath = strings.TrimPrefix(path.Clean("/"+filePath), "/")
+
+	// On cherche les regles correspondantes, deny l'emportant
+	matched := false
+	for _, rule := range b.Config.Rules {
+		if !rule.matches(action, filePath) {
+			continue
+		}
+		if rule.Effect == EFFECT_DENY {
+			return false
+		}
+		matched = true
+	}
+	if matched {
+		return true
+	}
+
+	return b.Config.Default == EFFECT_ALLOW
+}
+
+func (b *PolicyBackend) List(ctx context.Context, dirPath string, recursive bool) ([]string, error) {
+	files, err := b.next.List(ctx, dirPath, recursive)
+	if err != nil {
+		return files, err
+	}
+
+	// On ne renvoie que les fichiers pouvant etre listes
+	allowed := make([]string, 0, len(files))
+	for _, file := range files {
+		if b.Allowed(ACTION_LIST, path.Join(dirPath, file)) {
+			allowed = append(allowed, file)
+		}
+	}
+
+	return allowed, nil
+}
+
+func (b *PolicyBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	if err := b.check("stat", ACTION_READ, filePath); err != nil {
+		return backend.FileInfo{}, err
+	}
+	return b.next.Stat(ctx, filePath)
+}
+
+func (b *PolicyBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	if err := b.check("read", ACTION_READ, filePath); err != nil {
+		return nil, err
+	}
+	return b.next.Read(ctx, filePath)
+}
+
+func (b *PolicyBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	if err := b.check("read", ACTION_READ, filePath); err != nil {
+		return "", err
+	}
+	return b.next.ReadString(ctx, filePath)
+}
+
+func (b *PolicyBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	if err := b.check("read", ACTION_READ, filePath); err != nil {
+		return backend.FileStream{}, err
+	}
+	return b.next.ReadStream(ctx, filePath, opts...)
+}
+
+func (b *PolicyBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	if err := b.check("write", ACTION_WRITE, filePath); err != nil {
+		return err
+	}
+	return b.next.Write(ctx, filePath, data, opts...)
+}
+
+func (b *PolicyBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	if err := b.check("write", ACTION_WRITE, filePath); err != nil {
+		return err
+	}
+	return b.next.WriteString(ctx, filePath, content, opts...)
+}
+
+func (b *PolicyBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	if err := b.check("write", ACTION_WRITE, filePath); err != nil {
+		// Le backend aurait consomme le stream, on le ferme
+		stream.Close()
+		return err
+	}
+	return b.next.WriteStream(ctx, filePath, stream, length, opts...)
+}
+
+func (b *PolicyBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// La copie lit la source et ecrit la destination
+	if err := b.check("copy", ACTION_READ, filePathSrc); err != nil {
+		return err
+	}
+	if err := b.check("copy", ACTION_WRITE, filePathDst); err != nil {
+		return err
+	}
+	return b.next.Copy(ctx, filePathSrc, filePathDst)
+}
+
+func (b *PolicyBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// Le deplacement retire la source et ecrit la destination
+	if err := b.check("move", ACTION_MOVE, filePathSrc); err != nil {
+		return err
+	}
+	if err := b.check("move", ACTION_WRITE, filePathDst); err != nil {
+		return err
+	}
+	return b.next.Move(ctx, filePathSrc, filePathDst)
+}
+
+func (b *PolicyBackend) Delete(ctx context.Context, filePath string) error {
+	if err := b.check("delete", ACTION_DELETE, filePath); err != nil {
+		return err
+	}
+	return b.next.Delete(ctx, filePath)
+}
+
+func (b *PolicyBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	if err := b.check("setmetadata", ACTION_WRITE, filePath); err != nil {
+		return err
+	}
+	return b.next.SetMetadata(ctx, filePath, metadata)
+}
+
+// ListExpired ne renvoie que les fichiers expires pouvant etre listes
+func (b *PolicyBackend) ListExpired(ctx context.Context, dirPath string, now time.Time) ([]string, error) {
+	files, err := backend.ListExpired(ctx, b.next, dirPath, now)
+	if err != nil {
+		return files, err
+	}
+
+	// On ne renvoie que les fichiers pouvant etre listes
+	allowed := make([]string, 0, len(files))
+	for _, file := range files {
+		if b.Allowed(ACTION_LIST, file) {
+			allowed = append(allowed, file)
+		}
+	}
+
+	return allowed, nil
+}
+
+// check renvoie une erreur fs.ErrPermission si l'action n'est pas autorisee
+func (b *PolicyBackend) check(op string, action string, filePath string) error {
+	if b.Allowed(action, filePath) {
+		return nil
+	}
+	return &fs.PathError{Op: op, Path: filePath, Err: fs.ErrPermission}
+}
+
+func (r Rule) matches(action string, filePath string) bool {
+	// On verifie l'action
+	hasAction := false
+	for _, ruleAction := range r.Actions {
+		if ruleAction == action || ruleAction == ACTION_ALL {
+			hasAction = true
+			break
+		}
+	}
+	if !hasAction {
+		return false
+	}
+
+	// On verifie les motifs
+	for _, pattern := range r.Patterns {
+		if matchPattern(pattern, filePath) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPattern(pattern string, filePath string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	// Prefixe
+	if strings.HasSuffix(pattern, "/") {
+		return strings.HasPrefix(filePath, pattern)
+	}
+
+	// Glob sur le chemin complet ou sur le nom du fichier
+	name := filePath
+	if !strings.Contains(pattern, "/") {
+		name = path.Base(filePath)
+	}
+	matched, _ := path.Match(pattern, name)
+	return matched
+}
+
+func validateEffect(effect Effect) error {
+	if effect != EFFECT_ALLOW && effect != EFFECT_DENY {
+		return errors.New("invalid policy effect[" + string(effect) + "]")
+	}
+	return nil
+}
+
+func validateAction(action string) error {
+	if action == ACTION_ALL {
+		return nil
+	}
+	for _, known := range ACTIONS {
+		if action == known {
+			return nil
+		}
+	}
+	return errors.New("invalid policy action[" + action + "]")
+}
@@ -0,0 +1,144 @@
+package gofsbckpolicy
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+// newTestBackend protege un backend local dans un dossier temporaire
+func newTestBackend(t *testing.T, config PolicyConfig) (*PolicyBackend, *gofsbcklocal.LocalBackend) {
+	t.Helper()
+	local, err := gofsbcklocal.New(gofsbcklocal.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := New(local, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b, local
+}
+
+func TestAllowed(t *testing.T) {
+	rules := []Rule{
+		{Effect: EFFECT_ALLOW, Actions: []string{ACTION_LIST, ACTION_READ}, Patterns: []string{"*"}},
+		{Effect: EFFECT_ALLOW, Actions: []string{ACTION_WRITE, ACTION_DELETE}, Patterns: []string{"uploads/"}},
+		{Effect: EFFECT_DENY, Actions: []string{ACTION_ALL}, Patterns: []string{"uploads/private/"}},
+		{Effect: EFFECT_DENY, Actions: []string{ACTION_READ}, Patterns: []string{"*.key"}},
+		{Effect: EFFECT_ALLOW, Actions: []string{ACTION_DELETE}, Patterns: []string{"tmp/*.log"}},
+	}
+
+	tests := []struct {
+		name          string
+		defaultEffect Effect
+		action        string
+		filePath      string
+		want          bool
+	}{
+		{"name glob", "", ACTION_READ, "docs/readme.md", true},
+		{"name glob at root", "", ACTION_LIST, "readme.md", true},
+		{"prefix", "", ACTION_WRITE, "uploads/file.txt", true},
+		{"nested prefix", "", ACTION_DELETE, "uploads/a/b/file.txt", true},
+		{"path glob", "", ACTION_DELETE, "tmp/app.log", true},
+		{"leading slash", "", ACTION_WRITE, "/uploads/file.txt", true},
+		{"no matching rule", "", ACTION_WRITE, "docs/readme.md", false},
+		{"no matching action", "", ACTION_MOVE, "uploads/file.txt", false},
+		{"path glob does not cross folders", "", ACTION_DELETE, "tmp/sub/app.log", false},
+		{"prefix needs the folder", "", ACTION_WRITE, "uploads", false},
+		{"cleaned path escaping the prefix", "", ACTION_WRITE, "uploads/../docs/readme.md", false},
+		{"deny wins over allow", "", ACTION_READ, "docs/server.key", false},
+		{"deny prefix wins over allow prefix", "", ACTION_WRITE, "uploads/private/file.txt", false},
+		{"deny all actions", "", ACTION_LIST, "uploads/private/file.txt", false},
+		{"default allow", EFFECT_ALLOW, ACTION_MOVE, "docs/readme.md", true},
+		{"deny wins over default allow", EFFECT_ALLOW, ACTION_READ, "docs/server.key", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := newTestBackend(t, PolicyConfig{Rules: rules, Default: tt.defaultEffect})
+			if got := b.Allowed(tt.action, tt.filePath); got != tt.want {
+				t.Errorf("Allowed(%s, %s) = %v, want %v", tt.action, tt.filePath, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name   string
+		config PolicyConfig
+	}{
+		{"invalid default", PolicyConfig{Default: "maybe"}},
+		{"invalid effect", PolicyConfig{Rules: []Rule{{Effect: "maybe", Actions: []string{ACTION_READ}, Patterns: []string{"*"}}}}},
+		{"missing actions", PolicyConfig{Rules: []Rule{{Effect: EFFECT_ALLOW, Patterns: []string{"*"}}}}},
+		{"missing patterns", PolicyConfig{Rules: []Rule{{Effect: EFFECT_ALLOW, Actions: []string{ACTION_READ}}}}},
+		{"invalid action", PolicyConfig{Rules: []Rule{{Effect: EFFECT_ALLOW, Actions: []string{"chmod"}, Patterns: []string{"*"}}}}},
+		{"invalid pattern", PolicyConfig{Rules: []Rule{{Effect: EFFECT_ALLOW, Actions: []string{ACTION_READ}, Patterns: []string{"[a"}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(&gofsbcklocal.LocalBackend{}, tt.config); err == nil {
+				t.Error("invalid config accepted")
+			}
+		})
+	}
+	if _, err := New(nil, ReadOnly()); err == nil {
+		t.Error("missing backend accepted")
+	}
+}
+
+func TestPolicyBackend(t *testing.T) {
+	ctx := context.Background()
+	b, local := newTestBackend(t, PolicyConfig{Rules: []Rule{
+		{Effect: EFFECT_ALLOW, Actions: []string{ACTION_LIST, ACTION_READ}, Patterns: []string{"public/"}},
+		{Effect: EFFECT_ALLOW, Actions: []string{ACTION_WRITE, ACTION_MOVE}, Patterns: []string{"inbox/"}},
+	}})
+	for _, filePath := range []string{"public/a.txt", "public/b.txt", "private/c.txt", "inbox/d.txt"} {
+		if err := local.Write(ctx, filePath, []byte("content")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		op        func() error
+		wantAllow bool
+	}{
+		{"read allowed", func() error { _, err := b.Read(ctx, "public/a.txt"); return err }, true},
+		{"read denied", func() error { _, err := b.Read(ctx, "private/c.txt"); return err }, false},
+		{"stat denied", func() error { _, err := b.Stat(ctx, "inbox/d.txt"); return err }, false},
+		{"write allowed", func() error { return b.Write(ctx, "inbox/e.txt", []byte("content")) }, true},
+		{"write denied", func() error { return b.Write(ctx, "public/e.txt", []byte("content")) }, false},
+		{"copy to allowed destination", func() error { return b.Copy(ctx, "public/a.txt", "inbox/a.txt") }, true},
+		{"copy from unreadable source", func() error { return b.Copy(ctx, "private/c.txt", "inbox/c.txt") }, false},
+		{"move from unmovable source", func() error { return b.Move(ctx, "public/b.txt", "inbox/b.txt") }, false},
+		{"delete denied", func() error { return b.Delete(ctx, "inbox/d.txt") }, false},
+		{"set metadata denied", func() error { return b.SetMetadata(ctx, "public/a.txt", map[string]string{"k": "v"}) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.op()
+			if tt.wantAllow && err != nil {
+				t.Errorf("error = %v, want nil", err)
+			} else if !tt.wantAllow && !errors.Is(err, fs.ErrPermission) {
+				t.Errorf("error = %v, want %v", err, fs.ErrPermission)
+			}
+		})
+	}
+
+	// Le listing ne renvoie que les fichiers pouvant etre listes
+	files, err := b.List(ctx, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	if want := []string{"public/a.txt", "public/b.txt"}; !reflect.DeepEqual(files, want) {
+		t.Errorf("files = %v, want %v", files, want)
+	}
+}
@@ -0,0 +1,62 @@
+package gofsbckpolicy
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/craimbault/go-fs/internal/iniconfig"
+	"gopkg.in/ini.v1"
+)
+
+// NewConfigFromIniSection lit la politique d'une section ini, sous la forme
+//
+//	read_only = true
+//	policy_default = deny
+//	policy_allow_read = public/, *.pdf
+//	policy_deny_delete = *
+//
+// Les cles policy_<allow|deny>_<action> contiennent des motifs separes par des virgules.
+// Renvoie false si la section ne definit aucune politique
+func NewConfigFromIniSection(section *ini.Section) (PolicyConfig, bool, error) {
+	// Le mode lecture seule remplace les autres regles
+	readOnly, err := iniconfig.Bool(section, "read_only", false)
+	if err != nil {
+		return PolicyConfig{}, false, err
+	}
+	if readOnly {
+		return ReadOnly(), true, nil
+	}
+
+	// On recupere les regles, deny avant allow pour un ordre stable
+	config := PolicyConfig{Default: Effect(iniconfig.String(section, "policy_default", string(EFFECT_DENY)))}
+	defined := section.HasKey("policy_default")
+	for _, effect := range []Effect{EFFECT_DENY, EFFECT_ALLOW} {
+		for _, action := range []string{ACTION_LIST, ACTION_READ, ACTION_WRITE, ACTION_MOVE, ACTION_DELETE, "all"} {
+			key := "policy_" + string(effect) + "_" + action
+			if !section.HasKey(key) {
+				continue
+			}
+			defined = true
+
+			// On decoupe les motifs
+			patterns := make([]string, 0)
+			for _, pattern := range strings.Split(section.Key(key).String(), ",") {
+				if pattern = strings.TrimSpace(pattern); pattern != "" {
+					patterns = append(patterns, pattern)
+				}
+			}
+			if len(patterns) == 0 {
+				return config, false, errors.New("missing patterns for key[" + key + "] in section[" + section.Name() + "]")
+			}
+			if action == "all" {
+				action = ACTION_ALL
+			}
+			config.Rules = append(config.Rules, Rule{Effect: effect, Actions: []string{action}, Patterns: patterns})
+		}
+	}
+	if err = validateEffect(config.Default); err != nil {
+		return config, false, errors.New(err.Error() + " in section[" + section.Name() + "]")
+	}
+
+	return config, defined, nil
+}
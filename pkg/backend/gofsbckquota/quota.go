@@ -0,0 +1,451 @@
+package gofsbckquota
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/rs/zerolog"
+)
+
+// ErrQuotaExceeded est renvoyee, via QuotaError, lorsqu'une ecriture depasserait une limite
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaError indique la limite depassee, elle est compatible avec errors.Is(err, ErrQuotaExceeded)
+type QuotaError struct {
+	Path   string
+	Reason string
+}
+
+func (e *QuotaError) Error() string {
+	return "quota exceeded for file[" + e.Path + "] : " + e.Reason
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Limit s'applique a l'ensemble des fichiers sous le prefixe, 0 pour ne pas limiter
+type Limit struct {
+	Prefix   string
+	MaxBytes int64
+	MaxFiles int64
+}
+
+type QuotaConfig struct {
+	Limits []Limit
+	// Taille maximum d'un fichier, quel que soit son chemin, 0 pour ne pas limiter
+	MaxFileSize int64
+	// Dossier ou sont copies les envois de taille inconnue avant d'etre verifies, celui du systeme par defaut
+	TempDir string
+	// Active les logs de debug de l'instance
+	Debug bool
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
+}
+
+// Usage est l'occupation d'un prefixe
+type Usage struct {
+	Bytes int64
+	Files int64
+}
+
+// QuotaBackend refuse les ecritures qui depasseraient les limites configurees.
+// L'occupation des prefixes est calculee au demarrage puis tenue a jour a chaque appel
+type QuotaBackend struct {
+	Config QuotaConfig
+	next   backend.Backend
+	logger zerolog.Logger
+	mu     sync.Mutex
+	// Taille de chaque fichier sous un prefixe limite
+	sizes map[string]int64
+	usage []Usage
+}
+
+func New(next backend.Backend, config QuotaConfig) (*QuotaBackend, error) {
+	// On normalise les prefixes
+	for i := range config.Limits {
+		config.Limits[i].Prefix = strings.TrimPrefix(config.Limits[i].Prefix, "/")
+	}
+
+	// On verifie la configuration
+	if next == nil {
+		return nil, errors.New("missing backend to limit")
+	}
+	if config.MaxFileSize < 0 {
+		return nil, errors.New("invalid max file size[" + strconv.FormatInt(config.MaxFileSize, 10) + "]")
+	}
+	for _, limit := range config.Limits {
+		if limit.MaxBytes < 0 || limit.MaxFiles < 0 {
+			return nil, errors.New("invalid limit for prefix[" + limit.Prefix + "]")
+		}
+	}
+
+	// On calcule l'occupation actuelle
+	b := &QuotaBackend{
+		Config: config,
+		next:   next,
+		logger: backend.NewLogger(config.Logger, "quota", config.Debug),
+	}
+	if err := b.Rescan(context.Background()); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Rescan recalcule l'occupation des prefixes en listant leurs fichiers
+func (b *QuotaBackend) Rescan(ctx context.Context) error {
+	// On recupere la taille de chaque fichier
+	sizes := make(map[string]int64)
+	for _, limit := range b.Config.Limits {
+		files, err := b.next.List(ctx, limit.Prefix, true)
+		if err != nil {
+			return errors.New("unable to list prefix[" + limit.Prefix + "] : " + err.Error())
+		}
+		for _, file := range files {
+			filePath := normalizePath(path.Join(limit.Prefix, file))
+			if _, exists := sizes[filePath]; exists {
+				continue
+			}
+			fInfo, err := b.next.Stat(ctx, filePath)
+			if err != nil {
+				return errors.New("unable to stat file[" + filePath + "] : " + err.Error())
+			}
+			sizes[filePath] = fInfo.Size
+		}
+	}
+
+	// On en deduit l'occupation
+	usage := make([]Usage, len(b.Config.Limits))
+	for filePath, size := range sizes {
+		for i, limit := range b.Config.Limits {
+			if strings.HasPrefix(filePath, limit.Prefix) {
+				usage[i].Bytes += size
+				usage[i].Files++
+			}
+		}
+	}
+
+	b.mu.Lock()
+	b.sizes = sizes
+	b.usage = usage
+	b.mu.Unlock()
+
+	// On informe
+	b.logger.Debug().
+		Int("files", len(sizes)).
+		Msg("Quota usage rebuilt")
+
+	return nil
+}
+
+// Usage renvoie l'occupation d'un prefixe configure
+func (b *QuotaBackend) Usage(prefix string) (Usage, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	prefix = strings.TrimPrefix(prefix, "/")
+	for i, limit := range b.Config.Limits {
+		if limit.Prefix == prefix {
+			return b.usage[i], nil
+		}
+	}
+
+	return Usage{}, errors.New("prefix[" + prefix + "] has no quota")
+}
+
+func (b *QuotaBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	return b.next.List(ctx, path, recursive)
+}
+
+func (b *QuotaBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	return b.next.Stat(ctx, filePath)
+}
+
+func (b *QuotaBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	return b.next.Read(ctx, filePath)
+}
+
+func (b *QuotaBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	return b.next.ReadString(ctx, filePath)
+}
+
+func (b *QuotaBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	return b.next.ReadStream(ctx, filePath, opts...)
+}
+
+func (b *QuotaBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	// On reserve la place avant d'ecrire
+	if err := b.reserve(filePath, int64(len(data)), ""); err != nil {
+		return err
+	}
+	err := b.next.Write(ctx, filePath, data, opts...)
+	b.commit(ctx, filePath, int64(len(data)), err)
+
+	return err
+}
+
+func (b *QuotaBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	// On utilise la methode existante
+	return b.Write(ctx, filePath, []byte(content), opts...)
+}
+
+func (b *QuotaBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	// Si la taille est inconnue, on copie l'envoi dans un fichier temporaire afin de la connaitre
+	// sans toucher au fichier existant, l'envoi etant interrompu des que la place disponible est depassee
+	if length < 0 {
+		spool, size, err := b.spool(filePath, stream)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(spool.Name())
+		stream, length = spool, size
+	}
+
+	// On reserve la place avant d'ecrire
+	if err := b.reserve(filePath, length, ""); err != nil {
+		stream.Close()
+		return err
+	}
+	err := b.next.WriteStream(ctx, filePath, stream, length, opts...)
+	b.commit(ctx, filePath, length, err)
+
+	return err
+}
+
+// spool copie le flux dans un fichier temporaire, relu depuis le debut, et renvoie sa taille
+func (b *QuotaBackend) spool(filePath string, stream io.ReadCloser) (*os.File, int64, error) {
+	defer stream.Close()
+
+	// On cree le fichier temporaire
+	spool, err := os.CreateTemp(b.Config.TempDir, "gofs-quota-*")
+	if err != nil {
+		return nil, 0, errors.New("unable to create temporary file : " + err.Error())
+	}
+
+	// On copie au plus un octet de plus que la place disponible
+	available := b.available(filePath)
+	reader := io.Reader(stream)
+	if available >= 0 {
+		reader = io.LimitReader(stream, available+1)
+	}
+	size, err := io.Copy(spool, reader)
+	if err == nil && available >= 0 && size > available {
+		err = &QuotaError{Path: filePath, Reason: "available space[" + strconv.FormatInt(available, 10) + "] exceeded"}
+	}
+	if err == nil {
+		_, err = spool.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		spool.Close()
+		os.Remove(spool.Name())
+		return nil, 0, err
+	}
+
+	return spool, size, nil
+}
+
+func (b *QuotaBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// On recupere la taille de la source
+	size, err := b.sizeOf(ctx, filePathSrc)
+	if err != nil {
+		return err
+	}
+
+	// On reserve la place de la destination
+	if err = b.reserve(filePathDst, size, ""); err != nil {
+		return err
+	}
+	err = b.next.Copy(ctx, filePathSrc, filePathDst)
+	b.commit(ctx, filePathDst, size, err)
+
+	return err
+}
+
+func (b *QuotaBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// On recupere la taille de la source
+	size, err := b.sizeOf(ctx, filePathSrc)
+	if err != nil {
+		return err
+	}
+
+	// On reserve la place de la destination en tenant compte de la source, liberee apres le deplacement
+	if err = b.reserve(filePathDst, size, filePathSrc); err != nil {
+		return err
+	}
+	err = b.next.Move(ctx, filePathSrc, filePathDst)
+	b.commit(ctx, filePathDst, size, err)
+	if err == nil {
+		b.remove(filePathSrc)
+	}
+
+	return err
+}
+
+func (b *QuotaBackend) Delete(ctx context.Context, filePath string) error {
+	err := b.next.Delete(ctx, filePath)
+	if err == nil {
+		b.remove(filePath)
+	}
+	return err
+}
+
+func (b *QuotaBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	return b.next.SetMetadata(ctx, filePath, metadata)
+}
+
+// ListExpired transmet la recherche des fichiers expires au backend decore
+func (b *QuotaBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	return backend.ListExpired(ctx, b.next, path, now)
+}
+
+// reserve verifie les limites et ajoute la nouvelle taille du fichier a l'occupation.
+// releasedPath est un fichier qui sera supprime par l'operation (source d'un deplacement), vide sinon
+func (b *QuotaBackend) reserve(filePath string, size int64, releasedPath string) error {
+	// On verifie la taille du fichier
+	if b.Config.MaxFileSize > 0 && size > b.Config.MaxFileSize {
+		return &QuotaError{Path: filePath, Reason: "size[" + strconv.FormatInt(size, 10) + "] is over max file size[" + strconv.FormatInt(b.Config.MaxFileSize, 10) + "]"}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// On verifie chaque prefixe concerne
+	filePath = normalizePath(filePath)
+	oldSize, exists := b.sizes[filePath]
+	newFiles := int64(1)
+	if exists {
+		newFiles = 0
+	}
+	releasedPath = normalizePath(releasedPath)
+	releasedSize, released := b.sizes[releasedPath]
+	for i, limit := range b.Config.Limits {
+		if !strings.HasPrefix(filePath, limit.Prefix) {
+			continue
+		}
+		newBytes := size - oldSize
+		limitFiles := newFiles
+		if released && releasedPath != filePath && strings.HasPrefix(releasedPath, limit.Prefix) {
+			newBytes -= releasedSize
+			limitFiles--
+		}
+		if limit.MaxBytes > 0 && newBytes > 0 && b.usage[i].Bytes+newBytes > limit.MaxBytes {
+			return &QuotaError{Path: filePath, Reason: "max bytes[" + strconv.FormatInt(limit.MaxBytes, 10) + "] of prefix[" + limit.Prefix + "] reached"}
+		}
+		if limit.MaxFiles > 0 && limitFiles > 0 && b.usage[i].Files+limitFiles > limit.MaxFiles {
+			return &QuotaError{Path: filePath, Reason: "max files[" + strconv.FormatInt(limit.MaxFiles, 10) + "] of prefix[" + limit.Prefix + "] reached"}
+		}
+	}
+
+	// On reserve la place
+	b.set(filePath, size)
+
+	return nil
+}
+
+// commit enregistre la taille finale du fichier, ou la relit depuis le backend si l'ecriture a echoue
+func (b *QuotaBackend) commit(ctx context.Context, filePath string, size int64, err error) {
+	if err != nil {
+		// Le fichier a pu etre ecrit en partie ou pas du tout
+		fInfo, statErr := b.next.Stat(ctx, filePath)
+		if statErr != nil {
+			b.remove(filePath)
+			return
+		}
+		size = fInfo.Size
+	}
+
+	b.mu.Lock()
+	b.set(normalizePath(filePath), size)
+	b.mu.Unlock()
+}
+
+// available renvoie la place restante pour le fichier, -1 si elle n'est pas limitee.
+// Elle ne sert qu'a interrompre un envoi de taille inconnue, reserve faisant la verification definitive
+func (b *QuotaBackend) available(filePath string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	filePath = normalizePath(filePath)
+	oldSize := b.sizes[filePath]
+	available := b.Config.MaxFileSize
+	if available == 0 {
+		available = -1
+	}
+	for i, limit := range b.Config.Limits {
+		if limit.MaxBytes == 0 || !strings.HasPrefix(filePath, limit.Prefix) {
+			continue
+		}
+		remaining := limit.MaxBytes - b.usage[i].Bytes + oldSize
+		if remaining < 0 {
+			remaining = 0
+		}
+		if available < 0 || remaining < available {
+			available = remaining
+		}
+	}
+
+	return available
+}
+
+// sizeOf renvoie la taille d'un fichier, depuis l'index si possible
+func (b *QuotaBackend) sizeOf(ctx context.Context, filePath string) (int64, error) {
+	b.mu.Lock()
+	size, exists := b.sizes[normalizePath(filePath)]
+	b.mu.Unlock()
+	if exists {
+		return size, nil
+	}
+
+	fInfo, err := b.next.Stat(ctx, filePath)
+	return fInfo.Size, err
+}
+
+func (b *QuotaBackend) remove(filePath string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	filePath = normalizePath(filePath)
+	oldSize, exists := b.sizes[filePath]
+	if !exists {
+		return
+	}
+	for i, limit := range b.Config.Limits {
+		if strings.HasPrefix(filePath, limit.Prefix) {
+			b.usage[i].Bytes -= oldSize
+			b.usage[i].Files--
+		}
+	}
+	delete(b.sizes, filePath)
+}
+
+// set remplace la taille d'un fichier dans l'index et l'occupation, le verrou doit etre pris
+func (b *QuotaBackend) set(filePath string, size int64) {
+	oldSize, exists := b.sizes[filePath]
+	tracked := false
+	for i, limit := range b.Config.Limits {
+		if !strings.HasPrefix(filePath, limit.Prefix) {
+			continue
+		}
+		tracked = true
+		b.usage[i].Bytes += size - oldSize
+		if !exists {
+			b.usage[i].Files++
+		}
+	}
+	if tracked {
+		b.sizes[filePath] = size
+	}
+}
+
+func normalizePath(filePath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filePath), "/")
+}
@@ -0,0 +1,214 @@
+package gofsbckquota
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+// newTestBackend limite un backend local dans un dossier temporaire
+func newTestBackend(t *testing.T, config QuotaConfig) *QuotaBackend {
+	t.Helper()
+	local, err := gofsbcklocal.New(gofsbcklocal.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.TempDir = t.TempDir()
+	b, err := New(local, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return b
+}
+
+// unknownLength masque la taille du contenu, comme un envoi en streaming
+type unknownLength struct {
+	io.Reader
+}
+
+func (unknownLength) Close() error {
+	return nil
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	type step struct {
+		op       string
+		path     string
+		size     int
+		wantErr  bool
+		wantUsed Usage
+	}
+	tests := []struct {
+		name   string
+		config QuotaConfig
+		steps  []step
+	}{
+		{
+			name:   "max bytes",
+			config: QuotaConfig{Limits: []Limit{{Prefix: "data/", MaxBytes: 10}}},
+			steps: []step{
+				{op: "write", path: "data/a", size: 6, wantUsed: Usage{Bytes: 6, Files: 1}},
+				{op: "write", path: "data/b", size: 5, wantErr: true, wantUsed: Usage{Bytes: 6, Files: 1}},
+				{op: "write", path: "data/b", size: 4, wantUsed: Usage{Bytes: 10, Files: 2}},
+				{op: "write", path: "other/c", size: 50, wantUsed: Usage{Bytes: 10, Files: 2}},
+			},
+		},
+		{
+			name:   "overwrite only counts the difference",
+			config: QuotaConfig{Limits: []Limit{{Prefix: "data/", MaxBytes: 10}}},
+			steps: []step{
+				{op: "write", path: "data/a", size: 8, wantUsed: Usage{Bytes: 8, Files: 1}},
+				{op: "write", path: "data/a", size: 10, wantUsed: Usage{Bytes: 10, Files: 1}},
+				{op: "write", path: "data/a", size: 2, wantUsed: Usage{Bytes: 2, Files: 1}},
+			},
+		},
+		{
+			name:   "max files and delete",
+			config: QuotaConfig{Limits: []Limit{{Prefix: "data/", MaxFiles: 2}}},
+			steps: []step{
+				{op: "write", path: "data/a", size: 1, wantUsed: Usage{Bytes: 1, Files: 1}},
+				{op: "write", path: "data/b", size: 1, wantUsed: Usage{Bytes: 2, Files: 2}},
+				{op: "write", path: "data/c", size: 1, wantErr: true, wantUsed: Usage{Bytes: 2, Files: 2}},
+				{op: "delete", path: "data/a", wantUsed: Usage{Bytes: 1, Files: 1}},
+				{op: "write", path: "data/c", size: 1, wantUsed: Usage{Bytes: 2, Files: 2}},
+			},
+		},
+		{
+			name:   "max file size",
+			config: QuotaConfig{MaxFileSize: 4, Limits: []Limit{{Prefix: "", MaxBytes: 100}}},
+			steps: []step{
+				{op: "write", path: "a", size: 4, wantUsed: Usage{Bytes: 4, Files: 1}},
+				{op: "write", path: "b", size: 5, wantErr: true, wantUsed: Usage{Bytes: 4, Files: 1}},
+				{op: "stream", path: "b", size: 5, wantErr: true, wantUsed: Usage{Bytes: 4, Files: 1}},
+			},
+		},
+		{
+			name:   "unknown length stream",
+			config: QuotaConfig{Limits: []Limit{{Prefix: "data/", MaxBytes: 10}}},
+			steps: []step{
+				{op: "stream", path: "data/a", size: 7, wantUsed: Usage{Bytes: 7, Files: 1}},
+				{op: "stream", path: "data/b", size: 4, wantErr: true, wantUsed: Usage{Bytes: 7, Files: 1}},
+				{op: "stream", path: "data/a", size: 10, wantUsed: Usage{Bytes: 10, Files: 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBackend(t, tt.config)
+			for i, s := range tt.steps {
+				var err error
+				switch s.op {
+				case "write":
+					err = b.Write(ctx, s.path, bytes.Repeat([]byte("x"), s.size))
+				case "stream":
+					err = b.WriteStream(ctx, s.path, unknownLength{bytes.NewReader(bytes.Repeat([]byte("x"), s.size))}, -1)
+				case "delete":
+					err = b.Delete(ctx, s.path)
+				}
+				if s.wantErr && !errors.Is(err, ErrQuotaExceeded) {
+					t.Fatalf("step %d : error = %v, want %v", i, err, ErrQuotaExceeded)
+				} else if !s.wantErr && err != nil {
+					t.Fatalf("step %d : unexpected error : %v", i, err)
+				}
+				used, err := b.Usage(tt.config.Limits[0].Prefix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if used != s.wantUsed {
+					t.Fatalf("step %d : usage = %+v, want %+v", i, used, s.wantUsed)
+				}
+			}
+		})
+	}
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	const writers, fileSize, maxFits = 20, 10, 5
+
+	tests := []struct {
+		name  string
+		write func(b *QuotaBackend, filePath string, data []byte) error
+	}{
+		{"write", func(b *QuotaBackend, filePath string, data []byte) error {
+			return b.Write(ctx, filePath, data)
+		}},
+		{"known length stream", func(b *QuotaBackend, filePath string, data []byte) error {
+			return b.WriteStream(ctx, filePath, io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+		}},
+		{"unknown length stream", func(b *QuotaBackend, filePath string, data []byte) error {
+			return b.WriteStream(ctx, filePath, unknownLength{bytes.NewReader(data)}, -1)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBackend(t, QuotaConfig{Limits: []Limit{{Prefix: "data/", MaxBytes: maxFits*fileSize + fileSize/2}}})
+
+			// On ecrit en parallele plus que la limite
+			var wg sync.WaitGroup
+			results := make([]error, writers)
+			for i := 0; i < writers; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = tt.write(b, "data/"+strconv.Itoa(i), bytes.Repeat([]byte("x"), fileSize))
+				}(i)
+			}
+			wg.Wait()
+
+			// Seules les ecritures tenant dans la limite ont reussi
+			succeeded := 0
+			for i, err := range results {
+				if err == nil {
+					succeeded++
+				} else if !errors.Is(err, ErrQuotaExceeded) {
+					t.Errorf("writer %d : unexpected error : %v", i, err)
+				}
+			}
+			if succeeded != maxFits {
+				t.Errorf("succeeded = %d, want %d", succeeded, maxFits)
+			}
+
+			// L'occupation correspond aux fichiers ecrits, y compris apres un nouveau calcul
+			want := Usage{Bytes: int64(succeeded * fileSize), Files: int64(succeeded)}
+			if used, _ := b.Usage("data/"); used != want {
+				t.Errorf("usage = %+v, want %+v", used, want)
+			}
+			if err := b.Rescan(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if used, _ := b.Usage("data/"); used != want {
+				t.Errorf("usage after rescan = %+v, want %+v", used, want)
+			}
+		})
+	}
+}
+
+func TestStreamOverQuotaKeepsFile(t *testing.T) {
+	ctx := context.Background()
+	b := newTestBackend(t, QuotaConfig{Limits: []Limit{{Prefix: "data/", MaxBytes: 10}}})
+	if err := b.Write(ctx, "data/a", []byte("original")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Un envoi trop gros ne doit pas tronquer le fichier existant
+	err := b.WriteStream(ctx, "data/a", unknownLength{bytes.NewReader(bytes.Repeat([]byte("x"), 11))}, -1)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("error = %v, want %v", err, ErrQuotaExceeded)
+	}
+	got, err := b.Read(ctx, "data/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "original" {
+		t.Errorf("content = %q, want %q", got, "original")
+	}
+}
@@ -0,0 +1,337 @@
+package gofsbckreplica
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+type repairOp string
+
+const (
+	OP_WRITE  repairOp = "write"
+	OP_DELETE repairOp = "delete"
+)
+
+// repairTask decrit la derniere operation d'un fichier que certaines replicas ont manquee
+type repairTask struct {
+	op repairOp
+	// Replica a jour servant de source pour les ecritures
+	source  int
+	missing map[int]bool
+	// Permet de savoir si une operation plus recente a remplace la tache
+	generation uint64
+}
+
+// record enregistre les replicas ayant manque une operation reussie, une operation plus recente remplacant la precedente
+func (b *ReplicaBackend) record(filePath string, op repairOp, results []error) {
+	// On separe les succes des echecs
+	source := -1
+	missing := make(map[int]bool)
+	for i, err := range results {
+		if err != nil {
+			missing[i] = true
+		} else if source < 0 {
+			source = i
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Si toutes les replicas sont a jour, il n'y a plus rien a reparer
+	if len(missing) == 0 {
+		delete(b.pending, filePath)
+		return
+	}
+
+	// Si le quorum n'est pas atteint, l'operation est en echec pour l'appelant et n'est donc pas propagee,
+	// Resync permettant de realigner les replicas l'ayant recue
+	if len(results)-len(missing) < b.Config.WriteQuorum {
+		return
+	}
+
+	// Sinon on enregistre la reparation
+	b.generation++
+	b.pending[filePath] = &repairTask{
+		op:         op,
+		source:     source,
+		missing:    missing,
+		generation: b.generation,
+	}
+}
+
+// staleReplicas renvoie les replicas qui n'ont pas encore recu la derniere operation du fichier
+func (b *ReplicaBackend) staleReplicas(filePath string) map[int]bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, exists := b.pending[filePath]
+	if !exists {
+		return nil
+	}
+	stale := make(map[int]bool, len(task.missing))
+	for i := range task.missing {
+		stale[i] = true
+	}
+
+	return stale
+}
+
+// PendingRepairs renvoie le nombre de fichiers en attente de reparation
+func (b *ReplicaBackend) PendingRepairs() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.pending)
+}
+
+// Repair rejoue les operations manquees sur chaque replica et renvoie le nombre de fichiers restant a reparer
+func (b *ReplicaBackend) Repair(ctx context.Context) (int, error) {
+	// On recupere une copie des taches
+	b.mu.Lock()
+	tasks := make(map[string]repairTask, len(b.pending))
+	for filePath, task := range b.pending {
+		missing := make(map[int]bool, len(task.missing))
+		for i := range task.missing {
+			missing[i] = true
+		}
+		tasks[filePath] = repairTask{op: task.op, source: task.source, missing: missing, generation: task.generation}
+	}
+	b.mu.Unlock()
+
+	// On repare chaque replica
+	var errs []string
+	for filePath, task := range tasks {
+		for i := range task.missing {
+			if ctx.Err() != nil {
+				return b.PendingRepairs(), ctx.Err()
+			}
+			err := b.repair(ctx, filePath, task, i)
+			if err != nil {
+				errs = append(errs, filePath+" on replica["+strconv.Itoa(i)+"] : "+err.Error())
+				continue
+			}
+			b.repaired(filePath, task.generation, i)
+		}
+	}
+
+	// On renvoie ce qu'il reste
+	if len(errs) > 0 {
+		return b.PendingRepairs(), errors.New("unable to repair " + strings.Join(errs, ", "))
+	}
+
+	return b.PendingRepairs(), nil
+}
+
+func (b *ReplicaBackend) repair(ctx context.Context, filePath string, task repairTask, i int) error {
+	replica := b.replicas[i]
+
+	// Pour une suppression, un fichier deja absent est repare
+	if task.op == OP_DELETE {
+		if err := replica.Delete(ctx, filePath); err != nil && !isNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	// Pour une ecriture, on copie le fichier depuis la replica a jour
+	source := b.replicas[task.source]
+	fInfo, err := source.Stat(ctx, filePath)
+	if isNotExist(err) {
+		// Le fichier a ete supprime depuis, il n'y a plus rien a copier
+		return nil
+	} else if err != nil {
+		return errors.New("unable to stat source replica : " + err.Error())
+	}
+	fileStream, err := source.ReadStream(ctx, filePath)
+	if err != nil {
+		return errors.New("unable to read source replica : " + err.Error())
+	}
+	defer fileStream.Content.Close()
+
+	return replica.WriteStream(ctx, filePath, fileStream.Content, fileStream.Size, repairWriteOptions(fInfo))
+}
+
+// repairWriteOptions conserve les metadonnees et l'expiration du fichier copie
+func repairWriteOptions(fInfo backend.FileInfo) backend.WriteOptions {
+	opts := backend.WriteOptions{Metadata: fInfo.Metadata}
+	if !fInfo.ExpiresAt.IsZero() {
+		expiresAt := fInfo.ExpiresAt
+		opts.ExpiresAt = &expiresAt
+	}
+
+	return opts
+}
+
+// repaired retire la replica de la tache, si aucune operation plus recente ne l'a remplacee
+func (b *ReplicaBackend) repaired(filePath string, taskGeneration uint64, i int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	task, exists := b.pending[filePath]
+	if !exists || task.generation != taskGeneration {
+		return
+	}
+	delete(task.missing, i)
+	if len(task.missing) == 0 {
+		delete(b.pending, filePath)
+	}
+
+	b.logger.Debug().
+		Str("op", "Repair").
+		Int("replica", i).
+		Str("path", filePath).
+		Send()
+}
+
+func (b *ReplicaBackend) repairLoop() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.Config.RepairInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			if b.PendingRepairs() == 0 {
+				continue
+			}
+			remaining, err := b.Repair(context.Background())
+			if err != nil {
+				b.logger.Warn().
+					Int("remaining", remaining).
+					Err(err).
+					Msg("Repair failed")
+			}
+		}
+	}
+}
+
+// Resync realigne toutes les replicas sur la replica source, sans s'appuyer sur les reparations en memoire :
+// les fichiers absents ou de taille differente sont copies, ceux absents de la source sont supprimes.
+// Il renvoie le nombre de fichiers copies ou supprimes, et doit etre appele quand les replicas ne sont pas ecrites,
+// par exemple au demarrage apres une interruption
+func (b *ReplicaBackend) Resync(ctx context.Context, source int) (int, error) {
+	// On verifie la source
+	if source < 0 || source >= len(b.replicas) {
+		return 0, errors.New("invalid source replica[" + strconv.Itoa(source) + "]")
+	}
+	b.mu.Lock()
+	generation := b.generation
+	b.mu.Unlock()
+
+	// On recupere les fichiers de la source
+	srcFiles, err := b.listInfos(ctx, b.replicas[source])
+	if err != nil {
+		return 0, errors.New("unable to list source replica[" + strconv.Itoa(source) + "] : " + err.Error())
+	}
+
+	// On realigne chaque replica
+	synced := 0
+	var errs []string
+	for i := range b.replicas {
+		if i == source {
+			continue
+		}
+		count, err := b.resyncReplica(ctx, source, i, srcFiles)
+		synced += count
+		if err != nil {
+			errs = append(errs, "replica["+strconv.Itoa(i)+"] : "+err.Error())
+			continue
+		}
+		b.resynced(i, generation)
+	}
+
+	if len(errs) > 0 {
+		return synced, errors.New("unable to resync " + strings.Join(errs, ", "))
+	}
+	return synced, nil
+}
+
+func (b *ReplicaBackend) resyncReplica(ctx context.Context, source int, i int, srcFiles map[string]backend.FileInfo) (int, error) {
+	// On recupere les fichiers de la replica
+	dstFiles, err := b.listInfos(ctx, b.replicas[i])
+	if err != nil {
+		return 0, errors.New("unable to list : " + err.Error())
+	}
+
+	// On copie les fichiers manquants ou differents
+	synced := 0
+	var errs []string
+	for filePath, srcInfo := range srcFiles {
+		if ctx.Err() != nil {
+			return synced, ctx.Err()
+		}
+		if dstInfo, exists := dstFiles[filePath]; exists && dstInfo.Size == srcInfo.Size {
+			continue
+		}
+		if err := b.repair(ctx, filePath, repairTask{op: OP_WRITE, source: source}, i); err != nil {
+			errs = append(errs, filePath+" : "+err.Error())
+			continue
+		}
+		synced++
+	}
+
+	// On supprime les fichiers absents de la source
+	for filePath := range dstFiles {
+		if _, exists := srcFiles[filePath]; exists {
+			continue
+		}
+		if ctx.Err() != nil {
+			return synced, ctx.Err()
+		}
+		if err := b.repair(ctx, filePath, repairTask{op: OP_DELETE}, i); err != nil {
+			errs = append(errs, filePath+" : "+err.Error())
+			continue
+		}
+		synced++
+	}
+
+	if len(errs) > 0 {
+		return synced, errors.New(strings.Join(errs, ", "))
+	}
+	return synced, nil
+}
+
+// listInfos liste tous les fichiers d'une replica avec leurs infos
+func (b *ReplicaBackend) listInfos(ctx context.Context, replica backend.Backend) (map[string]backend.FileInfo, error) {
+	files, err := replica.List(ctx, "", true)
+	if err != nil {
+		return nil, err
+	}
+	infos := make(map[string]backend.FileInfo, len(files))
+	for _, file := range files {
+		file = strings.TrimPrefix(file, "/")
+		fInfo, err := replica.Stat(ctx, file)
+		if isNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, errors.New("unable to stat file[" + file + "] : " + err.Error())
+		}
+		infos[file] = fInfo
+	}
+
+	return infos, nil
+}
+
+// resynced retire la replica des reparations enregistrees avant la resynchronisation
+func (b *ReplicaBackend) resynced(i int, generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for filePath, task := range b.pending {
+		if task.generation > generation {
+			continue
+		}
+		delete(task.missing, i)
+		if len(task.missing) == 0 {
+			delete(b.pending, filePath)
+		}
+	}
+}
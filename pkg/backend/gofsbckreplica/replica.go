@@ -0,0 +1,430 @@
+package gofsbckreplica
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DEFAULT_REPAIR_INTERVAL = 30 * time.Second
+
+	// Taille des blocs envoyes a chaque replica lors d'une ecriture en streaming
+	FAN_OUT_BUFFER_SIZE = 32 * 1024
+	// Nombre de blocs mis en attente pour chaque replica lors d'une ecriture en streaming
+	DEFAULT_FAN_OUT_BUFFER = 64
+	// Attente avant de reevaluer l'abandon d'une replica dont la file est pleine
+	FAN_OUT_WAIT = 10 * time.Millisecond
+)
+
+// errSlowReplica interrompt l'envoi vers une replica trop lente, qui sera reparee
+var errSlowReplica = errors.New("replica is too slow, write dropped")
+
+type ReplicaConfig struct {
+	// Nombre de replicas devant reussir une ecriture, toutes par defaut
+	WriteQuorum int
+	// Intervalle entre deux reparations des ecritures manquees, DEFAULT_REPAIR_INTERVAL par defaut
+	RepairInterval time.Duration
+	// Nombre de blocs de FAN_OUT_BUFFER_SIZE mis en attente pour chaque replica lors d'une ecriture en streaming,
+	// DEFAULT_FAN_OUT_BUFFER par defaut. Une replica dont l'attente est pleine est abandonnee tant que le quorum
+	// peut etre atteint sans elle, afin de ne pas ralentir les autres
+	FanOutBuffer int
+	// Active les logs de debug de l'instance
+	Debug bool
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
+}
+
+// ReplicaBackend ecrit chaque fichier sur toutes ses replicas et lit depuis la premiere disponible,
+// dans l'ordre fourni a New. Les ecritures manquees par une replica sont reparees en arriere plan,
+// au mieux : elles ne sont conservees qu'en memoire, Resync realigne entierement les replicas apres un redemarrage
+type ReplicaBackend struct {
+	Config   ReplicaConfig
+	replicas []backend.Backend
+
+	mu         sync.Mutex
+	pending    map[string]*repairTask
+	generation uint64
+	stop       chan struct{}
+	done       chan struct{}
+	logger     zerolog.Logger
+}
+
+func New(replicas []backend.Backend, config ReplicaConfig) (*ReplicaBackend, error) {
+	// On applique les valeurs par defaut
+	if config.WriteQuorum == 0 {
+		config.WriteQuorum = len(replicas)
+	}
+	if config.RepairInterval == 0 {
+		config.RepairInterval = DEFAULT_REPAIR_INTERVAL
+	}
+	if config.FanOutBuffer == 0 {
+		config.FanOutBuffer = DEFAULT_FAN_OUT_BUFFER
+	}
+
+	// On verifie la configuration
+	if len(replicas) == 0 {
+		return nil, errors.New("missing replicas")
+	}
+	for i, replica := range replicas {
+		if replica == nil {
+			return nil, errors.New("replica[" + strconv.Itoa(i) + "] is nil")
+		}
+	}
+	if config.WriteQuorum < 1 || config.WriteQuorum > len(replicas) {
+		return nil, errors.New("write quorum must be between 1 and " + strconv.Itoa(len(replicas)))
+	}
+	if config.RepairInterval < 0 {
+		return nil, errors.New("invalid repair interval[" + config.RepairInterval.String() + "]")
+	}
+	if config.FanOutBuffer < 0 {
+		return nil, errors.New("invalid fan out buffer[" + strconv.Itoa(config.FanOutBuffer) + "]")
+	}
+
+	// On initialise le logger
+	logger := backend.NewLogger(config.Logger, "replica", config.Debug)
+
+	// On informe
+	logger.Debug().
+		Int("replicas", len(replicas)).
+		Int("write_quorum", config.WriteQuorum).
+		Msg("Starting backend ...")
+
+	// On demarre la reparation en arriere plan
+	b := &ReplicaBackend{
+		Config:   config,
+		logger:   logger,
+		replicas: replicas,
+		pending:  make(map[string]*repairTask),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.repairLoop()
+
+	return b, nil
+}
+
+// Close arrete la reparation en arriere plan, les reparations en attente sont perdues et Resync doit
+// etre utilise pour realigner les replicas
+func (b *ReplicaBackend) Close() error {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	<-b.done
+
+	return nil
+}
+
+func (b *ReplicaBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	// On utilise la premiere replica disponible
+	var files []string
+	err := b.read(ctx, "", func(replica backend.Backend) (err error) {
+		files, err = replica.List(ctx, path, recursive)
+		return err
+	})
+
+	return files, err
+}
+
+func (b *ReplicaBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	var fInfo backend.FileInfo
+	err := b.read(ctx, filePath, func(replica backend.Backend) (err error) {
+		fInfo, err = replica.Stat(ctx, filePath)
+		return err
+	})
+
+	return fInfo, err
+}
+
+func (b *ReplicaBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	var data []byte
+	err := b.read(ctx, filePath, func(replica backend.Backend) (err error) {
+		data, err = replica.Read(ctx, filePath)
+		return err
+	})
+
+	return data, err
+}
+
+func (b *ReplicaBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	// On utilise la methode existante
+	data, err := b.Read(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// On converti en string
+	return string(data), err
+}
+
+func (b *ReplicaBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	var fileStream backend.FileStream
+	err := b.read(ctx, filePath, func(replica backend.Backend) (err error) {
+		fileStream, err = replica.ReadStream(ctx, filePath, opts...)
+		return err
+	})
+
+	return fileStream, err
+}
+
+func (b *ReplicaBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	// On ecrit sur toutes les replicas en parallele
+	return b.write(ctx, "Write", filePath, func(i int, replica backend.Backend) error {
+		return replica.Write(ctx, filePath, data, opts...)
+	})
+}
+
+func (b *ReplicaBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	// On utilise la methode existante
+	return b.Write(ctx, filePath, []byte(content), opts...)
+}
+
+func (b *ReplicaBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	// On duplique le stream vers chaque replica
+	readers := make([]*io.PipeReader, len(b.replicas))
+	writers := make([]*io.PipeWriter, len(b.replicas))
+	for i := range b.replicas {
+		readers[i], writers[i] = io.Pipe()
+	}
+	go b.fanOut(stream, writers)
+
+	// On ecrit sur toutes les replicas en parallele
+	return b.write(ctx, "WriteStream", filePath, func(i int, replica backend.Backend) error {
+		err := replica.WriteStream(ctx, filePath, readers[i], length, opts...)
+		// On debloque l'envoi si la replica n'a pas tout lu
+		readers[i].CloseWithError(io.ErrClosedPipe)
+		return err
+	})
+}
+
+func (b *ReplicaBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.write(ctx, "Copy", filePathDst, func(i int, replica backend.Backend) error {
+		return replica.Copy(ctx, filePathSrc, filePathDst)
+	})
+}
+
+func (b *ReplicaBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// On deplace sur toutes les replicas
+	results := b.fanOutCall(func(i int, replica backend.Backend) error {
+		return replica.Move(ctx, filePathSrc, filePathDst)
+	})
+
+	// Les replicas en echec devront recevoir la destination et supprimer la source
+	b.record(filePathDst, OP_WRITE, results)
+	b.record(filePathSrc, OP_DELETE, results)
+
+	return b.quorum("Move", filePathSrc+" -> "+filePathDst, results)
+}
+
+func (b *ReplicaBackend) Delete(ctx context.Context, filePath string) error {
+	// On supprime sur toutes les replicas, un fichier deja absent n'est pas une erreur
+	results := b.fanOutCall(func(i int, replica backend.Backend) error {
+		if err := replica.Delete(ctx, filePath); err != nil && !isNotExist(err) {
+			return err
+		}
+		return nil
+	})
+	b.record(filePath, OP_DELETE, results)
+
+	return b.quorum("Delete", filePath, results)
+}
+
+func (b *ReplicaBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	return b.write(ctx, "SetMetadata", filePath, func(i int, replica backend.Backend) error {
+		return replica.SetMetadata(ctx, filePath, metadata)
+	})
+}
+
+// ListExpired renvoie les fichiers expires de la premiere replica disponible
+func (b *ReplicaBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	// On utilise la premiere replica disponible
+	var files []string
+	err := b.read(ctx, "", func(replica backend.Backend) (err error) {
+		files, err = backend.ListExpired(ctx, replica, path, now)
+		return err
+	})
+
+	return files, err
+}
+
+// read execute l'appel sur la premiere replica disponible, en ignorant celles
+// qui n'ont pas encore recu la derniere ecriture du fichier
+func (b *ReplicaBackend) read(ctx context.Context, filePath string, call func(replica backend.Backend) error) error {
+	// On recupere les replicas a jour
+	stale := b.staleReplicas(filePath)
+
+	var errs []string
+	for i, replica := range b.replicas {
+		if stale[i] {
+			continue
+		}
+
+		// Si l'appel fonctionne ou que le fichier n'existe pas, on s'arrete
+		err := call(replica)
+		if err == nil || isNotExist(err) {
+			return err
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// Sinon on passe a la suivante
+		b.logger.Warn().
+			Int("replica", i).
+			Str("path", filePath).
+			Err(err).
+			Msg("Replica read failed, trying next one")
+		errs = append(errs, "replica["+strconv.Itoa(i)+"] : "+err.Error())
+	}
+
+	return errors.New("all replicas failed : " + strings.Join(errs, ", "))
+}
+
+// write execute l'appel sur toutes les replicas, enregistre celles a reparer et verifie le quorum
+func (b *ReplicaBackend) write(ctx context.Context, action string, filePath string, call func(i int, replica backend.Backend) error) error {
+	results := b.fanOutCall(call)
+	b.record(filePath, OP_WRITE, results)
+
+	return b.quorum(action, filePath, results)
+}
+
+// fanOutCall execute l'appel sur toutes les replicas en parallele et renvoie l'erreur de chacune
+func (b *ReplicaBackend) fanOutCall(call func(i int, replica backend.Backend) error) []error {
+	results := make([]error, len(b.replicas))
+	var wg sync.WaitGroup
+	for i, replica := range b.replicas {
+		wg.Add(1)
+		go func(i int, replica backend.Backend) {
+			defer wg.Done()
+			results[i] = call(i, replica)
+		}(i, replica)
+	}
+	wg.Wait()
+
+	return results
+}
+
+func (b *ReplicaBackend) quorum(action string, filePath string, results []error) error {
+	// On compte les succes
+	succeeded := 0
+	var errs []string
+	for i, err := range results {
+		if err == nil {
+			succeeded++
+			continue
+		}
+		b.logger.Warn().
+			Str("op", action).
+			Int("replica", i).
+			Str("path", filePath).
+			Err(err).
+			Msg("Replica write failed")
+		errs = append(errs, "replica["+strconv.Itoa(i)+"] : "+err.Error())
+	}
+
+	// On verifie le quorum
+	if succeeded < b.Config.WriteQuorum {
+		return errors.New(
+			"write quorum not reached for " + action + " (" + strconv.Itoa(succeeded) + "/" +
+				strconv.Itoa(b.Config.WriteQuorum) + ") : " + strings.Join(errs, ", "),
+		)
+	}
+
+	return nil
+}
+
+// fanOut copie le stream vers chaque writer, une replica en echec n'arretant pas les autres.
+// Chaque replica recoit les blocs depuis sa propre file d'attente, une replica dont la file est pleine
+// est abandonnee si assez d'autres replicas suivent le rythme pour atteindre le quorum
+func (b *ReplicaBackend) fanOut(stream io.ReadCloser, writers []*io.PipeWriter) {
+	defer stream.Close()
+
+	// On demarre l'envoi vers chaque replica, closeErrs etant renseignee avant la fermeture de la file
+	queues := make([]chan []byte, len(writers))
+	closeErrs := make([]error, len(writers))
+	for i := range writers {
+		queues[i] = make(chan []byte, b.Config.FanOutBuffer)
+		go func(i int) {
+			failed := false
+			for chunk := range queues[i] {
+				if !failed {
+					_, err := writers[i].Write(chunk)
+					failed = err != nil
+				}
+			}
+			writers[i].CloseWithError(closeErrs[i])
+		}(i)
+	}
+
+	// On lit le stream et on distribue chaque bloc
+	for {
+		buf := make([]byte, FAN_OUT_BUFFER_SIZE)
+		n, err := stream.Read(buf)
+		if n > 0 {
+			for i := range queues {
+				if queues[i] != nil {
+					b.enqueue(queues, writers, closeErrs, i, buf[:n])
+				}
+			}
+		}
+		if err != nil {
+			for i, queue := range queues {
+				if queue == nil {
+					continue
+				}
+				if err != io.EOF {
+					closeErrs[i] = err
+				}
+				close(queue)
+			}
+			return
+		}
+	}
+}
+
+// enqueue envoie le bloc a la replica, en l'attendant tant qu'elle ne peut pas etre abandonnee
+func (b *ReplicaBackend) enqueue(queues []chan []byte, writers []*io.PipeWriter, closeErrs []error, i int, chunk []byte) {
+	for {
+		select {
+		case queues[i] <- chunk:
+			return
+		case <-time.After(FAN_OUT_WAIT):
+		}
+
+		// On compte les autres replicas qui suivent le rythme
+		keepingUp := 0
+		for j, queue := range queues {
+			if j != i && queue != nil && len(queue) < cap(queue) {
+				keepingUp++
+			}
+		}
+		if keepingUp < b.Config.WriteQuorum {
+			continue
+		}
+
+		// La replica est en retard, on l'abandonne sans attendre son ecriture en cours, elle sera reparee
+		closeErrs[i] = errSlowReplica
+		writers[i].CloseWithError(errSlowReplica)
+		close(queues[i])
+		queues[i] = nil
+		b.logger.Warn().
+			Int("replica", i).
+			Msg("Replica too slow, dropped from the write")
+		return
+	}
+}
+
+// isNotExist reconnait l'erreur commune aux backends ainsi que celles du systeme de fichiers
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
@@ -0,0 +1,262 @@
+package gofsbckreplica
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+var errDown = errors.New("replica is down")
+
+// downBackend est un backend local dont les lectures et ecritures echouent tant qu'il est arrete
+type downBackend struct {
+	*gofsbcklocal.LocalBackend
+	down atomic.Bool
+}
+
+func (b *downBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	if b.down.Load() {
+		return backend.FileInfo{}, errDown
+	}
+	return b.LocalBackend.Stat(ctx, filePath)
+}
+
+func (b *downBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	if b.down.Load() {
+		return nil, errDown
+	}
+	return b.LocalBackend.Read(ctx, filePath)
+}
+
+func (b *downBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	if b.down.Load() {
+		return errDown
+	}
+	return b.LocalBackend.Write(ctx, filePath, data, opts...)
+}
+
+func (b *downBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	if b.down.Load() {
+		return errDown
+	}
+	return b.LocalBackend.WriteStream(ctx, filePath, stream, length, opts...)
+}
+
+func (b *downBackend) Delete(ctx context.Context, filePath string) error {
+	if b.down.Load() {
+		return errDown
+	}
+	return b.LocalBackend.Delete(ctx, filePath)
+}
+
+// newTestBackend replique sur des backends locaux, sans reparation en arriere plan
+func newTestBackend(t *testing.T, count int, quorum int) (*ReplicaBackend, []*downBackend) {
+	t.Helper()
+	locals := make([]*downBackend, count)
+	replicas := make([]backend.Backend, count)
+	for i := range locals {
+		local, err := gofsbcklocal.New(gofsbcklocal.LocalConfig{BasePath: t.TempDir()})
+		if err != nil {
+			t.Fatal(err)
+		}
+		locals[i] = &downBackend{LocalBackend: local}
+		replicas[i] = locals[i]
+	}
+	b, err := New(replicas, ReplicaConfig{WriteQuorum: quorum, RepairInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	return b, locals
+}
+
+func TestWriteQuorum(t *testing.T) {
+	ctx := context.Background()
+	writes := []struct {
+		name  string
+		write func(b *ReplicaBackend, data []byte) error
+	}{
+		{"write", func(b *ReplicaBackend, data []byte) error {
+			return b.Write(ctx, "file", data)
+		}},
+		{"write stream", func(b *ReplicaBackend, data []byte) error {
+			return b.WriteStream(ctx, "file", io.NopCloser(bytes.NewReader(data)), int64(len(data)))
+		}},
+		{"delete", func(b *ReplicaBackend, data []byte) error {
+			return b.Delete(ctx, "file")
+		}},
+	}
+	tests := []struct {
+		name        string
+		quorum      int
+		down        []int
+		wantErr     bool
+		wantPending int
+	}{
+		{"all replicas", 3, nil, false, 0},
+		{"quorum reached", 2, []int{2}, false, 1},
+		{"single replica quorum", 1, []int{0, 1}, false, 1},
+		{"quorum missed", 2, []int{1, 2}, true, 0},
+		{"all replicas required", 3, []int{0}, true, 0},
+	}
+	for _, write := range writes {
+		for _, tt := range tests {
+			t.Run(write.name+"/"+tt.name, func(t *testing.T) {
+				b, locals := newTestBackend(t, 3, tt.quorum)
+				if err := b.Write(ctx, "file", []byte("old")); err != nil {
+					t.Fatal(err)
+				}
+				for _, i := range tt.down {
+					locals[i].down.Store(true)
+				}
+
+				err := write.write(b, []byte("new content"))
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+				}
+
+				// Seules les operations ayant atteint le quorum sont reparees
+				if pending := b.PendingRepairs(); pending != tt.wantPending {
+					t.Errorf("pending repairs = %d, want %d", pending, tt.wantPending)
+				}
+
+				// Une fois les replicas revenues, la reparation les realigne
+				for _, local := range locals {
+					local.down.Store(false)
+				}
+				remaining, err := b.Repair(ctx)
+				if err != nil || remaining != 0 {
+					t.Fatalf("repair = %d, %v, want 0, nil", remaining, err)
+				}
+				if tt.wantErr {
+					return
+				}
+				for i, local := range locals {
+					got, err := local.Read(ctx, "file")
+					if write.name == "delete" {
+						if err == nil {
+							t.Errorf("replica[%d] still has the deleted file", i)
+						}
+					} else if string(got) != "new content" {
+						t.Errorf("replica[%d] content = %q, %v, want %q", i, got, err, "new content")
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestReadFailover(t *testing.T) {
+	ctx := context.Background()
+	b, locals := newTestBackend(t, 3, 2)
+	if err := b.Write(ctx, "file", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+
+	// La premiere replica manque l'ecriture suivante puis revient, avec un contenu perime
+	locals[0].down.Store(true)
+	if err := b.Write(ctx, "file", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	locals[0].down.Store(false)
+
+	tests := []struct {
+		name    string
+		down    []int
+		want    string
+		wantErr bool
+	}{
+		{"stale replica skipped", nil, "new", false},
+		{"failover to last replica", []int{1}, "new", false},
+		{"all up to date replicas down", []int{1, 2}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i, local := range locals {
+				local.down.Store(false)
+				for _, down := range tt.down {
+					if i == down {
+						local.down.Store(true)
+					}
+				}
+			}
+
+			got, err := b.Read(ctx, "file")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResync(t *testing.T) {
+	ctx := context.Background()
+	b, locals := newTestBackend(t, 3, 1)
+
+	// Les replicas ont diverge en dehors du backend
+	for filePath, content := range map[string]string{"same": "same", "resized": "source", "dir/missing": "missing"} {
+		if err := locals[0].Write(ctx, filePath, []byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, local := range locals[1:] {
+		for filePath, content := range map[string]string{"same": "same", "resized": "stale content", "extra": "extra"} {
+			if err := local.Write(ctx, filePath, []byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// Une reparation est en attente pour une replica arretee
+	locals[2].down.Store(true)
+	if err := b.Write(ctx, "pending", []byte("pending")); err != nil {
+		t.Fatal(err)
+	}
+	locals[2].down.Store(false)
+	if b.PendingRepairs() != 1 {
+		t.Fatalf("pending repairs = %d, want 1", b.PendingRepairs())
+	}
+
+	// Chaque replica recoit le fichier modifie, le manquant, l'attente, et perd le fichier en trop
+	synced, err := b.Resync(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced != 7 {
+		t.Errorf("synced = %d, want 7", synced)
+	}
+	if b.PendingRepairs() != 0 {
+		t.Errorf("pending repairs = %d, want 0", b.PendingRepairs())
+	}
+	for i, local := range locals {
+		files, err := local.List(ctx, "", true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(files) != 4 {
+			t.Errorf("replica[%d] files = %v, want 4 files", i, files)
+		}
+		if got, err := local.Read(ctx, "resized"); err != nil || string(got) != "source" {
+			t.Errorf("replica[%d] resized = %q, %v, want %q", i, got, err, "source")
+		}
+		if _, err := local.Stat(ctx, "extra"); err == nil {
+			t.Errorf("replica[%d] still has the extra file", i)
+		}
+	}
+
+	// Une source inconnue est refusee
+	if _, err = b.Resync(ctx, 3); err == nil {
+		t.Error("resync from an unknown replica succeeded")
+	}
+}
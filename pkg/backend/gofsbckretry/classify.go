@@ -0,0 +1,81 @@
+package gofsbckretry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// Codes S3 indiquant une erreur temporaire
+var retryableS3Codes = map[string]bool{
+	"InternalError":        true,
+	"ServiceUnavailable":   true,
+	"SlowDown":             true,
+	"Throttling":           true,
+	"ThrottlingException":  true,
+	"RequestTimeout":       true,
+	"RequestTimeTooSkewed": true,
+	"OperationAborted":     true,
+}
+
+// Messages d'erreurs temporaires, pour les erreurs dont le type a ete perdu
+var retryableMessages = []string{
+	"connection reset",
+	"connection refused",
+	"broken pipe",
+	"i/o timeout",
+	"tls handshake timeout",
+	"unexpected eof",
+	"server closed idle connection",
+	"service unavailable",
+	"slow down",
+	"please reduce your request rate",
+	"internal error",
+}
+
+// IsRetryable indique si l'erreur est temporaire : erreurs 5xx, limitation de debit, coupures reseau.
+// Les erreurs permanentes (fichier absent, acces refuse, requete invalide, annulation) ne sont pas reessayees
+func IsRetryable(err error) bool {
+	// Les erreurs permanentes
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrExist) {
+		return false
+	}
+
+	// Les erreurs S3, classees par code puis par statut HTTP
+	if errResponse := minio.ToErrorResponse(err); errResponse.Code != "" || errResponse.StatusCode != 0 {
+		if retryableS3Codes[errResponse.Code] {
+			return true
+		}
+		return errResponse.StatusCode >= http.StatusInternalServerError || errResponse.StatusCode == http.StatusTooManyRequests
+	}
+
+	// Les erreurs reseau
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// Les erreurs converties en texte par les backends
+	message := strings.ToLower(err.Error())
+	for _, retryable := range retryableMessages {
+		if strings.Contains(message, retryable) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,48 @@
+package gofsbckretry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+
+	"github.com/minio/minio-go/v7"
+)
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"canceled", context.Canceled, false},
+		{"deadline exceeded", context.DeadlineExceeded, false},
+		{"not exist", &fs.PathError{Op: "open", Path: "file", Err: fs.ErrNotExist}, false},
+		{"permission", fs.ErrPermission, false},
+		{"exist", fs.ErrExist, false},
+		{"s3 slow down", minio.ErrorResponse{Code: "SlowDown", StatusCode: http.StatusServiceUnavailable}, true},
+		{"s3 internal error code", minio.ErrorResponse{Code: "InternalError"}, true},
+		{"s3 bad gateway", minio.ErrorResponse{StatusCode: http.StatusBadGateway}, true},
+		{"s3 too many requests", minio.ErrorResponse{StatusCode: http.StatusTooManyRequests}, true},
+		{"s3 no such key", minio.ErrorResponse{Code: "NoSuchKey", StatusCode: http.StatusNotFound}, false},
+		{"s3 access denied", minio.ErrorResponse{Code: "AccessDenied", StatusCode: http.StatusForbidden}, false},
+		{"connection reset", &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}, true},
+		{"connection refused", syscall.ECONNREFUSED, true},
+		{"unexpected eof", io.ErrUnexpectedEOF, true},
+		{"network timeout", &net.DNSError{Err: "timeout", IsTimeout: true}, true},
+		{"message of a converted error", errors.New("unable to write : read tcp: connection reset by peer"), true},
+		{"unknown error", errors.New("invalid argument"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
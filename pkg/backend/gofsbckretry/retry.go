@@ -0,0 +1,253 @@
+package gofsbckretry
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DEFAULT_MAX_ATTEMPTS    = 3
+	DEFAULT_INITIAL_BACKOFF = 100 * time.Millisecond
+	DEFAULT_MAX_BACKOFF     = 5 * time.Second
+)
+
+type RetryConfig struct {
+	// Nombre maximum d'appels, DEFAULT_MAX_ATTEMPTS par defaut
+	MaxAttempts int
+	// Attente avant le deuxieme appel, doublee a chaque essai jusqu'a MaxBackoff
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Duree maximum de l'ensemble des essais, 0 pour ne pas limiter
+	MaxElapsed time.Duration
+	// Classification des erreurs, IsRetryable par defaut
+	IsRetryable func(err error) bool
+	// Active les logs de debug de l'instance
+	Debug bool
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
+}
+
+// RetryBackend reessaie les appels au backend suivant en cas d'erreur temporaire,
+// avec une attente exponentielle et aleatoire entre chaque essai
+type RetryBackend struct {
+	Config RetryConfig
+	next   backend.Backend
+	logger zerolog.Logger
+}
+
+func New(next backend.Backend, config RetryConfig) (*RetryBackend, error) {
+	// On applique les valeurs par defaut
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = DEFAULT_INITIAL_BACKOFF
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = DEFAULT_MAX_BACKOFF
+	}
+	if config.IsRetryable == nil {
+		config.IsRetryable = IsRetryable
+	}
+
+	// On verifie la configuration
+	if next == nil {
+		return nil, errors.New("missing backend to retry")
+	}
+	if config.MaxAttempts < 1 {
+		return nil, errors.New("invalid max attempts[" + strconv.Itoa(config.MaxAttempts) + "]")
+	}
+	if config.InitialBackoff < 0 || config.MaxBackoff < config.InitialBackoff {
+		return nil, errors.New("invalid backoff[" + config.InitialBackoff.String() + ", " + config.MaxBackoff.String() + "]")
+	}
+	if config.MaxElapsed < 0 {
+		return nil, errors.New("invalid max elapsed[" + config.MaxElapsed.String() + "]")
+	}
+
+	return &RetryBackend{
+		Config: config,
+		next:   next,
+		logger: backend.NewLogger(config.Logger, "retry", config.Debug),
+	}, nil
+}
+
+func (b *RetryBackend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
+	var files []string
+	err := b.retry(ctx, "List", path, func() (err error) {
+		files, err = b.next.List(ctx, path, recursive)
+		return err
+	})
+
+	return files, err
+}
+
+func (b *RetryBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	var fInfo backend.FileInfo
+	err := b.retry(ctx, "Stat", filePath, func() (err error) {
+		fInfo, err = b.next.Stat(ctx, filePath)
+		return err
+	})
+
+	return fInfo, err
+}
+
+func (b *RetryBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	var data []byte
+	err := b.retry(ctx, "Read", filePath, func() (err error) {
+		data, err = b.next.Read(ctx, filePath)
+		return err
+	})
+
+	return data, err
+}
+
+func (b *RetryBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	// On utilise la methode existante
+	data, err := b.Read(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+
+	// On converti en string
+	return string(data), err
+}
+
+func (b *RetryBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	// Seule l'ouverture du stream est reessayee, pas sa lecture
+	var fileStream backend.FileStream
+	err := b.retry(ctx, "ReadStream", filePath, func() (err error) {
+		fileStream, err = b.next.ReadStream(ctx, filePath, opts...)
+		return err
+	})
+
+	return fileStream, err
+}
+
+func (b *RetryBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	// Le contenu est en memoire, l'ecriture peut toujours etre reessayee
+	return b.retry(ctx, "Write", filePath, func() error {
+		return b.next.Write(ctx, filePath, data, opts...)
+	})
+}
+
+func (b *RetryBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	// On utilise la methode existante
+	return b.Write(ctx, filePath, []byte(content), opts...)
+}
+
+func (b *RetryBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	// On ne reessaie que si le stream n'a pas ete lu, ou s'il peut etre rembobine ou rouvert
+	replay := newReplayStream(stream)
+	defer func() { replay.stream.Close() }()
+
+	var lastErr error
+	return b.retry(ctx, "WriteStream", filePath, func() error {
+		// Si le stream ne peut pas etre rejoue, on arrete avec l'erreur de l'essai precedent
+		if replayable, err := replay.rewind(); err != nil || !replayable {
+			b.logger.Debug().
+				Str("op", "WriteStream").
+				Str("path", filePath).
+				AnErr("rewind", err).
+				Msg("Stream can not be replayed, write is not retried")
+			return stopError{lastErr}
+		}
+		lastErr = b.next.WriteStream(ctx, filePath, replay, length, opts...)
+		return lastErr
+	})
+}
+
+func (b *RetryBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.retry(ctx, "Copy", filePathDst, func() error {
+		return b.next.Copy(ctx, filePathSrc, filePathDst)
+	})
+}
+
+func (b *RetryBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.retry(ctx, "Move", filePathDst, func() error {
+		return b.next.Move(ctx, filePathSrc, filePathDst)
+	})
+}
+
+func (b *RetryBackend) Delete(ctx context.Context, filePath string) error {
+	return b.retry(ctx, "Delete", filePath, func() error {
+		return b.next.Delete(ctx, filePath)
+	})
+}
+
+func (b *RetryBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	return b.retry(ctx, "SetMetadata", filePath, func() error {
+		return b.next.SetMetadata(ctx, filePath, metadata)
+	})
+}
+
+// ListExpired transmet la recherche des fichiers expires au backend decore
+func (b *RetryBackend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	var files []string
+	err := b.retry(ctx, "ListExpired", path, func() (err error) {
+		files, err = backend.ListExpired(ctx, b.next, path, now)
+		return err
+	})
+
+	return files, err
+}
+
+// retry execute l'appel jusqu'a son succes, une erreur permanente, ou la fin des essais ou du temps imparti.
+// La derniere erreur est renvoyee telle quelle
+func (b *RetryBackend) retry(ctx context.Context, action string, path string, call func() error) error {
+	start := time.Now()
+	backoff := b.Config.InitialBackoff
+
+	for attempt := 1; ; attempt++ {
+		// On appelle le backend
+		err := call()
+		if stop, ok := err.(stopError); ok {
+			return stop.err
+		}
+		if err == nil || attempt >= b.Config.MaxAttempts || !b.Config.IsRetryable(err) {
+			return err
+		}
+
+		// On attend entre la moitie et la totalite du delai, afin d'etaler les essais des differents clients
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if b.Config.MaxElapsed > 0 && time.Since(start)+wait > b.Config.MaxElapsed {
+			return err
+		}
+
+		b.logger.Debug().
+			Str("op", action).
+			Str("path", path).
+			Int("attempt", attempt).
+			Dur("wait", wait).
+			Err(err).
+			Msg("Retrying after transient error")
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		// On double le delai pour le prochain essai
+		if backoff *= 2; backoff > b.Config.MaxBackoff {
+			backoff = b.Config.MaxBackoff
+		}
+	}
+}
+
+// stopError interrompt les essais en renvoyant l'erreur qu'elle contient
+type stopError struct {
+	err error
+}
+
+func (e stopError) Error() string {
+	return e.err.Error()
+}
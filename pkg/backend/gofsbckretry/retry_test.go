@@ -0,0 +1,189 @@
+package gofsbckretry
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+const (
+	TEST_INITIAL_BACKOFF = 10 * time.Millisecond
+	TEST_MAX_BACKOFF     = 20 * time.Millisecond
+)
+
+// failingBackend est un backend local dont les ecritures echouent failures fois avec err
+type failingBackend struct {
+	*gofsbcklocal.LocalBackend
+	failures int
+	err      error
+	calls    int
+}
+
+func (b *failingBackend) fail() error {
+	b.calls++
+	if b.calls <= b.failures {
+		return b.err
+	}
+	return nil
+}
+
+func (b *failingBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	if err := b.fail(); err != nil {
+		return err
+	}
+	return b.LocalBackend.Write(ctx, filePath, data, opts...)
+}
+
+func (b *failingBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	// Le stream est consomme avant l'echec, comme lors d'une coupure en cours d'envoi
+	if err := b.fail(); err != nil {
+		io.Copy(io.Discard, stream)
+		return err
+	}
+	return b.LocalBackend.WriteStream(ctx, filePath, stream, length, opts...)
+}
+
+// newTestBackend reessaie les appels a un backend local echouant failures fois
+func newTestBackend(t *testing.T, failures int, err error, config RetryConfig) (*RetryBackend, *failingBackend) {
+	t.Helper()
+	local, localErr := gofsbcklocal.New(gofsbcklocal.LocalConfig{BasePath: t.TempDir()})
+	if localErr != nil {
+		t.Fatal(localErr)
+	}
+	next := &failingBackend{LocalBackend: local, failures: failures, err: err}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = TEST_INITIAL_BACKOFF
+		config.MaxBackoff = TEST_MAX_BACKOFF
+	}
+	b, newErr := New(next, config)
+	if newErr != nil {
+		t.Fatal(newErr)
+	}
+
+	return b, next
+}
+
+// seekableStream est un stream pouvant etre rembobine
+type seekableStream struct {
+	*bytes.Reader
+}
+
+func (s seekableStream) Close() error {
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	transient := syscall.ECONNRESET
+	permanent := fs.ErrPermission
+
+	tests := []struct {
+		name      string
+		failures  int
+		err       error
+		config    RetryConfig
+		wantCalls int
+		wantErr   error
+		minWait   time.Duration
+	}{
+		{"success", 0, nil, RetryConfig{}, 1, nil, 0},
+		{"transient errors", 2, transient, RetryConfig{}, 3, nil, TEST_INITIAL_BACKOFF/2 + TEST_INITIAL_BACKOFF},
+		{"attempts exhausted", 5, transient, RetryConfig{}, DEFAULT_MAX_ATTEMPTS, transient, TEST_INITIAL_BACKOFF/2 + TEST_INITIAL_BACKOFF},
+		{"more attempts", 4, transient, RetryConfig{MaxAttempts: 5}, 5, nil, TEST_INITIAL_BACKOFF/2 + TEST_INITIAL_BACKOFF + 2*TEST_MAX_BACKOFF/2},
+		{"permanent error", 2, permanent, RetryConfig{}, 1, permanent, 0},
+		{"max elapsed", 2, transient, RetryConfig{MaxElapsed: time.Millisecond}, 1, transient, 0},
+		{"custom classification", 2, permanent, RetryConfig{IsRetryable: func(err error) bool { return true }}, 3, nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, next := newTestBackend(t, tt.failures, tt.err, tt.config)
+
+			start := time.Now()
+			err := b.Write(context.Background(), "file", []byte("content"))
+			elapsed := time.Since(start)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+			if next.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", next.calls, tt.wantCalls)
+			}
+
+			// L'attente double a chaque essai, avec une part aleatoire d'au plus la moitie du delai
+			if elapsed < tt.minWait {
+				t.Errorf("elapsed = %s, want at least %s", elapsed, tt.minWait)
+			}
+		})
+	}
+}
+
+func TestRetryCanceled(t *testing.T) {
+	b, next := newTestBackend(t, 5, syscall.ECONNRESET, RetryConfig{InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	// L'attente est interrompue avec la derniere erreur
+	start := time.Now()
+	if err := b.Write(ctx, "file", []byte("content")); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("error = %v, want %v", err, syscall.ECONNRESET)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("elapsed = %s, want the wait interrupted", elapsed)
+	}
+	if next.calls != 1 {
+		t.Errorf("calls = %d, want 1", next.calls)
+	}
+}
+
+func TestRetryWriteStream(t *testing.T) {
+	content := []byte("streamed content")
+
+	tests := []struct {
+		name      string
+		stream    func() (io.ReadCloser, error)
+		wantCalls int
+		wantErr   bool
+	}{
+		{"seekable stream", func() (io.ReadCloser, error) {
+			return seekableStream{bytes.NewReader(content)}, nil
+		}, 3, false},
+		{"reopenable stream", func() (io.ReadCloser, error) {
+			return NewReopenableStream(func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(content)), nil
+			})
+		}, 3, false},
+		{"consumed stream", func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(content)), nil
+		}, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, next := newTestBackend(t, 2, syscall.ECONNRESET, RetryConfig{})
+			stream, err := tt.stream()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = b.WriteStream(context.Background(), "file", stream, int64(len(content)))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if next.calls != tt.wantCalls {
+				t.Errorf("calls = %d, want %d", next.calls, tt.wantCalls)
+			}
+
+			// Le contenu ecrit apres les essais est complet
+			if !tt.wantErr {
+				if got, err := next.Read(context.Background(), "file"); err != nil || !bytes.Equal(got, content) {
+					t.Errorf("content = %q, %v, want %q", got, err, content)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package gofsbckretry
+
+import (
+	"errors"
+	"io"
+)
+
+// Reopener est implemente par les streams pouvant etre rouverts depuis le debut, afin de reessayer une ecriture
+type Reopener interface {
+	Reopen() (io.ReadCloser, error)
+}
+
+// NewReopenableStream renvoie un stream ouvert avec open, et qui sera rouvert avec open si l'ecriture doit etre reessayee
+func NewReopenableStream(open func() (io.ReadCloser, error)) (io.ReadCloser, error) {
+	stream, err := open()
+	if err != nil {
+		return nil, err
+	}
+
+	return &reopenableStream{ReadCloser: stream, open: open}, nil
+}
+
+type reopenableStream struct {
+	io.ReadCloser
+	open func() (io.ReadCloser, error)
+}
+
+func (s *reopenableStream) Reopen() (io.ReadCloser, error) {
+	// On ferme le stream precedent avant d'en ouvrir un nouveau
+	s.ReadCloser.Close()
+	stream, err := s.open()
+	if err != nil {
+		return nil, err
+	}
+	s.ReadCloser = stream
+
+	return s, nil
+}
+
+// replayStream suit la lecture du stream afin de savoir s'il peut etre rejoue.
+// La fermeture est ignoree, les backends fermant parfois le stream, elle est faite a la fin des essais
+type replayStream struct {
+	stream io.ReadCloser
+	start  int64
+	read   int64
+}
+
+func newReplayStream(stream io.ReadCloser) *replayStream {
+	s := &replayStream{stream: stream, start: -1}
+	if seeker, ok := stream.(io.Seeker); ok {
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			s.start = start
+		}
+	}
+
+	return s
+}
+
+func (s *replayStream) Read(p []byte) (int, error) {
+	n, err := s.stream.Read(p)
+	s.read += int64(n)
+	return n, err
+}
+
+func (s *replayStream) Close() error {
+	return nil
+}
+
+// rewind remet le stream au debut, en le rembobinant ou en le rouvrant, et indique si c'est possible
+func (s *replayStream) rewind() (bool, error) {
+	// Si rien n'a ete lu, le stream peut etre reutilise tel quel
+	if s.read == 0 {
+		return true, nil
+	}
+
+	// Si le stream peut etre rembobine
+	if seeker, ok := s.stream.(io.Seeker); ok && s.start >= 0 {
+		if _, err := seeker.Seek(s.start, io.SeekStart); err != nil {
+			return false, errors.New("unable to rewind stream : " + err.Error())
+		}
+		s.read = 0
+		return true, nil
+	}
+
+	// Si le stream peut etre rouvert
+	if reopener, ok := s.stream.(Reopener); ok {
+		stream, err := reopener.Reopen()
+		if err != nil {
+			return false, errors.New("unable to reopen stream : " + err.Error())
+		}
+		s.stream = stream
+		s.read = 0
+		return true, nil
+	}
+
+	return false, nil
+}
@@ -0,0 +1,133 @@
+package gofsbcks3
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// Fournisseurs d'identifiants disponibles pour S3Config.CredentialsProvider.
+// Les identifiants temporaires sont renouveles automatiquement a leur expiration
+const (
+	CREDENTIALS_PROVIDER_STATIC       = "static"
+	CREDENTIALS_PROVIDER_ENV          = "env"
+	CREDENTIALS_PROVIDER_AWS_FILE     = "aws_file"
+	CREDENTIALS_PROVIDER_MINIO_FILE   = "minio_file"
+	CREDENTIALS_PROVIDER_WEB_IDENTITY = "web_identity"
+	CREDENTIALS_PROVIDER_IAM          = "iam"
+	CREDENTIALS_PROVIDER_CHAIN        = "chain"
+)
+
+func newCredentials(config S3Config) (*credentials.Credentials, error) {
+	// On verifie la configuration
+	if err := validateCredentials(config); err != nil {
+		return nil, err
+	}
+
+	// En fonction du fournisseur
+	switch config.CredentialsProvider {
+	case "", CREDENTIALS_PROVIDER_STATIC:
+		return credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, config.SessionToken), nil
+	case CREDENTIALS_PROVIDER_WEB_IDENTITY:
+		return credentials.New(newWebIdentityProvider(config)), nil
+	default:
+		return credentials.NewChainCredentials(newProviders(config)), nil
+	}
+}
+
+func newProviders(config S3Config) []credentials.Provider {
+	// En fonction du fournisseur
+	switch config.CredentialsProvider {
+	case CREDENTIALS_PROVIDER_ENV:
+		return []credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+		}
+	case CREDENTIALS_PROVIDER_AWS_FILE:
+		return []credentials.Provider{
+			&credentials.FileAWSCredentials{
+				Filename: config.CredentialsFile,
+				Profile:  config.CredentialsProfile,
+			},
+		}
+	case CREDENTIALS_PROVIDER_MINIO_FILE:
+		return []credentials.Provider{
+			&credentials.FileMinioClient{
+				Filename: config.CredentialsFile,
+				Alias:    config.CredentialsProfile,
+			},
+		}
+	case CREDENTIALS_PROVIDER_IAM:
+		return []credentials.Provider{
+			&credentials.IAM{
+				Client: &http.Client{Transport: http.DefaultTransport},
+			},
+		}
+	}
+
+	// Sinon on essaie chaque fournisseur dans l'ordre
+	providers := make([]credentials.Provider, 0)
+	if config.AccessKeyID != "" && config.SecretAccessKey != "" {
+		providers = append(providers, &credentials.Static{
+			Value: credentials.Value{
+				AccessKeyID:     config.AccessKeyID,
+				SecretAccessKey: config.SecretAccessKey,
+				SessionToken:    config.SessionToken,
+				SignerType:      credentials.SignatureV4,
+			},
+		})
+	}
+	if config.WebIdentityTokenFile != "" {
+		providers = append(providers, newWebIdentityProvider(config))
+	}
+	providers = append(
+		providers,
+		&credentials.EnvAWS{},
+		&credentials.EnvMinio{},
+		&credentials.FileAWSCredentials{Profile: config.CredentialsProfile},
+		&credentials.FileMinioClient{Alias: config.CredentialsProfile},
+		&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+	)
+
+	return providers
+}
+
+func newWebIdentityProvider(config S3Config) *credentials.STSWebIdentity {
+	return &credentials.STSWebIdentity{
+		Client:      &http.Client{Transport: http.DefaultTransport},
+		STSEndpoint: config.STSEndpoint,
+		RoleARN:     config.RoleARN,
+		GetWebIDTokenExpiry: func() (*credentials.WebIdentityToken, error) {
+			// Le jeton est relu a chaque renouvellement, car il est lui meme renouvele sur le disque
+			token, err := os.ReadFile(config.WebIdentityTokenFile)
+			if err != nil {
+				return nil, errors.New("unable to read web identity token : " + err.Error())
+			}
+			return &credentials.WebIdentityToken{
+				Token: strings.TrimSpace(string(token)),
+			}, nil
+		},
+	}
+}
+
+func validateCredentials(config S3Config) error {
+	// En fonction du fournisseur
+	switch config.CredentialsProvider {
+	case "", CREDENTIALS_PROVIDER_STATIC:
+		if config.AccessKeyID == "" || config.SecretAccessKey == "" {
+			return errors.New("access key and secret key are required with the static credentials provider")
+		}
+	case CREDENTIALS_PROVIDER_WEB_IDENTITY:
+		if config.STSEndpoint == "" || config.WebIdentityTokenFile == "" {
+			return errors.New("sts endpoint and web identity token file are required with the web_identity credentials provider")
+		}
+	case CREDENTIALS_PROVIDER_ENV, CREDENTIALS_PROVIDER_AWS_FILE, CREDENTIALS_PROVIDER_MINIO_FILE, CREDENTIALS_PROVIDER_IAM, CREDENTIALS_PROVIDER_CHAIN:
+	default:
+		return errors.New("unknown credentials provider[" + config.CredentialsProvider + "]")
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package gofsbcks3
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+)
+
+func newServerSide(enc backend.Encryption) (encrypt.ServerSide, error) {
+	// En fonction du mode
+	switch enc.Mode {
+	case backend.ENCRYPTION_NONE:
+		return nil, nil
+	case backend.ENCRYPTION_SSE_S3:
+		return encrypt.NewSSE(), nil
+	case backend.ENCRYPTION_SSE_KMS:
+		if enc.KMSKeyID == "" {
+			return nil, errors.New("a kms key id is required with sse-kms encryption")
+		}
+		// Le contexte doit etre nil et non une map vide pour ne pas etre envoye
+		var kmsContext interface{}
+		if len(enc.KMSContext) > 0 {
+			kmsContext = enc.KMSContext
+		}
+		return encrypt.NewSSEKMS(enc.KMSKeyID, kmsContext)
+	case backend.ENCRYPTION_SSE_C:
+		sse, err := encrypt.NewSSEC(enc.CustomerKey)
+		if err != nil {
+			return nil, errors.New("invalid sse-c customer key : " + err.Error())
+		}
+		return sse, nil
+	default:
+		return nil, errors.New("unknown encryption mode[" + string(enc.Mode) + "]")
+	}
+}
+
+func (b *S3Backend) writeServerSide(opts backend.WriteOptions) (encrypt.ServerSide, error) {
+	// Les options de l'ecriture sont prioritaires sur la configuration
+	if opts.Encryption != nil {
+		return newServerSide(*opts.Encryption)
+	}
+
+	return b.sse, nil
+}
+
+func (b *S3Backend) readServerSide() encrypt.ServerSide {
+	// Seule la cle SSE-C doit etre envoyee pour lire un fichier
+	if b.sse != nil && b.sse.Type() == encrypt.SSEC {
+		return b.sse
+	}
+
+	return nil
+}
+
+// copyServerSide renvoie le chiffrement permettant de lire la source d'une copie, et celui a appliquer a la destination
+// pour qu'elle conserve le mode de la source. Un objet SSE-C ecrit avec une autre cle que celle de la configuration
+// ne peut pas etre copie, sa cle n'etant pas connue
+func (b *S3Backend) copyServerSide(ctx context.Context, filePath string) (encrypt.ServerSide, encrypt.ServerSide, error) {
+	// On recupere le chiffrement de la source, S3 refusant de la lire sans sa cle SSE-C
+	stat, err := b.statObject(ctx, filePath)
+	if errors.Is(err, backend.ErrNotExist) {
+		return nil, nil, err
+	} else if err != nil {
+		return nil, nil, errors.New("unable to read file[" + filePath + "] encryption, sse-c files written with their own key cannot be copied : " + err.Error())
+	}
+
+	// En fonction du mode
+	switch encryptionFromHeaders(stat.Metadata) {
+	case backend.ENCRYPTION_SSE_C:
+		if b.readServerSide() == nil {
+			return nil, nil, errors.New("file[" + filePath + "] is encrypted with sse-c, the customer key is required to copy it")
+		}
+		return b.readServerSide(), b.readServerSide(), nil
+	case backend.ENCRYPTION_SSE_KMS:
+		sse, err := encrypt.NewSSEKMS(stat.Metadata.Get(encrypt.SseKmsKeyID), nil)
+		return nil, sse, err
+	case backend.ENCRYPTION_SSE_S3:
+		return nil, encrypt.NewSSE(), nil
+	}
+
+	return nil, nil, nil
+}
+
+func encryptionFromHeaders(headers http.Header) backend.EncryptionMode {
+	// On deduit le mode des entetes renvoyes par S3
+	if headers.Get(encrypt.SseCustomerAlgorithm) != "" {
+		return backend.ENCRYPTION_SSE_C
+	}
+	switch headers.Get(encrypt.SseGenericHeader) {
+	case "aws:kms":
+		return backend.ENCRYPTION_SSE_KMS
+	case "AES256":
+		return backend.ENCRYPTION_SSE_S3
+	}
+
+	return backend.ENCRYPTION_NONE
+}
+
+func parseEncryption(mode string, kmsKeyID string, kmsContext string, customerKey string) (backend.Encryption, error) {
+	// On initialise
+	enc := backend.Encryption{
+		Mode:     backend.EncryptionMode(strings.ToLower(mode)),
+		KMSKeyID: kmsKeyID,
+	}
+	if enc.Mode == "none" {
+		enc.Mode = backend.ENCRYPTION_NONE
+	}
+
+	// Le contexte KMS est de la forme cle1=valeur1,cle2=valeur2
+	if kmsContext != "" {
+		enc.KMSContext = make(map[string]string)
+		for _, pair := range strings.Split(kmsContext, ",") {
+			key, value, found := strings.Cut(pair, "=")
+			if !found {
+				return enc, errors.New("invalid kms context, expected key=value pairs")
+			}
+			enc.KMSContext[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+
+	// La cle client est encodee en base64
+	if customerKey != "" {
+		key, err := base64.StdEncoding.DecodeString(customerKey)
+		if err != nil {
+			return enc, errors.New("invalid sse-c customer key, expected base64 : " + err.Error())
+		}
+		enc.CustomerKey = key
+	}
+
+	// On verifie que la configuration est utilisable
+	if _, err := newServerSide(enc); err != nil {
+		return enc, err
+	}
+
+	return enc, nil
+}
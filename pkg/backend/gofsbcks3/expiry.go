@@ -0,0 +1,70 @@
+package gofsbcks3
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+// withExpiry ajoute l'expiration du fichier a ses metadonnees, sans modifier celles des options
+func withExpiry(opts backend.WriteOptions) map[string]string {
+	expiresAt := opts.Expiry(time.Now())
+	if expiresAt.IsZero() {
+		return opts.Metadata
+	}
+	metadata := make(map[string]string, len(opts.Metadata)+1)
+	for key, value := range opts.Metadata {
+		metadata[key] = value
+	}
+	metadata[backend.META_EXPIRES_AT] = expiresAt.UTC().Format(time.RFC3339Nano)
+
+	return metadata
+}
+
+// splitExpiry separe l'expiration des metadonnees utilisateur
+func splitExpiry(metadata map[string]string) (map[string]string, time.Time) {
+	value, exists := metadata[backend.META_EXPIRES_AT]
+	if !exists {
+		return metadata, time.Time{}
+	}
+	delete(metadata, backend.META_EXPIRES_AT)
+	if len(metadata) == 0 {
+		metadata = nil
+	}
+
+	// Une date invalide est ignoree
+	expiresAt, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return metadata, time.Time{}
+	}
+
+	return metadata, expiresAt
+}
+
+// ListExpired liste les objets ayant expire, leur expiration n'etant disponible qu'avec leurs infos
+func (b *S3Backend) ListExpired(ctx context.Context, path string, now time.Time) ([]string, error) {
+	// On recupere les fichiers
+	files, err := b.List(ctx, path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	// On garde ceux qui ont expire
+	expired := make([]string, 0)
+	for _, file := range files {
+		filePath := path + file
+		stat, err := b.statObject(ctx, filePath)
+		if errors.Is(err, backend.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, errors.New("unable to stat file[" + filePath + "] : " + err.Error())
+		}
+		if _, expiresAt := splitExpiry(normalizeMetadata(stat.UserMetadata)); backend.IsExpired(expiresAt, now) {
+			expired = append(expired, filePath)
+		}
+	}
+
+	return expired, nil
+}
@@ -0,0 +1,115 @@
+package gofsbcks3
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"strings"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/minio/minio-go/v7"
+)
+
+// ListFiltered applique les filtres avec les infos renvoyees par le listing, sans interroger les fichiers un par un.
+// Le listing est restreint au prefixe commun des globs
+func (b *S3Backend) ListFiltered(ctx context.Context, path string, opts backend.ListOptions) ([]string, error) {
+	// On compile les options
+	filter, err := backend.NewListFilter(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// On initialise
+	pathWithPrefix := addPrefixedPath(b, path)
+	listPrefix := pathWithPrefix
+	if path == "" || strings.HasSuffix(path, "/") {
+		listPrefix += filter.LiteralPrefix()
+	}
+	entries := make([]backend.ListEntry, 0)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	b.logger.Debug().
+		Str("op", "ListFiltered").
+		Str("path", listPrefix).
+		Send()
+
+	// On recupere la liste
+	objects := b.client.ListObjects(ctx, b.Config.BucketName, minio.ListObjectsOptions{
+		Prefix:    listPrefix,
+		Recursive: opts.Recursive,
+	})
+	for object := range objects {
+		if object.Err != nil {
+			return nil, errors.New("S3 Object error : " + object.Err.Error())
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		file := object.Key[len(pathWithPrefix):]
+		if !filter.MatchName(file) {
+			continue
+		}
+		entries = append(entries, backend.ListEntry{
+			Path: file,
+			Info: backend.FileInfo{
+				Size:         object.Size,
+				ContentType:  object.ContentType,
+				ETag:         object.ETag,
+				LastModified: object.LastModified,
+			},
+		})
+	}
+
+	return filter.Apply(entries), nil
+}
+
+// ReadDir liste un seul niveau du dossier, les sous dossiers etant deduits des prefixes communs.
+// Un dossier sans objet n'existe pas
+func (b *S3Backend) ReadDir(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+	// On initialise
+	dir = backend.CleanDir(dir)
+	dirPrefix := ""
+	if dir != "." {
+		dirPrefix = dir + "/"
+	}
+	prefixWithPath := addPrefixedPath(b, dirPrefix)
+	entries := make([]fs.DirEntry, 0)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	b.logger.Debug().
+		Str("op", "ReadDir").
+		Str("path", prefixWithPath).
+		Send()
+
+	// On recupere le niveau demande
+	objects := b.client.ListObjects(ctx, b.Config.BucketName, minio.ListObjectsOptions{
+		Prefix:    prefixWithPath,
+		Recursive: false,
+	})
+	for object := range objects {
+		if object.Err != nil {
+			return nil, errors.New("S3 Object error : " + object.Err.Error())
+		}
+		name := object.Key[len(prefixWithPath):]
+		if name == "" {
+			continue
+		}
+		if strings.HasSuffix(name, "/") {
+			entries = append(entries, backend.NewDirEntry(strings.TrimSuffix(name, "/"), true, backend.FileInfo{}))
+			continue
+		}
+		entries = append(entries, backend.NewDirEntry(name, false, backend.FileInfo{
+			Size:         object.Size,
+			ContentType:  object.ContentType,
+			ETag:         object.ETag,
+			LastModified: object.LastModified,
+		}))
+	}
+	if len(entries) == 0 && dir != "." {
+		return nil, backend.ErrNotExist
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,157 @@
+package gofsbcks3
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/minio/minio-go/v7"
+)
+
+// SetRetention applique une retention object lock, le bucket doit avoir ete cree avec l'object lock active.
+// Une retention GOVERNANCE peut etre reduite ou retiree, la permission s3:BypassGovernanceRetention est alors requise
+func (b *S3Backend) SetRetention(ctx context.Context, filePath string, mode backend.RetentionMode, until time.Time) error {
+	// On initialise
+	filePathWithPrefix := addPrefixedPath(b, filePath)
+
+	b.logger.Debug().
+		Str("op", "SetRetention").
+		Str("path", filePathWithPrefix).
+		Str("mode", string(mode)).
+		Time("until", until).
+		Send()
+
+	// On verifie que la retention peut etre remplacee, S3 le refuserait de toute facon
+	fileInfo, err := b.Stat(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	if err = backend.ValidateRetention(filePath, fileInfo.Lock, mode, until, time.Now()); err != nil {
+		return err
+	}
+
+	// On applique la retention, une retention vide la retire
+	opts := minio.PutObjectRetentionOptions{GovernanceBypass: true}
+	if mode != backend.RETENTION_NONE {
+		retentionMode := minio.RetentionMode(mode)
+		until = until.UTC()
+		opts.Mode = &retentionMode
+		opts.RetainUntilDate = &until
+	}
+
+	return toBackendError(b.client.PutObjectRetention(ctx, b.Config.BucketName, filePathWithPrefix, opts))
+}
+
+func (b *S3Backend) SetLegalHold(ctx context.Context, filePath string, on bool) error {
+	// On initialise
+	filePathWithPrefix := addPrefixedPath(b, filePath)
+	status := minio.LegalHoldDisabled
+	if on {
+		status = minio.LegalHoldEnabled
+	}
+
+	b.logger.Debug().
+		Str("op", "SetLegalHold").
+		Str("path", filePathWithPrefix).
+		Bool("on", on).
+		Send()
+
+	return toBackendError(b.client.PutObjectLegalHold(ctx, b.Config.BucketName, filePathWithPrefix, minio.PutObjectLegalHoldOptions{
+		Status: &status,
+	}))
+}
+
+func (b *S3Backend) GetLock(ctx context.Context, filePath string) (backend.Lock, error) {
+	fileInfo, err := b.Stat(ctx, filePath)
+	return fileInfo.Lock, err
+}
+
+func lockFromHeaders(headers http.Header) backend.Lock {
+	// On deduit la protection des entetes renvoyes par S3
+	lock := backend.Lock{
+		Mode:      backend.RetentionMode(headers.Get("X-Amz-Object-Lock-Mode")),
+		LegalHold: headers.Get("X-Amz-Object-Lock-Legal-Hold") == string(minio.LegalHoldEnabled),
+	}
+	if until, err := time.Parse(time.RFC3339, headers.Get("X-Amz-Object-Lock-Retain-Until-Date")); err == nil {
+		lock.RetainUntil = until
+	}
+
+	return lock
+}
+
+// objectLock renvoie la protection de l'objet, une protection vide s'il n'existe pas.
+// Si les entetes ne peuvent pas etre lus, par exemple pour un objet SSE-C ecrit avec une autre cle,
+// on interroge directement la retention et la legal hold
+func (b *S3Backend) objectLock(ctx context.Context, filePath string) (backend.Lock, error) {
+	// On lit les entetes de l'objet
+	stat, err := b.statObject(ctx, filePath)
+	if errors.Is(err, backend.ErrNotExist) {
+		return backend.Lock{}, nil
+	} else if err == nil {
+		return lockFromHeaders(stat.Metadata), nil
+	}
+
+	// Sinon on interroge l'API object lock, un bucket sans object lock n'ayant aucune protection
+	lock := backend.Lock{}
+	filePathWithPrefix := addPrefixedPath(b, filePath)
+	mode, until, retentionErr := b.client.GetObjectRetention(ctx, b.Config.BucketName, filePathWithPrefix, "")
+	if retentionErr != nil && !isNoLockConfiguration(retentionErr) {
+		return lock, errors.New("unable to get object retention : " + retentionErr.Error())
+	}
+	if mode != nil && until != nil {
+		lock.Mode = backend.RetentionMode(*mode)
+		lock.RetainUntil = *until
+	}
+	status, holdErr := b.client.GetObjectLegalHold(ctx, b.Config.BucketName, filePathWithPrefix, minio.GetObjectLegalHoldOptions{})
+	if holdErr != nil && !isNoLockConfiguration(holdErr) {
+		return lock, errors.New("unable to get object legal hold : " + holdErr.Error())
+	}
+	lock.LegalHold = status != nil && *status == minio.LegalHoldEnabled
+
+	return lock, nil
+}
+
+// checkLock renvoie une LockedError si l'objet est protege. S3 accepterait sinon d'ecrire une nouvelle version
+// ou un marqueur de suppression sur un bucket versionne, alors que le fichier doit rester inchange
+func (b *S3Backend) checkLock(ctx context.Context, filePath string) error {
+	lock, err := b.objectLock(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	if lock.IsLocked(time.Now()) {
+		return &backend.LockedError{Path: filePath, Lock: lock}
+	}
+
+	return nil
+}
+
+// toLockedError convertit un refus de S3 du a une protection en LockedError
+func (b *S3Backend) toLockedError(ctx context.Context, filePath string, err error) error {
+	if err == nil {
+		return nil
+	}
+	code := minio.ToErrorResponse(err).Code
+	if code != "ObjectLocked" && code != "AccessDenied" {
+		return toBackendError(err)
+	}
+
+	// Un refus d'acces n'est du a la protection que si l'objet est protege
+	lock, lockErr := b.objectLock(ctx, filePath)
+	if lockErr == nil && (code == "ObjectLocked" || lock.IsLocked(time.Now())) {
+		return &backend.LockedError{Path: filePath, Lock: lock}
+	}
+
+	return err
+}
+
+// isNoLockConfiguration indique que le bucket ou l'objet n'a pas de protection configuree
+func isNoLockConfiguration(err error) bool {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchObjectLockConfiguration", "ObjectLockConfigurationNotFoundError", "InvalidRequest":
+		return true
+	}
+
+	return false
+}
@@ -5,14 +5,22 @@ import (
 	"context"
 	"errors"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/craimbault/go-fs/internal/backend"
 	"github.com/minio/minio-go/v7"
-	"github.com/minio/minio-go/v7/pkg/credentials"
-	"github.com/rs/zerolog/log"
+	"github.com/minio/minio-go/v7/pkg/encrypt"
+	"github.com/rs/zerolog"
 )
 
-const BACKEND_NAME = "s3"
+const (
+	BACKEND_NAME = "s3"
+
+	// Taille des parties envoyees pour les flux de taille inconnue. Sans elle, le client reserve
+	// des parties de plus de 500 Mio afin d'atteindre 5 Tio, la taille est ici limitee a 160 Gio
+	STREAM_PART_SIZE = 16 << 20
+)
 
 type S3Config struct {
 	Endpoint        string
@@ -23,32 +31,66 @@ type S3Config struct {
 	BucketName      string
 	PathPrefix      string
 	Debug           bool
+
+	// Fournisseur d'identifiants (CREDENTIALS_PROVIDER_*), static par defaut
+	CredentialsProvider string
+	SessionToken        string
+	// Fichier et profil (ou alias MinIO) pour les fournisseurs aws_file, minio_file et chain
+	CredentialsFile    string
+	CredentialsProfile string
+	// Configuration STS pour le fournisseur web_identity
+	STSEndpoint          string
+	WebIdentityTokenFile string
+	RoleARN              string
+
+	// Chiffrement cote serveur applique par defaut aux ecritures.
+	// En mode SSE-C la cle est aussi envoyee pour les lectures, stats et copies
+	Encryption backend.Encryption
+
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
 }
 
 type S3Backend struct {
 	client *minio.Client
+	sse    encrypt.ServerSide
 	Config S3Config
+	logger zerolog.Logger
 }
 
 func New(config S3Config) (*S3Backend, error) {
 	// On initialise le backend
 	backend := S3Backend{
 		Config: config,
+		logger: backend.NewLogger(config.Logger, BACKEND_NAME, config.Debug),
 	}
 
 	// On informe
-	log.Debug().
-		Str("backend", "local").
+	backend.logger.Debug().
 		Str("endpoint", config.Endpoint).
 		Str("region", config.Region).
 		Str("bucket_name", config.BucketName).
 		Str("access_key", config.AccessKeyID).
+		Str("credentials_provider", config.CredentialsProvider).
+		Stringer("encryption", config.Encryption).
 		Str("prefix", config.PathPrefix).
 		Msg("Starting backend ...")
 
+	// On initialise les identifiants
+	creds, err := newCredentials(config)
+	if err != nil {
+		return &backend, err
+	}
+
+	// On initialise le chiffrement
+	backend.sse, err = newServerSide(config.Encryption)
+	if err != nil {
+		return &backend, err
+	}
+
 	// On initialise le client
 	s3Client, err := minio.New(config.Endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(config.AccessKeyID, config.SecretAccessKey, ""),
+		Creds:  creds,
 		Secure: config.UseSSL,
 		Region: config.Region,
 	})
@@ -71,14 +113,19 @@ func New(config S3Config) (*S3Backend, error) {
 	return &backend, nil
 }
 
-func (b *S3Backend) List(path string, recursive bool) ([]string, error) {
+func (b *S3Backend) List(ctx context.Context, path string, recursive bool) ([]string, error) {
 	// On initialise
 	pathWithPrefix := addPrefixedPath(b, path)
 	files := make([]string, 0)
 	pathLen := len(pathWithPrefix)
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	b.logger.Debug().
+		Str("op", "List").
+		Str("path", pathWithPrefix).
+		Send()
+
 	// On recupere la liste
 	objects := b.client.ListObjects(ctx, b.Config.BucketName, minio.ListObjectsOptions{
 		Prefix:    pathWithPrefix,
@@ -101,44 +148,74 @@ func (b *S3Backend) List(path string, recursive bool) ([]string, error) {
 	return files, nil
 }
 
-func (b *S3Backend) Stat(filePath string) (backend.FileInfo, error) {
+func (b *S3Backend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	// On recupere les infos
+	stat, err := b.statObject(ctx, filePath)
+	if err != nil {
+		return backend.FileInfo{}, err
+	}
+
+	// Un fichier expire n'existe plus, en attendant sa suppression
+	metadata, expiresAt := splitExpiry(normalizeMetadata(stat.UserMetadata))
+	if backend.IsExpired(expiresAt, time.Now()) {
+		return backend.FileInfo{}, backend.ErrNotExist
+	}
+
+	// On renvoi les infos
+	return backend.FileInfo{
+		Size:         stat.Size,
+		ContentType:  stat.ContentType,
+		ETag:         stat.ETag,
+		LastModified: stat.LastModified,
+		Encryption:   encryptionFromHeaders(stat.Metadata),
+		VersionID:    stat.VersionID,
+		Lock:         lockFromHeaders(stat.Metadata),
+		ExpiresAt:    expiresAt,
+		Metadata:     metadata,
+	}, nil
+}
+
+// statObject renvoie les infos brutes de l'objet, meme s'il a expire
+func (b *S3Backend) statObject(ctx context.Context, filePath string) (minio.ObjectInfo, error) {
 	// On initialise
-	var fileInfo = backend.FileInfo{}
 	filePathWithPrefix := addPrefixedPath(b, filePath)
 
 	// On recupere les infos
 	stat, err := b.client.StatObject(
-		context.Background(),
+		ctx,
 		b.Config.BucketName,
 		filePathWithPrefix,
-		minio.GetObjectOptions{},
+		minio.GetObjectOptions{ServerSideEncryption: b.readServerSide()},
 	)
 
 	// Si l'on a une erreur
 	if err != nil {
-		log.Debug().Str("filepath", filePathWithPrefix).Msg("Unable to get file stats")
-		return fileInfo, err
+		b.logger.Debug().
+			Str("op", "Stat").
+			Str("path", filePathWithPrefix).
+			Err(err).
+			Msg("Unable to get file stats")
+		return stat, toBackendError(err)
 	}
 
-	// On renvoi les infos
-	return backend.FileInfo{
-		Size:         stat.Size,
-		ContentType:  stat.ContentType,
-		ETag:         stat.ETag,
-		LastModified: stat.LastModified,
-	}, nil
+	return stat, nil
 }
 
-func (b *S3Backend) Read(filePath string) ([]byte, error) {
+func (b *S3Backend) Read(ctx context.Context, filePath string) ([]byte, error) {
 	// On initialise
 	filePathWithPrefix := addPrefixedPath(b, filePath)
 
+	b.logger.Debug().
+		Str("op", "Read").
+		Str("path", filePathWithPrefix).
+		Send()
+
 	// On va chercher le fichier
 	object, err := b.client.GetObject(
-		context.Background(),
+		ctx,
 		b.Config.BucketName,
 		filePathWithPrefix,
-		minio.GetObjectOptions{},
+		minio.GetObjectOptions{ServerSideEncryption: b.readServerSide()},
 	)
 
 	if err != nil {
@@ -147,12 +224,26 @@ func (b *S3Backend) Read(filePath string) ([]byte, error) {
 
 	defer object.Close()
 
+	// On verifie que le fichier n'a pas expire
+	stat, err := object.Stat()
+	if err != nil {
+		return nil, toBackendError(err)
+	}
+	if _, expiresAt := splitExpiry(normalizeMetadata(stat.UserMetadata)); backend.IsExpired(expiresAt, time.Now()) {
+		return nil, backend.ErrNotExist
+	}
+
 	// On lit tout le contenu
-	return io.ReadAll(object)
+	data, err := io.ReadAll(object)
+	if err != nil {
+		return nil, toBackendError(err)
+	}
+
+	return data, nil
 }
 
-func (b *S3Backend) ReadString(filePath string) (string, error) {
-	data, err := b.Read(filePath)
+func (b *S3Backend) ReadString(ctx context.Context, filePath string) (string, error) {
+	data, err := b.Read(ctx, filePath)
 	if err != nil {
 		return "", err
 	}
@@ -160,107 +251,254 @@ func (b *S3Backend) ReadString(filePath string) (string, error) {
 	return string(data), nil
 }
 
-func (b *S3Backend) ReadStream(filePath string) (backend.FileStream, error) {
+func (b *S3Backend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
 	// On initialise
 	fileStream := backend.FileStream{}
 	filePathWithPrefix := addPrefixedPath(b, filePath)
+	readOpts := backend.MergeReadOptions(opts)
+	getOpts := minio.GetObjectOptions{ServerSideEncryption: b.readServerSide()}
+
+	b.logger.Debug().
+		Str("op", "ReadStream").
+		Str("path", filePathWithPrefix).
+		Send()
+
+	// On recupere les infos du fichier
+	fileInfo, err := b.Stat(ctx, filePath)
+	if errors.Is(err, backend.ErrNotExist) {
+		return fileStream, err
+	} else if err != nil {
+		return fileStream, errors.New("Unable to get the informations about the requested file : " + err.Error())
+	}
+	fileStream.ContentType = fileInfo.ContentType
+	fileStream.Size = fileInfo.Size
+
+	// Si l'on ne lit qu'une partie du fichier
+	if readOpts.Offset > 0 || readOpts.Length > 0 {
+		if readOpts.Offset > fileInfo.Size {
+			return fileStream, errors.New("read offset is beyond the end of file")
+		}
+		fileStream.Size = fileInfo.Size - readOpts.Offset
+		if readOpts.Length > 0 && readOpts.Length < fileStream.Size {
+			fileStream.Size = readOpts.Length
+		}
+		if fileStream.Size > 0 {
+			getOpts.SetRange(readOpts.Offset, readOpts.Offset+fileStream.Size-1)
+		}
+	}
 
 	// On va chercher le fichier
 	object, err := b.client.GetObject(
-		context.Background(),
+		ctx,
 		b.Config.BucketName,
 		filePathWithPrefix,
-		minio.GetObjectOptions{},
+		getOpts,
 	)
 	if err != nil {
-		log.Debug().Msg("1")
 		return fileStream, errors.New("Unable to get the requested file : " + err.Error())
 	}
 
-	// On recupere les infos du fichier
-	fileInfo, err := b.Stat(filePath)
-	if err != nil {
-		return fileStream, errors.New("Unable to get the informations about the requested file : " + err.Error())
-	}
-
-	// On hydrate notre retour
+	// Si l'on a rien a lire, le Range serait invalide
 	fileStream.Content = object
-	fileStream.ContentType = fileInfo.ContentType
-	fileStream.Size = fileInfo.Size
+	if fileStream.Size == 0 && fileInfo.Size > 0 {
+		object.Close()
+		fileStream.Content = io.NopCloser(strings.NewReader(""))
+	}
 
 	// On renvoi tout
 	return fileStream, nil
 }
 
-func (b *S3Backend) Write(filePath string, data []byte) error {
+func (b *S3Backend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
 	// On initialise
 	filePathWithPrefix := addPrefixedPath(b, filePath)
 
-	log.Debug().Msg("FILE PATH : " + filePathWithPrefix)
+	b.logger.Debug().
+		Str("op", "Write").
+		Str("path", filePathWithPrefix).
+		Send()
+
+	// On recupere le chiffrement
+	writeOpts := backend.MergeWriteOptions(opts)
+	sse, err := b.writeServerSide(writeOpts)
+	if err != nil {
+		return err
+	}
+
+	// On verifie que le fichier n'est pas protege
+	if err = b.checkLock(ctx, filePath); err != nil {
+		return err
+	}
 
 	// On ecrit le fichier
-	_, err := b.client.PutObject(
-		context.Background(),
+	_, err = b.client.PutObject(
+		ctx,
 		b.Config.BucketName,
 		filePathWithPrefix,
 		bytes.NewReader(data),
 		int64(len(data)),
-		minio.PutObjectOptions{},
+		minio.PutObjectOptions{ServerSideEncryption: sse, UserMetadata: withExpiry(writeOpts)},
 	)
-	return err
+	return b.toLockedError(ctx, filePath, err)
 }
 
-func (b *S3Backend) WriteString(filePath string, content string) error {
-	return b.Write(filePath, []byte(content))
+func (b *S3Backend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	return b.Write(ctx, filePath, []byte(content), opts...)
 }
 
-func (b *S3Backend) WriteStream(filePath string, stream io.ReadCloser, length int64) error {
+func (b *S3Backend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
 	// On initialise
 	filePathWithPrefix := addPrefixedPath(b, filePath)
 
+	b.logger.Debug().
+		Str("op", "WriteStream").
+		Str("path", filePathWithPrefix).
+		Send()
+
+	// On recupere le chiffrement
+	writeOpts := backend.MergeWriteOptions(opts)
+	sse, err := b.writeServerSide(writeOpts)
+	if err != nil {
+		return err
+	}
+
+	// On verifie que le fichier n'est pas protege
+	if err = b.checkLock(ctx, filePath); err != nil {
+		return err
+	}
+
 	// On ecrit le fichier
-	_, err := b.client.PutObject(
-		context.Background(),
+	putOpts := minio.PutObjectOptions{ServerSideEncryption: sse, UserMetadata: withExpiry(writeOpts)}
+	if length < 0 {
+		putOpts.PartSize = STREAM_PART_SIZE
+	}
+	_, err = b.client.PutObject(
+		ctx,
 		b.Config.BucketName,
 		filePathWithPrefix,
 		stream,
 		int64(length),
-		minio.PutObjectOptions{},
+		putOpts,
 	)
-	return err
+	return b.toLockedError(ctx, filePath, err)
 }
 
-func (b *S3Backend) Move(filePathSrc string, filePathDst string) error {
-	// On recupere le contenu du fichier source
-	srcFile, err := b.ReadStream(filePathSrc)
-	if err != nil {
-		return errors.New("Unable to read src file : " + err.Error())
+func (b *S3Backend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	b.logger.Debug().
+		Str("op", "Copy").
+		Str("src", addPrefixedPath(b, filePathSrc)).
+		Str("dst", addPrefixedPath(b, filePathDst)).
+		Send()
+
+	// On verifie que la destination n'est pas protegee
+	if err := b.checkLock(ctx, filePathDst); err != nil {
+		return err
 	}
-	defer srcFile.Content.Close()
 
-	// On reecrit le fichier de destination
-	err = b.WriteStream(
-		filePathDst,
-		srcFile.Content,
-		srcFile.Size,
-	)
+	// On copie directement cote serveur, la destination conservant le chiffrement de la source
+	srcSSE, dstSSE, err := b.copyServerSide(ctx, filePathSrc)
 	if err != nil {
 		return err
 	}
+	_, err = b.client.CopyObject(
+		ctx,
+		minio.CopyDestOptions{
+			Bucket:     b.Config.BucketName,
+			Object:     addPrefixedPath(b, filePathDst),
+			Encryption: dstSSE,
+		},
+		minio.CopySrcOptions{
+			Bucket:     b.Config.BucketName,
+			Object:     addPrefixedPath(b, filePathSrc),
+			Encryption: srcSSE,
+		},
+	)
+	return b.toLockedError(ctx, filePathDst, err)
+}
+
+func (b *S3Backend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	// La source sera supprimee, elle ne doit pas etre protegee
+	if err := b.checkLock(ctx, filePathSrc); err != nil {
+		return err
+	}
+
+	// On copie le fichier source vers la destination
+	if err := b.Copy(ctx, filePathSrc, filePathDst); err != nil {
+		return err
+	}
 
 	// On supprime le fichier source
-	return b.Delete(filePathSrc)
+	return b.Delete(ctx, filePathSrc)
 }
 
-func (b *S3Backend) Delete(filePath string) error {
+func (b *S3Backend) Delete(ctx context.Context, filePath string) error {
 	// On initialise
 	filePathWithPrefix := addPrefixedPath(b, filePath)
 
+	b.logger.Debug().
+		Str("op", "Delete").
+		Str("path", filePathWithPrefix).
+		Send()
+
+	// On verifie que le fichier n'est pas protege, S3 ajouterait sinon un marqueur de suppression
+	if err := b.checkLock(ctx, filePath); err != nil {
+		return err
+	}
+
 	// On supprime
-	return b.client.RemoveObject(
-		context.Background(),
+	return b.toLockedError(ctx, filePath, b.client.RemoveObject(
+		ctx,
 		b.Config.BucketName,
 		filePathWithPrefix,
 		minio.RemoveObjectOptions{},
+	))
+}
+
+func (b *S3Backend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	// On initialise
+	filePathWithPrefix := addPrefixedPath(b, filePath)
+
+	b.logger.Debug().
+		Str("op", "SetMetadata").
+		Str("path", filePathWithPrefix).
+		Send()
+
+	// On recupere le type de contenu, qui serait perdu lors du remplacement, et on verifie la protection
+	fileInfo, err := b.Stat(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	if fileInfo.Lock.IsLocked(time.Now()) {
+		return &backend.LockedError{Path: filePath, Lock: fileInfo.Lock}
+	}
+	userMetadata := map[string]string{"Content-Type": fileInfo.ContentType}
+	for key, value := range metadata {
+		userMetadata[strings.ToLower(key)] = value
+	}
+	// On conserve l'expiration du fichier
+	if !fileInfo.ExpiresAt.IsZero() {
+		userMetadata[backend.META_EXPIRES_AT] = fileInfo.ExpiresAt.UTC().Format(time.RFC3339Nano)
+	}
+
+	// On copie le fichier sur lui meme en remplacant les metadonnees, le contenu et son chiffrement restant inchanges
+	srcSSE, dstSSE, err := b.copyServerSide(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.CopyObject(
+		ctx,
+		minio.CopyDestOptions{
+			Bucket:          b.Config.BucketName,
+			Object:          filePathWithPrefix,
+			Encryption:      dstSSE,
+			UserMetadata:    userMetadata,
+			ReplaceMetadata: true,
+		},
+		minio.CopySrcOptions{
+			Bucket:     b.Config.BucketName,
+			Object:     filePathWithPrefix,
+			Encryption: srcSSE,
+		},
 	)
+	return toBackendError(err)
 }
@@ -1,20 +1,230 @@
 package gofsbcks3
 
-import "gopkg.in/ini.v1"
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/internal/iniconfig"
+	"github.com/craimbault/go-fs/internal/urlconfig"
+	"github.com/minio/minio-go/v7"
+	"gopkg.in/ini.v1"
+)
 
 func addPrefixedPath(b *S3Backend, path string) string {
 	return b.Config.PathPrefix + path
 }
 
+func toBackendError(err error) error {
+	// Si l'objet n'existe pas, on renvoie l'erreur commune aux backends
+	if err != nil && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return backend.ErrNotExist
+	}
+
+	return err
+}
+
+func normalizeMetadata(metadata map[string]string) map[string]string {
+	// S3 renvoie les cles avec une casse canonique, on les passe en minuscules
+	if len(metadata) == 0 {
+		return nil
+	}
+	normalized := make(map[string]string, len(metadata))
+	for key, value := range metadata {
+		normalized[strings.ToLower(key)] = value
+	}
+
+	return normalized
+}
+
+// NewConfigFromIniSection lit la section sans la verifier, une cle absente ou invalide prenant sa valeur par defaut
 func NewConfigFromIniSection(section *ini.Section) S3Config {
-	return S3Config{
-		Endpoint:        section.Key("endpoint").MustString("localhost:9000"),
-		Region:          section.Key("region").MustString("us-east-1"),
-		AccessKeyID:     section.Key("access_key").MustString("minioaccesskey"),
-		SecretAccessKey: section.Key("secret_key").MustString("miniosecretkey"),
-		UseSSL:          section.Key("ssl").MustBool(true),
-		BucketName:      section.Key("bucket_name").MustString("gofs"),
-		PathPrefix:      section.Key("path_prefix").MustString(""),
-		Debug:           section.Key("debug").MustBool(false),
+	config := S3Config{
+		Endpoint:             section.Key("endpoint").MustString("localhost:9000"),
+		Region:               section.Key("region").MustString("us-east-1"),
+		AccessKeyID:          section.Key("access_key").MustString("minioaccesskey"),
+		SecretAccessKey:      section.Key("secret_key").MustString("miniosecretkey"),
+		UseSSL:               section.Key("ssl").MustBool(true),
+		BucketName:           section.Key("bucket_name").MustString("gofs"),
+		PathPrefix:           section.Key("path_prefix").MustString(""),
+		Debug:                section.Key("debug").MustBool(false),
+		CredentialsProvider:  section.Key("credentials_provider").MustString(CREDENTIALS_PROVIDER_STATIC),
+		SessionToken:         section.Key("session_token").MustString(""),
+		CredentialsFile:      section.Key("credentials_file").MustString(""),
+		CredentialsProfile:   section.Key("credentials_profile").MustString(""),
+		STSEndpoint:          section.Key("sts_endpoint").MustString(""),
+		WebIdentityTokenFile: section.Key("web_identity_token_file").MustString(""),
+		RoleARN:              section.Key("role_arn").MustString(""),
+	}
+	config.Encryption, _ = parseEncryption(
+		section.Key("sse").MustString(""),
+		section.Key("sse_kms_key_id").MustString(""),
+		section.Key("sse_kms_context").MustString(""),
+		section.Key("sse_c_key").MustString(""),
+	)
+
+	return config
+}
+
+// NewConfigFromIniSectionE lit la section en renvoyant une erreur si une cle obligatoire manque ou est invalide
+func NewConfigFromIniSectionE(section *ini.Section) (S3Config, error) {
+	// On initialise avec les valeurs par defaut
+	config := S3Config{
+		Region:               iniconfig.String(section, "region", "us-east-1"),
+		PathPrefix:           iniconfig.String(section, "path_prefix", ""),
+		AccessKeyID:          iniconfig.String(section, "access_key", ""),
+		SecretAccessKey:      iniconfig.String(section, "secret_key", ""),
+		CredentialsProvider:  iniconfig.String(section, "credentials_provider", CREDENTIALS_PROVIDER_STATIC),
+		SessionToken:         iniconfig.String(section, "session_token", ""),
+		CredentialsFile:      iniconfig.String(section, "credentials_file", ""),
+		CredentialsProfile:   iniconfig.String(section, "credentials_profile", ""),
+		STSEndpoint:          iniconfig.String(section, "sts_endpoint", ""),
+		WebIdentityTokenFile: iniconfig.String(section, "web_identity_token_file", ""),
+		RoleARN:              iniconfig.String(section, "role_arn", ""),
+	}
+	var err error
+
+	// On recupere les cles obligatoires
+	if config.Endpoint, err = iniconfig.RequiredString(section, "endpoint"); err != nil {
+		return config, err
+	}
+	if config.BucketName, err = iniconfig.RequiredString(section, "bucket_name"); err != nil {
+		return config, err
+	}
+	if err = validateCredentials(config); err != nil {
+		return config, errors.New(err.Error() + " in section[" + section.Name() + "]")
+	}
+
+	// On recupere les options
+	if config.UseSSL, err = iniconfig.Bool(section, "ssl", true); err != nil {
+		return config, err
+	}
+	config.Encryption, err = parseEncryption(
+		iniconfig.String(section, "sse", ""),
+		iniconfig.String(section, "sse_kms_key_id", ""),
+		iniconfig.String(section, "sse_kms_context", ""),
+		iniconfig.String(section, "sse_c_key", ""),
+	)
+	if err != nil {
+		return config, errors.New(err.Error() + " in section[" + section.Name() + "]")
+	}
+	if config.Debug, err = iniconfig.Bool(section, "debug", false); err != nil {
+		return config, err
+	}
+
+	return config, nil
+}
+
+// NewConfigFromURL lit une configuration de la forme
+// s3://access_key:secret_key@endpoint/bucket_name/path_prefix?ssl=false&region=eu-west-1
+func NewConfigFromURL(u *url.URL) (S3Config, error) {
+	// On initialise
+	query := u.Query()
+	config := S3Config{
+		Endpoint:             u.Host,
+		Region:               urlconfig.String(query, "region", "us-east-1"),
+		AccessKeyID:          u.User.Username(),
+		CredentialsProvider:  urlconfig.String(query, "credentials", CREDENTIALS_PROVIDER_STATIC),
+		SessionToken:         urlconfig.String(query, "session_token", ""),
+		CredentialsFile:      urlconfig.String(query, "credentials_file", ""),
+		CredentialsProfile:   urlconfig.String(query, "profile", ""),
+		STSEndpoint:          urlconfig.String(query, "sts_endpoint", ""),
+		WebIdentityTokenFile: urlconfig.String(query, "web_identity_token_file", ""),
+		RoleARN:              urlconfig.String(query, "role_arn", ""),
+	}
+	var err error
+
+	// On verifie les parametres
+	err = urlconfig.CheckParams(
+		query,
+		"region", "ssl", "debug", "credentials", "session_token", "credentials_file",
+		"profile", "sts_endpoint", "web_identity_token_file", "role_arn",
+		"sse", "sse_kms_key_id", "sse_kms_context", "sse_c_key",
+	)
+	if err != nil {
+		return config, err
+	}
+
+	// On recupere les identifiants
+	config.SecretAccessKey, _ = u.User.Password()
+	if err = validateCredentials(config); err != nil {
+		return config, err
+	}
+
+	// On recupere le bucket et le prefixe depuis le chemin
+	if config.Endpoint == "" {
+		return config, errors.New("missing endpoint in s3 url")
+	}
+	bucketPath := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+	if config.BucketName = bucketPath[0]; config.BucketName == "" {
+		return config, errors.New("missing bucket name in s3 url")
+	}
+	if len(bucketPath) == 2 && bucketPath[1] != "" {
+		config.PathPrefix = strings.TrimSuffix(bucketPath[1], "/") + "/"
+	}
+
+	// On recupere les options
+	if config.UseSSL, err = urlconfig.Bool(query, "ssl", true); err != nil {
+		return config, err
+	}
+	config.Encryption, err = parseEncryption(
+		urlconfig.String(query, "sse", ""),
+		urlconfig.String(query, "sse_kms_key_id", ""),
+		urlconfig.String(query, "sse_kms_context", ""),
+		urlconfig.String(query, "sse_c_key", ""),
+	)
+	if err != nil {
+		return config, err
+	}
+	if config.Debug, err = urlconfig.Bool(query, "debug", false); err != nil {
+		return config, err
 	}
+
+	return config, nil
+}
+
+// String renvoie la configuration sous forme d'URL, sans la cle secrete
+func (c S3Config) String() string {
+	// On initialise
+	u := url.URL{
+		Scheme: BACKEND_NAME,
+		Host:   c.Endpoint,
+		Path:   "/" + c.BucketName + "/" + c.PathPrefix,
+	}
+	query := url.Values{}
+
+	// On masque la cle secrete
+	if c.AccessKeyID != "" {
+		u.User = url.UserPassword(c.AccessKeyID, "REDACTED")
+	}
+
+	// On ajoute les options
+	query.Set("region", c.Region)
+	query.Set("ssl", strconv.FormatBool(c.UseSSL))
+	if c.Debug {
+		query.Set("debug", "true")
+	}
+
+	// On ajoute le fournisseur d'identifiants et le chiffrement, sans le jeton de session ni la cle SSE-C
+	if c.CredentialsProvider != "" && c.CredentialsProvider != CREDENTIALS_PROVIDER_STATIC {
+		query.Set("credentials", c.CredentialsProvider)
+	}
+	for param, value := range map[string]string{
+		"credentials_file":        c.CredentialsFile,
+		"profile":                 c.CredentialsProfile,
+		"sts_endpoint":            c.STSEndpoint,
+		"web_identity_token_file": c.WebIdentityTokenFile,
+		"role_arn":                c.RoleARN,
+		"sse":                     string(c.Encryption.Mode),
+		"sse_kms_key_id":          c.Encryption.KMSKeyID,
+	} {
+		if value != "" {
+			query.Set(param, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
 }
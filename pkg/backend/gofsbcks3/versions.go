@@ -0,0 +1,120 @@
+package gofsbcks3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/minio/minio-go/v7"
+)
+
+// ListVersions renvoie les versions d'un fichier, le versioning doit etre active sur le bucket
+func (b *S3Backend) ListVersions(ctx context.Context, filePath string) ([]backend.Version, error) {
+	// On initialise
+	filePathWithPrefix := addPrefixedPath(b, filePath)
+	versions := make([]backend.Version, 0)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	b.logger.Debug().
+		Str("op", "ListVersions").
+		Str("path", filePathWithPrefix).
+		Send()
+
+	// On recupere les versions, le prefixe pouvant aussi correspondre a d'autres fichiers
+	objects := b.client.ListObjects(ctx, b.Config.BucketName, minio.ListObjectsOptions{
+		Prefix:       filePathWithPrefix,
+		Recursive:    true,
+		WithVersions: true,
+	})
+	for object := range objects {
+		if object.Err != nil {
+			return nil, errors.New("S3 Object error : " + object.Err.Error())
+		}
+		if object.Key != filePathWithPrefix {
+			continue
+		}
+		versions = append(versions, backend.Version{
+			VersionID:    object.VersionID,
+			Size:         object.Size,
+			ETag:         object.ETag,
+			LastModified: object.LastModified,
+			IsLatest:     object.IsLatest,
+			DeleteMarker: object.IsDeleteMarker,
+		})
+	}
+
+	if len(versions) == 0 {
+		return nil, backend.ErrNotExist
+	}
+	return versions, nil
+}
+
+func (b *S3Backend) ReadVersion(ctx context.Context, filePath string, versionID string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	// On initialise
+	fileStream := backend.FileStream{}
+	filePathWithPrefix := addPrefixedPath(b, filePath)
+	readOpts := backend.MergeReadOptions(opts)
+	getOpts := minio.GetObjectOptions{ServerSideEncryption: b.readServerSide(), VersionID: versionID}
+
+	b.logger.Debug().
+		Str("op", "ReadVersion").
+		Str("path", filePathWithPrefix).
+		Str("version", versionID).
+		Send()
+
+	// On recupere les infos de la version
+	stat, err := b.client.StatObject(ctx, b.Config.BucketName, filePathWithPrefix, getOpts)
+	if err != nil {
+		return fileStream, toBackendError(err)
+	}
+	fileStream.ContentType = stat.ContentType
+	fileStream.Size = stat.Size
+
+	// Si l'on ne lit qu'une partie du fichier
+	if readOpts.Offset > 0 || readOpts.Length > 0 {
+		if readOpts.Offset > stat.Size {
+			return fileStream, errors.New("read offset is beyond the end of file")
+		}
+		fileStream.Size = stat.Size - readOpts.Offset
+		if readOpts.Length > 0 && readOpts.Length < fileStream.Size {
+			fileStream.Size = readOpts.Length
+		}
+		if fileStream.Size == 0 {
+			fileStream.Content = io.NopCloser(strings.NewReader(""))
+			return fileStream, nil
+		}
+		getOpts.SetRange(readOpts.Offset, readOpts.Offset+fileStream.Size-1)
+	}
+
+	// On va chercher la version
+	object, err := b.client.GetObject(ctx, b.Config.BucketName, filePathWithPrefix, getOpts)
+	if err != nil {
+		return fileStream, errors.New("Unable to get the requested file version : " + err.Error())
+	}
+	fileStream.Content = object
+
+	return fileStream, nil
+}
+
+// DeleteVersion supprime definitivement une version, la precedente devenant courante si besoin
+func (b *S3Backend) DeleteVersion(ctx context.Context, filePath string, versionID string) error {
+	// On initialise
+	filePathWithPrefix := addPrefixedPath(b, filePath)
+
+	b.logger.Debug().
+		Str("op", "DeleteVersion").
+		Str("path", filePathWithPrefix).
+		Str("version", versionID).
+		Send()
+
+	// On supprime la version
+	return toBackendError(b.client.RemoveObject(
+		ctx,
+		b.Config.BucketName,
+		filePathWithPrefix,
+		minio.RemoveObjectOptions{VersionID: versionID},
+	))
+}
@@ -0,0 +1,136 @@
+package gofsbcks3
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/notification"
+)
+
+// Watch suit les changements avec les notifications de MinIO. Si le serveur ne les propose pas,
+// ou si l'ecoute est interrompue, on compare des listings successifs
+func (b *S3Backend) Watch(ctx context.Context, prefix string, opts backend.WatchOptions) (<-chan backend.Event, error) {
+	b.logger.Debug().
+		Str("op", "Watch").
+		Str("path", addPrefixedPath(b, prefix)).
+		Send()
+
+	// On recupere l'etat initial, qui sert aussi a distinguer une creation d'une modification
+	known, err := b.snapshot(ctx, prefix)
+	if err != nil {
+		return nil, errors.New("unable to list files : " + err.Error())
+	}
+
+	// On ecoute les notifications
+	events := make(chan backend.Event, backend.WATCH_BUFFER_SIZE)
+	notifications := b.client.ListenBucketNotification(
+		ctx,
+		b.Config.BucketName,
+		addPrefixedPath(b, prefix),
+		"",
+		[]string{string(notification.ObjectCreatedAll), string(notification.ObjectRemovedAll)},
+	)
+
+	go func() {
+		defer close(events)
+		for info := range notifications {
+			if info.Err != nil {
+				b.logger.Debug().
+					Str("op", "Watch").
+					Err(info.Err).
+					Msg("Bucket notifications not available, falling back to polling")
+				break
+			}
+			for _, record := range info.Records {
+				event, ok := b.notificationEvent(ctx, record, known)
+				if ok && !backend.SendEvent(ctx, events, event) {
+					return
+				}
+			}
+		}
+
+		// On compare ensuite des listings successifs, a partir de l'etat connu
+		if ctx.Err() != nil {
+			return
+		}
+		snapshot := func(ctx context.Context) (backend.Snapshot, error) {
+			return b.snapshot(ctx, prefix)
+		}
+		for event := range backend.PollWatch(ctx, opts.PollInterval, known, snapshot) {
+			if !backend.SendEvent(ctx, events, event) {
+				return
+			}
+		}
+	}()
+
+	return events, nil
+}
+
+// notificationEvent convertit une notification et met a jour l'etat connu
+func (b *S3Backend) notificationEvent(ctx context.Context, record notification.Event, known backend.Snapshot) (backend.Event, bool) {
+	// On recupere le chemin du fichier
+	key, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil || !strings.HasPrefix(key, b.Config.PathPrefix) {
+		return backend.Event{}, false
+	}
+	filePath := key[len(b.Config.PathPrefix):]
+	eventTime, err := time.Parse(time.RFC3339Nano, record.EventTime)
+	if err != nil {
+		eventTime = time.Now()
+	}
+
+	// Pour une suppression
+	if strings.HasPrefix(record.EventName, "s3:ObjectRemoved:") {
+		if _, exists := known[filePath]; !exists {
+			return backend.Event{}, false
+		}
+		delete(known, filePath)
+		return backend.Event{Type: backend.EVENT_DELETE, Path: filePath, Time: eventTime}, true
+	}
+
+	// Pour une ecriture
+	fInfo, err := b.Stat(ctx, filePath)
+	if err != nil {
+		return backend.Event{}, false
+	}
+	event := backend.Event{Type: backend.EVENT_MODIFY, Path: filePath, Info: fInfo, Time: eventTime}
+	if _, exists := known[filePath]; !exists {
+		event.Type = backend.EVENT_CREATE
+	}
+	known[filePath] = fInfo
+
+	return event, true
+}
+
+// snapshot liste les fichiers avec les infos renvoyees par le listing, sans les interroger un par un
+func (b *S3Backend) snapshot(ctx context.Context, prefix string) (backend.Snapshot, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	snapshot := make(backend.Snapshot)
+	objects := b.client.ListObjects(ctx, b.Config.BucketName, minio.ListObjectsOptions{
+		Prefix:    addPrefixedPath(b, prefix),
+		Recursive: true,
+	})
+	for object := range objects {
+		if object.Err != nil {
+			return nil, errors.New("S3 Object error : " + object.Err.Error())
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			continue
+		}
+		snapshot[object.Key[len(b.Config.PathPrefix):]] = backend.FileInfo{
+			Size:         object.Size,
+			ContentType:  object.ContentType,
+			ETag:         object.ETag,
+			LastModified: object.LastModified,
+		}
+	}
+
+	return snapshot, nil
+}
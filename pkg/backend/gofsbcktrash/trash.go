@@ -0,0 +1,346 @@
+package gofsbcktrash
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/rs/zerolog"
+)
+
+const (
+	DEFAULT_TRASH_PATH     = ".trash/"
+	DEFAULT_RETENTION      = 30 * 24 * time.Hour
+	DEFAULT_PURGE_INTERVAL = time.Hour
+	// Format de la date de suppression dans les chemins de la corbeille, triable par ordre chronologique
+	DELETED_AT_FORMAT = "20060102T150405.000000000Z"
+)
+
+type TrashConfig struct {
+	// Dossier de la corbeille, DEFAULT_TRASH_PATH par defaut
+	TrashPath string
+	// Duree de conservation des fichiers supprimes, DEFAULT_RETENTION par defaut
+	Retention time.Duration
+	// Intervalle entre deux purges automatiques, DEFAULT_PURGE_INTERVAL par defaut, negatif pour ne pas purger
+	PurgeInterval time.Duration
+	// Active les logs de debug de l'instance
+	Debug bool
+	// Logger de l'instance, le logger global par defaut
+	Logger *zerolog.Logger
+}
+
+// TrashEntry decrit un fichier de la corbeille
+type TrashEntry struct {
+	// Chemin d'origine du fichier
+	Path      string
+	DeletedAt time.Time
+	// Chemin du fichier dans la corbeille
+	TrashPath string
+}
+
+// TrashBackend deplace les fichiers supprimes dans une corbeille, d'ou ils peuvent etre restaures
+// jusqu'a leur purge. Les fichiers de la corbeille sont ranges sous <TrashPath><date de suppression>/<chemin d'origine>
+type TrashBackend struct {
+	Config TrashConfig
+	next   backend.Backend
+	stop   chan struct{}
+	done   chan struct{}
+	logger zerolog.Logger
+}
+
+func New(next backend.Backend, config TrashConfig) (*TrashBackend, error) {
+	// On applique les valeurs par defaut
+	if config.TrashPath == "" {
+		config.TrashPath = DEFAULT_TRASH_PATH
+	}
+	config.TrashPath = strings.Trim(config.TrashPath, "/") + "/"
+	if config.Retention == 0 {
+		config.Retention = DEFAULT_RETENTION
+	}
+	if config.PurgeInterval == 0 {
+		config.PurgeInterval = DEFAULT_PURGE_INTERVAL
+	}
+
+	// On verifie la configuration
+	if next == nil {
+		return nil, errors.New("missing backend to protect")
+	}
+	if config.TrashPath == "/" {
+		return nil, errors.New("invalid trash path")
+	}
+	if config.Retention < 0 {
+		return nil, errors.New("invalid retention[" + config.Retention.String() + "]")
+	}
+
+	// On demarre la purge
+	b := &TrashBackend{
+		Config: config,
+		next:   next,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+		logger: backend.NewLogger(config.Logger, "trash", config.Debug),
+	}
+	if config.PurgeInterval > 0 {
+		go b.purgeLoop()
+	} else {
+		close(b.done)
+	}
+
+	return b, nil
+}
+
+// Close arrete la purge en arriere plan
+func (b *TrashBackend) Close() error {
+	select {
+	case <-b.stop:
+	default:
+		close(b.stop)
+	}
+	<-b.done
+
+	return nil
+}
+
+func (b *TrashBackend) List(ctx context.Context, dirPath string, recursive bool) ([]string, error) {
+	files, err := b.next.List(ctx, dirPath, recursive)
+	if err != nil {
+		return files, err
+	}
+
+	// On masque la corbeille
+	visible := make([]string, 0, len(files))
+	for _, file := range files {
+		if !b.isTrashPath(path.Join(dirPath, file)) {
+			visible = append(visible, file)
+		}
+	}
+
+	return visible, nil
+}
+
+func (b *TrashBackend) Stat(ctx context.Context, filePath string) (backend.FileInfo, error) {
+	return b.next.Stat(ctx, filePath)
+}
+
+func (b *TrashBackend) Read(ctx context.Context, filePath string) ([]byte, error) {
+	return b.next.Read(ctx, filePath)
+}
+
+func (b *TrashBackend) ReadString(ctx context.Context, filePath string) (string, error) {
+	return b.next.ReadString(ctx, filePath)
+}
+
+func (b *TrashBackend) ReadStream(ctx context.Context, filePath string, opts ...backend.ReadOptions) (backend.FileStream, error) {
+	return b.next.ReadStream(ctx, filePath, opts...)
+}
+
+func (b *TrashBackend) Write(ctx context.Context, filePath string, data []byte, opts ...backend.WriteOptions) error {
+	return b.next.Write(ctx, filePath, data, opts...)
+}
+
+func (b *TrashBackend) WriteString(ctx context.Context, filePath string, content string, opts ...backend.WriteOptions) error {
+	return b.next.WriteString(ctx, filePath, content, opts...)
+}
+
+func (b *TrashBackend) WriteStream(ctx context.Context, filePath string, stream io.ReadCloser, length int64, opts ...backend.WriteOptions) error {
+	return b.next.WriteStream(ctx, filePath, stream, length, opts...)
+}
+
+func (b *TrashBackend) Copy(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.next.Copy(ctx, filePathSrc, filePathDst)
+}
+
+func (b *TrashBackend) Move(ctx context.Context, filePathSrc string, filePathDst string) error {
+	return b.next.Move(ctx, filePathSrc, filePathDst)
+}
+
+// Delete deplace le fichier dans la corbeille, un fichier de la corbeille est lui supprime definitivement
+func (b *TrashBackend) Delete(ctx context.Context, filePath string) error {
+	if b.isTrashPath(filePath) {
+		return b.next.Delete(ctx, filePath)
+	}
+
+	// On verifie que le fichier existe, Move ne le garantissant pas sur tous les backends.
+	// Un fichier expire n'est plus visible, il est supprime definitivement
+	if _, err := b.next.Stat(ctx, filePath); errors.Is(err, fs.ErrNotExist) {
+		return b.next.Delete(ctx, filePath)
+	} else if err != nil {
+		return err
+	}
+
+	// On le deplace dans la corbeille
+	trashPath := b.Config.TrashPath + time.Now().UTC().Format(DELETED_AT_FORMAT) + "/" + normalizePath(filePath)
+	if err := b.next.Move(ctx, filePath, trashPath); err != nil {
+		return fmt.Errorf("unable to move file[%s] to trash : %w", filePath, err)
+	}
+
+	// On informe
+	b.logger.Debug().
+		Str("op", "Delete").
+		Str("path", filePath).
+		Str("trash_path", trashPath).
+		Send()
+
+	return nil
+}
+
+func (b *TrashBackend) SetMetadata(ctx context.Context, filePath string, metadata map[string]string) error {
+	return b.next.SetMetadata(ctx, filePath, metadata)
+}
+
+// ListExpired renvoie les fichiers expires hors de la corbeille
+func (b *TrashBackend) ListExpired(ctx context.Context, dirPath string, now time.Time) ([]string, error) {
+	files, err := backend.ListExpired(ctx, b.next, dirPath, now)
+	if err != nil {
+		return files, err
+	}
+
+	// On ignore la corbeille, ses fichiers etant purges par leur anciennete
+	visible := make([]string, 0, len(files))
+	for _, file := range files {
+		if !b.isTrashPath(file) {
+			visible = append(visible, file)
+		}
+	}
+
+	return visible, nil
+}
+
+// ListTrash renvoie les fichiers de la corbeille dont le chemin d'origine commence par prefix,
+// du plus recemment supprime au plus ancien
+func (b *TrashBackend) ListTrash(ctx context.Context, prefix string) ([]TrashEntry, error) {
+	// On liste la corbeille
+	files, err := b.next.List(ctx, b.Config.TrashPath, true)
+	if err != nil {
+		return nil, errors.New("unable to list trash : " + err.Error())
+	}
+
+	// On decode chaque chemin
+	prefix = strings.TrimPrefix(prefix, "/")
+	entries := make([]TrashEntry, 0, len(files))
+	for _, file := range files {
+		entry, ok := b.parseTrashPath(normalizePath(path.Join(b.Config.TrashPath, file)))
+		if ok && strings.HasPrefix(entry.Path, prefix) {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].DeletedAt.After(entries[j].DeletedAt)
+	})
+
+	return entries, nil
+}
+
+// Restore remet en place la derniere version supprimee du fichier, qui ne doit pas exister
+func (b *TrashBackend) Restore(ctx context.Context, filePath string) error {
+	// On cherche le fichier dans la corbeille
+	filePath = normalizePath(filePath)
+	entries, err := b.ListTrash(ctx, filePath)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.Path == filePath {
+			return b.RestoreEntry(ctx, entry)
+		}
+	}
+
+	return backend.ErrNotExist
+}
+
+// RestoreEntry remet en place un fichier de la corbeille, son chemin d'origine ne doit pas exister
+func (b *TrashBackend) RestoreEntry(ctx context.Context, entry TrashEntry) error {
+	// On ne remplace pas un fichier existant
+	_, err := b.next.Stat(ctx, entry.Path)
+	if err == nil {
+		return &fs.PathError{Op: "restore", Path: entry.Path, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// On deplace le fichier
+	if err = b.next.Move(ctx, entry.TrashPath, entry.Path); err != nil {
+		return fmt.Errorf("unable to restore file[%s] : %w", entry.Path, err)
+	}
+
+	return nil
+}
+
+// Purge supprime definitivement les fichiers de la corbeille plus anciens que la duree de conservation,
+// et renvoie le nombre de fichiers supprimes
+func (b *TrashBackend) Purge(ctx context.Context) (int, error) {
+	// On recupere les fichiers
+	entries, err := b.ListTrash(ctx, "")
+	if err != nil {
+		return 0, err
+	}
+
+	// On supprime les plus anciens
+	limit := time.Now().Add(-b.Config.Retention)
+	purged := 0
+	for _, entry := range entries {
+		if entry.DeletedAt.After(limit) {
+			continue
+		}
+		if err = b.next.Delete(ctx, entry.TrashPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return purged, fmt.Errorf("unable to purge file[%s] : %w", entry.TrashPath, err)
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+func (b *TrashBackend) purgeLoop() {
+	defer close(b.done)
+	ticker := time.NewTicker(b.Config.PurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.stop:
+			return
+		case <-ticker.C:
+			purged, err := b.Purge(context.Background())
+			if err != nil {
+				b.logger.Warn().
+					Int("purged", purged).
+					Err(err).
+					Msg("Purge failed")
+			} else if purged > 0 {
+				b.logger.Debug().
+					Int("purged", purged).
+					Msg("Trash purged")
+			}
+		}
+	}
+}
+
+func (b *TrashBackend) isTrashPath(filePath string) bool {
+	return strings.HasPrefix(normalizePath(filePath)+"/", b.Config.TrashPath)
+}
+
+// parseTrashPath decode la date de suppression et le chemin d'origine
+func (b *TrashBackend) parseTrashPath(trashPath string) (TrashEntry, bool) {
+	parts := strings.SplitN(strings.TrimPrefix(trashPath, b.Config.TrashPath), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return TrashEntry{}, false
+	}
+	deletedAt, err := time.Parse(DELETED_AT_FORMAT, parts[0])
+	if err != nil {
+		return TrashEntry{}, false
+	}
+
+	return TrashEntry{Path: parts[1], DeletedAt: deletedAt, TrashPath: trashPath}, true
+}
+
+func normalizePath(filePath string) string {
+	return strings.TrimPrefix(path.Clean("/"+filePath), "/")
+}
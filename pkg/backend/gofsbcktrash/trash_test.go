@@ -0,0 +1,216 @@
+package gofsbcktrash
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+// newTestBackend ajoute une corbeille a un backend local, sans purge en arriere plan
+func newTestBackend(t *testing.T, config TrashConfig) (*TrashBackend, *gofsbcklocal.LocalBackend) {
+	t.Helper()
+	local, err := gofsbcklocal.New(gofsbcklocal.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.PurgeInterval = -1
+	b, err := New(local, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+
+	return b, local
+}
+
+func TestDelete(t *testing.T) {
+	ctx := context.Background()
+	b, local := newTestBackend(t, TrashConfig{})
+	if err := b.WriteString(ctx, "dir/file.txt", "content"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Le fichier est deplace dans la corbeille
+	before := time.Now()
+	if err := b.Delete(ctx, "/dir/file.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.Stat(ctx, "dir/file.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("stat error = %v, want %v", err, fs.ErrNotExist)
+	}
+	entries, err := b.ListTrash(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Path != "dir/file.txt" || entries[0].DeletedAt.Before(before.Add(-time.Second)) {
+		t.Fatalf("entries = %+v, want dir/file.txt just deleted", entries)
+	}
+	if content, err := local.ReadString(ctx, entries[0].TrashPath); err != nil || content != "content" {
+		t.Errorf("trash content = %q, %v, want %q", content, err, "content")
+	}
+
+	// Un fichier absent n'est pas deplace
+	if err = b.Delete(ctx, "missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("delete missing error = %v, want %v", err, fs.ErrNotExist)
+	}
+
+	// Un fichier de la corbeille est supprime definitivement
+	if err = b.Delete(ctx, entries[0].TrashPath); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err = b.ListTrash(ctx, ""); err != nil || len(entries) != 0 {
+		t.Errorf("entries = %+v, %v, want an empty trash", entries, err)
+	}
+}
+
+func TestListHidesTrash(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBackend(t, TrashConfig{})
+	for _, filePath := range []string{"kept.txt", "dir/deleted.txt", ".trashy/file.txt"} {
+		if err := b.WriteString(ctx, filePath, "content"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Delete(ctx, "dir/deleted.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		dirPath   string
+		recursive bool
+		want      []string
+	}{
+		{"recursive", "", true, []string{".trashy/file.txt", "kept.txt"}},
+		{"trash folder", DEFAULT_TRASH_PATH, true, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := b.List(ctx, tt.dirPath, tt.recursive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := range files {
+				files[i] = normalizePath(files[i])
+			}
+			sort.Strings(files)
+			if !reflect.DeepEqual(files, tt.want) {
+				t.Errorf("files = %v, want %v", files, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBackend(t, TrashConfig{})
+
+	// Deux versions du fichier sont supprimees successivement
+	for _, content := range []string{"v1", "v2"} {
+		if err := b.WriteString(ctx, "file", content); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.Delete(ctx, "file"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	entries, err := b.ListTrash(ctx, "file")
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("entries = %+v, %v, want 2 entries", entries, err)
+	}
+
+	// La derniere version supprimee est restauree
+	if err = b.Restore(ctx, "file"); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := b.ReadString(ctx, "file"); err != nil || content != "v2" {
+		t.Errorf("content = %q, %v, want %q", content, err, "v2")
+	}
+
+	// Un fichier existant n'est jamais remplace
+	if err = b.WriteString(ctx, "other", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Delete(ctx, "other"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.WriteString(ctx, "other", "current"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.Restore(ctx, "other"); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("restore error = %v, want %v", err, fs.ErrExist)
+	}
+	if err = b.RestoreEntry(ctx, entries[1]); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("restore entry error = %v, want %v", err, fs.ErrExist)
+	}
+	for filePath, want := range map[string]string{"file": "v2", "other": "current"} {
+		if content, err := b.ReadString(ctx, filePath); err != nil || content != want {
+			t.Errorf("%s content = %q, %v, want %q", filePath, content, err, want)
+		}
+	}
+
+	// Une version plus ancienne est restauree une fois le fichier supprime
+	if err = b.Delete(ctx, "file"); err != nil {
+		t.Fatal(err)
+	}
+	if err = b.RestoreEntry(ctx, entries[1]); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := b.ReadString(ctx, "file"); err != nil || content != "v1" {
+		t.Errorf("content = %q, %v, want %q", content, err, "v1")
+	}
+
+	// Un fichier absent de la corbeille ne peut pas etre restaure
+	if err = b.Restore(ctx, "missing"); !errors.Is(err, backend.ErrNotExist) {
+		t.Errorf("restore missing error = %v, want %v", err, backend.ErrNotExist)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctx := context.Background()
+	retention := time.Hour
+	b, local := newTestBackend(t, TrashConfig{Retention: retention})
+
+	// Les fichiers sont places dans la corbeille avec leur date de suppression
+	now := time.Now().UTC()
+	deleted := map[string]time.Duration{
+		"recent":      time.Minute,
+		"almost":      retention - time.Minute,
+		"expired":     retention + time.Minute,
+		"dir/old.txt": 10 * retention,
+	}
+	for filePath, age := range deleted {
+		trashPath := DEFAULT_TRASH_PATH + now.Add(-age).Format(DELETED_AT_FORMAT) + "/" + filePath
+		if err := local.WriteString(ctx, trashPath, "content"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Seuls les fichiers supprimes depuis plus longtemps que la retention sont purges
+	purged, err := b.Purge(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 2 {
+		t.Errorf("purged = %d, want 2", purged)
+	}
+	entries, err := b.ListTrash(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		paths = append(paths, entry.Path)
+	}
+	if want := []string{"recent", "almost"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("remaining = %v, want %v", paths, want)
+	}
+}
@@ -0,0 +1,334 @@
+package gofswebdav
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"time"
+
+	gofs "github.com/craimbault/go-fs"
+	"github.com/craimbault/go-fs/internal/backend"
+	"golang.org/x/net/webdav"
+)
+
+// fileInfo implemente os.FileInfo ainsi que webdav.ContentTyper et webdav.ETager
+type fileInfo struct {
+	name        string
+	size        int64
+	modTime     time.Time
+	isDir       bool
+	contentType string
+	etag        string
+}
+
+func newFileInfo(key string, info backend.FileInfo) *fileInfo {
+	return &fileInfo{
+		name:        path.Base("/" + key),
+		size:        info.Size,
+		modTime:     info.LastModified,
+		contentType: info.ContentType,
+		etag:        info.ETag,
+	}
+}
+
+func newDirInfo(key string) *fileInfo {
+	return &fileInfo{
+		name:  path.Base("/" + key),
+		isDir: true,
+	}
+}
+
+func (fi *fileInfo) Name() string       { return fi.name }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.isDir }
+func (fi *fileInfo) Sys() interface{}   { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	if fi.contentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return fi.contentType, nil
+}
+
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+	return `"` + fi.etag + `"`, nil
+}
+
+// readFile ouvre le contenu du fichier uniquement a la premiere lecture, a partir de la position courante,
+// ce qui permet au handler de faire des Seek pour connaitre la taille sans le telecharger
+type readFile struct {
+	fsys   *FileSystem
+	goFS   *gofs.GoFS
+	key    string
+	info   *fileInfo
+	stream io.ReadCloser
+	offset int64
+}
+
+func (f *readFile) Read(p []byte) (int, error) {
+	// Si le contenu n'est pas encore ouvert
+	if f.stream == nil {
+		if f.offset >= f.info.size {
+			return 0, io.EOF
+		}
+		// On ne lit qu'a partir de l'offset demande
+		fileStream, err := f.goFS.ReadStream(f.key, gofs.ReadOptions{Offset: f.offset})
+		if err != nil {
+			return 0, pathError("read", f.key, err)
+		}
+		f.stream = fileStream.Content
+	}
+
+	// On lit le contenu
+	n, err := f.stream.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	// On calcule la nouvelle position
+	newOffset := offset
+	switch whence {
+	case io.SeekCurrent:
+		newOffset += f.offset
+	case io.SeekEnd:
+		newOffset += f.info.size
+	}
+	if newOffset < 0 {
+		return 0, pathError("seek", f.key, fs.ErrInvalid)
+	}
+
+	// Si le contenu est deja ouvert, on le ferme afin de le rouvrir a la bonne position
+	if f.stream != nil && newOffset != f.offset {
+		f.stream.Close()
+		f.stream = nil
+	}
+	f.offset = newOffset
+
+	return newOffset, nil
+}
+
+func (f *readFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, pathError("readdir", f.key, errors.New("not a directory"))
+}
+
+func (f *readFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, pathError("write", f.key, fs.ErrPermission)
+}
+
+func (f *readFile) Close() error {
+	if f.stream == nil {
+		return nil
+	}
+	return f.stream.Close()
+}
+
+// writeFile stocke le contenu dans un fichier temporaire et l'envoie au backend a la fermeture
+type writeFile struct {
+	fsys    *FileSystem
+	goFS    *gofs.GoFS
+	key     string
+	tmp     *os.File
+	copySrc string
+}
+
+func newWriteFile(fsys *FileSystem, goFS *gofs.GoFS, key string) (*writeFile, error) {
+	// On cree le fichier temporaire
+	tmp, err := os.CreateTemp("", "gofs-webdav-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &writeFile{
+		fsys: fsys,
+		goFS: goFS,
+		key:  key,
+		tmp:  tmp,
+	}, nil
+}
+
+// ReadFrom est utilise par io.Copy : si la source est un fichier du meme FileSystem,
+// la copie sera faite directement par le backend a la fermeture
+func (f *writeFile) ReadFrom(r io.Reader) (int64, error) {
+	if src, ok := r.(*readFile); ok && src.fsys == f.fsys && src.offset == 0 && f.copySrc == "" {
+		if size, _ := f.tmp.Seek(0, io.SeekEnd); size == 0 {
+			f.copySrc = src.key
+			src.offset = src.info.size
+			return src.info.size, nil
+		}
+	}
+
+	// Sinon on ecrit dans le fichier temporaire
+	if err := f.materialize(); err != nil {
+		return 0, err
+	}
+	return io.Copy(f.tmp, r)
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+	if err := f.materialize(); err != nil {
+		return 0, err
+	}
+	return f.tmp.Write(p)
+}
+
+func (f *writeFile) Read(p []byte) (int, error) {
+	return 0, pathError("read", f.key, fs.ErrPermission)
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	if err := f.materialize(); err != nil {
+		return 0, err
+	}
+	return f.tmp.Seek(offset, whence)
+}
+
+func (f *writeFile) Readdir(count int) ([]fs.FileInfo, error) {
+	return nil, pathError("readdir", f.key, errors.New("not a directory"))
+}
+
+func (f *writeFile) Stat() (fs.FileInfo, error) {
+	// Si l'on copie un fichier existant, on renvoie ses infos
+	if f.copySrc != "" {
+		info, err := f.goFS.Stat(f.copySrc)
+		if err != nil {
+			return nil, pathError("stat", f.copySrc, err)
+		}
+		return newFileInfo(f.key, info), nil
+	}
+
+	// Sinon on utilise le fichier temporaire
+	info, err := f.tmp.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &fileInfo{
+		name:    path.Base("/" + f.key),
+		size:    info.Size(),
+		modTime: info.ModTime(),
+	}, nil
+}
+
+func (f *writeFile) Close() error {
+	// On supprime le fichier temporaire dans tous les cas
+	defer os.Remove(f.tmp.Name())
+	defer f.tmp.Close()
+
+	// Si l'on copie un fichier existant
+	if f.copySrc != "" {
+		if err := f.goFS.Copy(f.copySrc, f.key); err != nil {
+			return pathError("copy", f.key, err)
+		}
+		f.fsys.forgetDirs(f.key)
+		return nil
+	}
+
+	// Sinon on envoie le fichier temporaire
+	size, err := f.tmp.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if _, err = f.tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err = f.goFS.WriteStream(f.key, io.NopCloser(f.tmp), size); err != nil {
+		return pathError("write", f.key, err)
+	}
+	f.fsys.forgetDirs(f.key)
+
+	return nil
+}
+
+func (f *writeFile) materialize() error {
+	// Si une copie etait prevue, on recupere le contenu source
+	if f.copySrc == "" {
+		return nil
+	}
+	fileStream, err := f.goFS.ReadStream(f.copySrc)
+	if err != nil {
+		return pathError("read", f.copySrc, err)
+	}
+	defer fileStream.Content.Close()
+	f.copySrc = ""
+
+	_, err = io.Copy(f.tmp, fileStream.Content)
+	return err
+}
+
+// dirFile represente un dossier, dont le contenu est liste a la premiere lecture
+type dirFile struct {
+	fsys     *FileSystem
+	ctx      context.Context
+	key      string
+	info     fs.FileInfo
+	children []fs.FileInfo
+	listed   bool
+}
+
+func (f *dirFile) Readdir(count int) ([]fs.FileInfo, error) {
+	// Si l'on a pas encore liste le dossier
+	if !f.listed {
+		children, err := f.fsys.readDir(f.ctx, f.key)
+		if err != nil {
+			return nil, err
+		}
+		f.children = children
+		f.listed = true
+	}
+
+	// On renvoie tout le reste
+	if count <= 0 {
+		children := f.children
+		f.children = nil
+		return children, nil
+	}
+
+	// Sinon on renvoie au maximum count elements
+	if len(f.children) == 0 {
+		return nil, io.EOF
+	}
+	if count > len(f.children) {
+		count = len(f.children)
+	}
+	children := f.children[:count]
+	f.children = f.children[count:]
+	return children, nil
+}
+
+func (f *dirFile) Read(p []byte) (int, error) {
+	return 0, pathError("read", f.key, errors.New("is a directory"))
+}
+
+func (f *dirFile) Seek(offset int64, whence int) (int64, error) {
+	return 0, nil
+}
+
+func (f *dirFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *dirFile) Write(p []byte) (int, error) {
+	return 0, pathError("write", f.key, errors.New("is a directory"))
+}
+
+func (f *dirFile) Close() error {
+	return nil
+}
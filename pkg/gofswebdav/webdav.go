@@ -0,0 +1,344 @@
+package gofswebdav
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	gofs "github.com/craimbault/go-fs"
+	"golang.org/x/net/webdav"
+)
+
+// FileSystem implemente webdav.FileSystem au dessus d'une instance GoFS.
+// Les dossiers n'existant pas dans les backends, ils sont deduits des prefixes des fichiers.
+// Les dossiers vides crees via MKCOL sont conserves en memoire jusqu'a ce qu'un fichier y soit ecrit
+type FileSystem struct {
+	goFS *gofs.GoFS
+	mu   sync.Mutex
+	dirs map[string]struct{}
+}
+
+func New(goFS *gofs.GoFS) *FileSystem {
+	return &FileSystem{
+		goFS: goFS,
+		dirs: make(map[string]struct{}),
+	}
+}
+
+// NewHandler renvoie un handler HTTP WebDAV complet, utilisant le LockSystem en memoire
+func NewHandler(goFS *gofs.GoFS, prefix string) *webdav.Handler {
+	return &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: New(goFS),
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+func (fsys *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	// On initialise
+	key := toKey(name)
+	if key == "" {
+		return pathError("mkdir", name, fs.ErrExist)
+	}
+
+	// Si l'element existe deja
+	if _, err := fsys.Stat(ctx, name); err == nil {
+		return pathError("mkdir", name, fs.ErrExist)
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// Le dossier parent doit exister
+	if parent := path.Dir("/" + key); parent != "/" {
+		info, err := fsys.Stat(ctx, parent)
+		if err != nil {
+			return err
+		} else if !info.IsDir() {
+			return pathError("mkdir", name, fs.ErrInvalid)
+		}
+	}
+
+	// On garde le dossier en memoire
+	fsys.mu.Lock()
+	fsys.dirs[key] = struct{}{}
+	fsys.mu.Unlock()
+
+	return nil
+}
+
+func (fsys *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	// On initialise
+	key := toKey(name)
+
+	// Si l'on ouvre en ecriture
+	if flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		if key == "" {
+			return nil, pathError("open", name, fs.ErrInvalid)
+		}
+
+		// On ne peut pas ecrire sur un dossier
+		info, err := fsys.Stat(ctx, name)
+		if err == nil && info.IsDir() {
+			return nil, pathError("open", name, fs.ErrInvalid)
+		} else if err == nil && flag&os.O_EXCL != 0 {
+			return nil, pathError("open", name, fs.ErrExist)
+		} else if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		return newWriteFile(fsys, fsys.with(ctx), key)
+	}
+
+	// On recupere les infos
+	info, err := fsys.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// Si l'on a un dossier
+	if info.IsDir() {
+		return &dirFile{
+			fsys: fsys,
+			ctx:  ctx,
+			key:  key,
+			info: info,
+		}, nil
+	}
+
+	return &readFile{
+		fsys: fsys,
+		goFS: fsys.with(ctx),
+		key:  key,
+		info: info.(*fileInfo),
+	}, nil
+}
+
+func (fsys *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	// On initialise
+	key := toKey(name)
+	goFS := fsys.with(ctx)
+	if key == "" {
+		return pathError("remove", name, fs.ErrPermission)
+	}
+
+	// Si l'on a un fichier, on le supprime
+	if _, err := goFS.Stat(key); err == nil {
+		if err := goFS.Delete(key); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return pathError("remove", name, err)
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return pathError("remove", name, err)
+	}
+
+	// On supprime tout ce qui se trouve sous le prefixe
+	files, err := goFS.List(key+"/", true)
+	if err != nil {
+		return pathError("remove", name, err)
+	}
+	for _, file := range files {
+		if err := goFS.Delete(key + "/" + file); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return pathError("remove", name, err)
+		}
+	}
+
+	// On supprime les dossiers en memoire
+	fsys.mu.Lock()
+	for dir := range fsys.dirs {
+		if dir == key || strings.HasPrefix(dir, key+"/") {
+			delete(fsys.dirs, dir)
+		}
+	}
+	fsys.mu.Unlock()
+
+	return nil
+}
+
+func (fsys *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	// On initialise
+	oldKey := toKey(oldName)
+	newKey := toKey(newName)
+	goFS := fsys.with(ctx)
+	if oldKey == "" || newKey == "" {
+		return pathError("rename", oldName, fs.ErrPermission)
+	}
+
+	// On recupere les infos de la source
+	info, err := fsys.Stat(ctx, oldName)
+	if err != nil {
+		return err
+	}
+
+	// Si l'on a un fichier, on le deplace directement
+	if !info.IsDir() {
+		if err := goFS.Move(oldKey, newKey); err != nil {
+			return pathError("rename", oldName, err)
+		}
+		fsys.forgetDirs(newKey)
+		return nil
+	}
+
+	// Sinon on deplace chaque fichier present sous le prefixe
+	files, err := goFS.List(oldKey+"/", true)
+	if err != nil {
+		return pathError("rename", oldName, err)
+	}
+	for _, file := range files {
+		if err := goFS.Move(oldKey+"/"+file, newKey+"/"+file); err != nil {
+			return pathError("rename", oldName, err)
+		}
+	}
+
+	// On renomme les dossiers en memoire
+	fsys.mu.Lock()
+	for dir := range fsys.dirs {
+		if dir == oldKey || strings.HasPrefix(dir, oldKey+"/") {
+			delete(fsys.dirs, dir)
+			fsys.dirs[newKey+dir[len(oldKey):]] = struct{}{}
+		}
+	}
+	fsys.mu.Unlock()
+
+	return nil
+}
+
+func (fsys *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	// On initialise
+	key := toKey(name)
+	goFS := fsys.with(ctx)
+
+	// La racine est toujours un dossier
+	if key == "" {
+		return newDirInfo(key), nil
+	}
+
+	// Si l'on a un fichier
+	info, err := goFS.Stat(key)
+	if err == nil {
+		return newFileInfo(key, info), nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, pathError("stat", name, err)
+	}
+
+	// Sinon on regarde si l'on a un dossier
+	fsys.mu.Lock()
+	_, isVirtualDir := fsys.dirs[key]
+	fsys.mu.Unlock()
+	if isVirtualDir {
+		return newDirInfo(key), nil
+	}
+	isDir, err := hasFiles(goFS, key+"/")
+	if err != nil {
+		return nil, pathError("stat", name, err)
+	} else if isDir {
+		return newDirInfo(key), nil
+	}
+
+	return nil, pathError("stat", name, fs.ErrNotExist)
+}
+
+// hasFiles indique si des fichiers existent sous le prefixe. Le premier niveau suffit le plus souvent,
+// le listing recursif n'etant utilise que pour les dossiers ne contenant que des sous dossiers
+func hasFiles(goFS *gofs.GoFS, prefix string) (bool, error) {
+	files, err := goFS.List(prefix, false)
+	if err != nil || len(files) > 0 {
+		return len(files) > 0, err
+	}
+	files, err = goFS.List(prefix, true)
+
+	return len(files) > 0, err
+}
+
+func (fsys *FileSystem) readDir(ctx context.Context, key string) ([]os.FileInfo, error) {
+	// On initialise
+	goFS := fsys.with(ctx)
+	prefix := ""
+	if key != "" {
+		prefix = key + "/"
+	}
+	children := make(map[string]os.FileInfo)
+
+	// On liste tous les fichiers sous le prefixe
+	files, err := goFS.List(prefix, true)
+	if err != nil {
+		return nil, pathError("readdir", key, err)
+	}
+	for _, file := range files {
+		// Si l'element est dans un sous dossier, on ne garde que le dossier
+		if i := strings.Index(file, "/"); i >= 0 {
+			if _, exists := children[file[:i]]; !exists {
+				children[file[:i]] = newDirInfo(prefix + file[:i])
+			}
+			continue
+		}
+
+		// Sinon on recupere les infos du fichier
+		info, err := goFS.Stat(prefix + file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, pathError("readdir", key, err)
+		}
+		children[file] = newFileInfo(prefix+file, info)
+	}
+
+	// On ajoute les dossiers en memoire
+	fsys.mu.Lock()
+	for dir := range fsys.dirs {
+		if strings.HasPrefix(dir, prefix) && !strings.Contains(dir[len(prefix):], "/") {
+			if _, exists := children[dir[len(prefix):]]; !exists {
+				children[dir[len(prefix):]] = newDirInfo(dir)
+			}
+		}
+	}
+	fsys.mu.Unlock()
+
+	// On trie par nom
+	infos := make([]os.FileInfo, 0, len(children))
+	for _, info := range children {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Name() < infos[j].Name()
+	})
+
+	return infos, nil
+}
+
+func (fsys *FileSystem) forgetDirs(key string) {
+	// Les dossiers parents existent desormais via le prefixe du fichier
+	fsys.mu.Lock()
+	for dir := path.Dir(key); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		delete(fsys.dirs, dir)
+	}
+	fsys.mu.Unlock()
+}
+
+func (fsys *FileSystem) with(ctx context.Context) *gofs.GoFS {
+	goFS := fsys.goFS.WithContext(ctx)
+	return &goFS
+}
+
+func toKey(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func pathError(op string, name string, err error) error {
+	// On utilise les erreurs de os afin que le handler WebDAV renvoie les bons codes HTTP
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		err = os.ErrNotExist
+	case errors.Is(err, fs.ErrExist):
+		err = os.ErrExist
+	case errors.Is(err, fs.ErrPermission):
+		err = os.ErrPermission
+	}
+
+	return &os.PathError{Op: op, Path: name, Err: err}
+}
@@ -0,0 +1,97 @@
+package gofswebdav
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	gofs "github.com/craimbault/go-fs"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+// newTestServer expose une instance locale dans un dossier temporaire via un serveur WebDAV
+func newTestServer(t *testing.T) (*httptest.Server, *gofs.GoFS) {
+	t.Helper()
+	goFS, err := gofs.New(gofs.BACKEND_TYPE_LOCAL, gofsbcklocal.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(NewHandler(&goFS, "/dav"))
+	t.Cleanup(server.Close)
+
+	return server, &goFS
+}
+
+func TestHandler(t *testing.T) {
+	server, goFS := newTestServer(t)
+	if err := goFS.WriteString("nested/only/deep.txt", "deep"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Les etapes s'enchainent sur le meme serveur
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		headers    map[string]string
+		body       string
+		wantStatus int
+		wantBody   string
+	}{
+		{"put creates parents", "PUT", "/dav/a/b/file.txt", nil, "hello", http.StatusCreated, ""},
+		{"get file", "GET", "/dav/a/b/file.txt", nil, "", http.StatusOK, "hello"},
+		{"propfind file", "PROPFIND", "/dav/a/b/file.txt", map[string]string{"Depth": "0"}, "", http.StatusMultiStatus, "<D:getcontentlength>5</D:getcontentlength>"},
+		{"propfind directory", "PROPFIND", "/dav/a/", map[string]string{"Depth": "1"}, "", http.StatusMultiStatus, "/dav/a/b/"},
+		{"propfind directory of directories", "PROPFIND", "/dav/nested", map[string]string{"Depth": "1"}, "", http.StatusMultiStatus, "/dav/nested/only/"},
+		{"propfind missing", "PROPFIND", "/dav/missing", map[string]string{"Depth": "0"}, "", http.StatusNotFound, ""},
+		{"mkcol", "MKCOL", "/dav/empty", nil, "", http.StatusCreated, ""},
+		{"propfind empty directory", "PROPFIND", "/dav/empty", map[string]string{"Depth": "0"}, "", http.StatusMultiStatus, "<D:collection"},
+		{"mkcol existing", "MKCOL", "/dav/a", nil, "", http.StatusMethodNotAllowed, ""},
+		{"mkcol without parent", "MKCOL", "/dav/none/child", nil, "", http.StatusConflict, ""},
+		{"move file", "MOVE", "/dav/a/b/file.txt", map[string]string{"Destination": "/dav/a/moved.txt"}, "", http.StatusCreated, ""},
+		{"get moved file", "GET", "/dav/a/moved.txt", nil, "", http.StatusOK, "hello"},
+		{"get old file", "GET", "/dav/a/b/file.txt", nil, "", http.StatusNotFound, ""},
+		{"delete directory", "DELETE", "/dav/a", nil, "", http.StatusNoContent, ""},
+		{"get deleted file", "GET", "/dav/a/moved.txt", nil, "", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for key, value := range tt.headers {
+				if key == "Destination" {
+					value = server.URL + value
+				}
+				req.Header.Set(key, value)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d : %s", resp.StatusCode, tt.wantStatus, body)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %q", body, tt.wantBody)
+			}
+		})
+	}
+
+	// Le backend ne contient plus que le fichier ecrit directement
+	files, err := goFS.List("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || strings.TrimPrefix(files[0], "/") != "nested/only/deep.txt" {
+		t.Errorf("files = %v, want only nested/only/deep.txt", files)
+	}
+}
@@ -0,0 +1,283 @@
+package gofs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"errors"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+type SyncCompare string
+
+const (
+	// Copie les fichiers dont la taille est differente
+	SYNC_COMPARE_SIZE SyncCompare = "size"
+	// Copie les fichiers dont la taille est differente ou dont la source est plus recente
+	SYNC_COMPARE_MTIME SyncCompare = "mtime"
+	// Copie les fichiers dont le contenu est different, en utilisant l'ETag si possible
+	SYNC_COMPARE_CHECKSUM SyncCompare = "checksum"
+
+	DEFAULT_SYNC_WORKERS = 4
+)
+
+type SyncOptions struct {
+	// Dossiers a synchroniser dans la source et la destination
+	SrcPath string
+	DstPath string
+	// Methode de comparaison, SYNC_COMPARE_MTIME par defaut
+	Compare SyncCompare
+	// Nombre de fichiers traites en parallele, DEFAULT_SYNC_WORKERS par defaut
+	Workers int
+	// Supprime les fichiers de la destination absents de la source
+	Delete bool
+	// Globs appliques au chemin relatif, ou au nom du fichier s'ils ne contiennent pas de "/".
+	// Si Include est renseigne, seuls les fichiers correspondants sont traites, Exclude est prioritaire
+	Include []string
+	Exclude []string
+	// N'effectue aucune modification, le rapport indique ce qui serait fait
+	DryRun bool
+}
+
+type SyncError struct {
+	Path string
+	Err  error
+}
+
+func (e SyncError) Error() string {
+	return e.Path + " : " + e.Err.Error()
+}
+
+// SyncReport liste les chemins relatifs traites par la synchronisation
+type SyncReport struct {
+	Copied  []string
+	Skipped []string
+	Deleted []string
+	Failed  []SyncError
+	// Nombre d'octets copies
+	Bytes int64
+}
+
+// Sync copie dans dst les fichiers de src qui ont change, en parallele et en streaming.
+// Les erreurs propres a un fichier sont indiquees dans le rapport, seules les erreurs globales sont renvoyees
+func Sync(src GoFS, dst GoFS, opts SyncOptions) (SyncReport, error) {
+	// On initialise
+	report := SyncReport{}
+	if opts.Compare == "" {
+		opts.Compare = SYNC_COMPARE_MTIME
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = DEFAULT_SYNC_WORKERS
+	}
+
+	// Les dossiers sont des prefixes, "a", "/a" et "a/" designant le meme dossier
+	opts.SrcPath = syncPrefix(opts.SrcPath)
+	opts.DstPath = syncPrefix(opts.DstPath)
+
+	// On verifie les options
+	if opts.Compare != SYNC_COMPARE_SIZE && opts.Compare != SYNC_COMPARE_MTIME && opts.Compare != SYNC_COMPARE_CHECKSUM {
+		return report, errors.New("unknown sync compare method[" + string(opts.Compare) + "]")
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return report, errors.New("invalid glob[" + pattern + "] : " + err.Error())
+		}
+	}
+
+	// On liste les deux cotes
+	srcFiles, err := src.List(opts.SrcPath, true)
+	if err != nil {
+		return report, errors.New("unable to list source : " + err.Error())
+	}
+	dstFiles, err := dst.List(opts.DstPath, true)
+	if err != nil {
+		return report, errors.New("unable to list destination : " + err.Error())
+	}
+	srcFiles = syncRelative(srcFiles)
+	dstFiles = syncRelative(dstFiles)
+	dstExists := make(map[string]bool, len(dstFiles))
+	for _, file := range dstFiles {
+		dstExists[file] = true
+	}
+
+	// On traite les fichiers en parallele
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	files := make(chan string)
+	for i := 0; i < opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				copied, size, err := syncFile(&src, &dst, file, dstExists[file], opts)
+				mu.Lock()
+				if err != nil {
+					report.Failed = append(report.Failed, SyncError{Path: file, Err: err})
+				} else if copied {
+					report.Copied = append(report.Copied, file)
+					report.Bytes += size
+				} else {
+					report.Skipped = append(report.Skipped, file)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	srcExists := make(map[string]bool, len(srcFiles))
+	for _, file := range srcFiles {
+		if !syncMatch(file, opts) {
+			continue
+		}
+		srcExists[file] = true
+		files <- file
+	}
+	close(files)
+	wg.Wait()
+
+	// On supprime les fichiers en trop
+	if opts.Delete {
+		for _, file := range dstFiles {
+			if srcExists[file] || !syncMatch(file, opts) {
+				continue
+			}
+			if !opts.DryRun {
+				if err := dst.Delete(opts.DstPath + file); err != nil {
+					report.Failed = append(report.Failed, SyncError{Path: file, Err: err})
+					continue
+				}
+			}
+			report.Deleted = append(report.Deleted, file)
+		}
+	}
+
+	// On trie le rapport
+	sort.Strings(report.Copied)
+	sort.Strings(report.Skipped)
+	sort.Strings(report.Deleted)
+	sort.Slice(report.Failed, func(i, j int) bool { return report.Failed[i].Path < report.Failed[j].Path })
+
+	return report, nil
+}
+
+// syncPrefix transforme le chemin en prefixe de dossier, "." et "/" designant la racine
+func syncPrefix(dirPath string) string {
+	dirPath = strings.TrimPrefix(path.Clean("/"+dirPath), "/")
+	if dirPath != "" {
+		dirPath += "/"
+	}
+	return dirPath
+}
+
+// syncRelative retire le "/" de tete que certains backends ajoutent aux chemins listes
+func syncRelative(files []string) []string {
+	for i, file := range files {
+		files[i] = strings.TrimPrefix(file, "/")
+	}
+	return files
+}
+
+// syncMatch indique si le fichier est concerne par les globs
+func syncMatch(file string, opts SyncOptions) bool {
+	for _, pattern := range opts.Exclude {
+		if backend.MatchGlob(pattern, file) {
+			return false
+		}
+	}
+	if len(opts.Include) == 0 {
+		return true
+	}
+	for _, pattern := range opts.Include {
+		if backend.MatchGlob(pattern, file) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncFile copie le fichier s'il a change et renvoie la taille copiee
+func syncFile(src *GoFS, dst *GoFS, file string, exists bool, opts SyncOptions) (bool, int64, error) {
+	// On recupere les infos de la source
+	srcInfo, err := src.Stat(opts.SrcPath + file)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// Si le fichier existe dans la destination, on verifie s'il a change
+	if exists {
+		dstInfo, err := dst.Stat(opts.DstPath + file)
+		if err != nil && !errors.Is(err, ErrNotExist) {
+			return false, 0, err
+		}
+		if err == nil {
+			changed, err := syncChanged(src, dst, opts.SrcPath+file, opts.DstPath+file, srcInfo, dstInfo, opts.Compare)
+			if err != nil || !changed {
+				return false, 0, err
+			}
+		}
+	}
+
+	// On copie le contenu avec ses metadonnees
+	if opts.DryRun {
+		return true, srcInfo.Size, nil
+	}
+	fileStream, err := src.ReadStream(opts.SrcPath + file)
+	if err != nil {
+		return false, 0, err
+	}
+	err = dst.WriteStream(opts.DstPath+file, fileStream.Content, fileStream.Size, WriteOptions{Metadata: srcInfo.Metadata})
+	fileStream.Content.Close()
+	if err != nil {
+		return false, 0, err
+	}
+
+	return true, fileStream.Size, nil
+}
+
+func syncChanged(src *GoFS, dst *GoFS, srcPath string, dstPath string, srcInfo FileInfo, dstInfo FileInfo, compare SyncCompare) (bool, error) {
+	// Une taille differente suffit dans tous les cas
+	if srcInfo.Size != dstInfo.Size {
+		return true, nil
+	}
+
+	switch compare {
+	case SYNC_COMPARE_MTIME:
+		return srcInfo.LastModified.After(dstInfo.LastModified), nil
+	case SYNC_COMPARE_CHECKSUM:
+		// Des ETags identiques suffisent, sinon ils peuvent ne pas etre comparables (multipart, chiffrement, ...)
+		if srcInfo.ETag != "" && srcInfo.ETag == dstInfo.ETag {
+			return false, nil
+		}
+		srcSum, err := checksum(src, srcPath)
+		if err != nil {
+			return false, err
+		}
+		dstSum, err := checksum(dst, dstPath)
+		if err != nil {
+			return false, err
+		}
+		return !bytes.Equal(srcSum, dstSum), nil
+	}
+
+	return false, nil
+}
+
+func checksum(goFS *GoFS, filePath string) ([]byte, error) {
+	// On calcule le MD5 du contenu en streaming
+	fileStream, err := goFS.ReadStream(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fileStream.Content.Close()
+	hash := md5.New()
+	if _, err = io.Copy(hash, fileStream.Content); err != nil {
+		return nil, errors.New("unable to compute checksum : " + err.Error())
+	}
+
+	return hash.Sum(nil), nil
+}
@@ -0,0 +1,130 @@
+package gofs
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+// newTestGoFS initialise une instance locale dans un dossier temporaire
+func newTestGoFS(t *testing.T) GoFS {
+	t.Helper()
+	goFS, err := New(BACKEND_TYPE_LOCAL, gofsbcklocal.LocalConfig{BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return goFS
+}
+
+// writeFiles ecrit chaque fichier avec son contenu
+func writeFiles(t *testing.T, goFS GoFS, files map[string]string) {
+	t.Helper()
+	for filePath, content := range files {
+		if err := goFS.WriteString(filePath, content); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncPathForms(t *testing.T) {
+	tests := []struct {
+		name    string
+		srcPath string
+		dstPath string
+		srcDir  string
+		dstDir  string
+	}{
+		{"bare names", "a", "b", "a/", "b/"},
+		{"mixed trailing slash", "a", "b/", "a/", "b/"},
+		{"leading slash", "/a", "/b/", "a/", "b/"},
+		{"dot prefix", "./a/", "b", "a/", "b/"},
+		{"nested", "a/c", "/b/d/", "a/c/", "b/d/"},
+		{"root source", "/", "b", "", "b/"},
+		{"root destination", "a", "", "a/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newTestGoFS(t)
+			dst := newTestGoFS(t)
+			writeFiles(t, src, map[string]string{
+				tt.srcDir + "same":    "same",
+				tt.srcDir + "changed": "new content",
+				tt.srcDir + "sub/new": "new",
+			})
+			writeFiles(t, dst, map[string]string{
+				tt.dstDir + "same":    "same",
+				tt.dstDir + "changed": "old",
+				tt.dstDir + "extra":   "extra",
+			})
+			opts := SyncOptions{SrcPath: tt.srcPath, DstPath: tt.dstPath, Compare: SYNC_COMPARE_SIZE, Delete: true}
+
+			// Le premier passage copie les differences et supprime le fichier en trop
+			report, err := Sync(src, dst, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report.Failed) > 0 {
+				t.Fatalf("failed = %v", report.Failed)
+			}
+			if want := []string{"changed", "sub/new"}; !reflect.DeepEqual(report.Copied, want) {
+				t.Errorf("copied = %v, want %v", report.Copied, want)
+			}
+			if want := []string{"same"}; !reflect.DeepEqual(report.Skipped, want) {
+				t.Errorf("skipped = %v, want %v", report.Skipped, want)
+			}
+			if want := []string{"extra"}; !reflect.DeepEqual(report.Deleted, want) {
+				t.Errorf("deleted = %v, want %v", report.Deleted, want)
+			}
+
+			// La destination contient exactement la source
+			for _, file := range []string{"same", "changed", "sub/new"} {
+				want, _ := src.ReadString(tt.srcDir + file)
+				if got, err := dst.ReadString(tt.dstDir + file); err != nil || got != want {
+					t.Errorf("file[%s] = %q, %v, want %q", file, got, err, want)
+				}
+			}
+			if _, err := dst.Stat(tt.dstDir + "extra"); err == nil {
+				t.Error("extra file still exists")
+			}
+
+			// Le second passage n'a plus rien a faire
+			report, err = Sync(src, dst, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(report.Skipped)
+			if len(report.Copied) > 0 || len(report.Deleted) > 0 || len(report.Failed) > 0 {
+				t.Errorf("second sync copied %v, deleted %v, failed %v", report.Copied, report.Deleted, report.Failed)
+			}
+			if want := []string{"changed", "same", "sub/new"}; !reflect.DeepEqual(report.Skipped, want) {
+				t.Errorf("second sync skipped = %v, want %v", report.Skipped, want)
+			}
+		})
+	}
+}
+
+func TestSyncDryRun(t *testing.T) {
+	src := newTestGoFS(t)
+	dst := newTestGoFS(t)
+	writeFiles(t, src, map[string]string{"a/new": "new"})
+	writeFiles(t, dst, map[string]string{"b/extra": "extra"})
+
+	report, err := Sync(src, dst, SyncOptions{SrcPath: "a", DstPath: "b/", Delete: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Copied, []string{"new"}) || !reflect.DeepEqual(report.Deleted, []string{"extra"}) {
+		t.Errorf("report copied %v, deleted %v", report.Copied, report.Deleted)
+	}
+
+	// Rien n'a ete modifie
+	if _, err = dst.Stat("b/new"); err == nil {
+		t.Error("dry run copied a file")
+	}
+	if _, err = dst.Stat("b/extra"); err != nil {
+		t.Errorf("dry run deleted a file : %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package gofs
+
+import (
+	"errors"
+	"net/url"
+	"sync"
+
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcks3"
+)
+
+// urlConfigParsers associe chaque type de backend a la lecture de sa configuration depuis une URL
+var urlConfigParsers = map[GoFSBackendType]func(u *url.URL) (interface{}, error){
+	BACKEND_TYPE_LOCAL: func(u *url.URL) (interface{}, error) {
+		return gofsbcklocal.NewConfigFromURL(u)
+	},
+	BACKEND_TYPE_S3: func(u *url.URL) (interface{}, error) {
+		return gofsbcks3.NewConfigFromURL(u)
+	},
+}
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = map[string]GoFSBackendType{
+		"file":  BACKEND_TYPE_LOCAL,
+		"local": BACKEND_TYPE_LOCAL,
+		"s3":    BACKEND_TYPE_S3,
+	}
+)
+
+// RegisterScheme associe un schema d'URL a un type de backend, par exemple "minio" vers BACKEND_TYPE_S3
+func RegisterScheme(scheme string, backendType GoFSBackendType) error {
+	if _, exists := urlConfigParsers[backendType]; !exists {
+		return errors.New("unknown backend type[" + string(backendType) + "]")
+	}
+
+	schemesMu.Lock()
+	schemes[scheme] = backendType
+	schemesMu.Unlock()
+
+	return nil
+}
+
+// Open initialise une instance depuis une URL, par exemple
+// s3://key:secret@minio:9000/bucket/prefix?ssl=false ou file:///var/data
+func Open(dsn string, opts ...Option) (GoFS, error) {
+	// On analyse l'URL
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return GoFS{}, errors.New("invalid url : " + redactURLError(err))
+	}
+
+	// On recupere le backend correspondant au schema
+	schemesMu.RLock()
+	backendType, exists := schemes[u.Scheme]
+	schemesMu.RUnlock()
+	if !exists {
+		return GoFS{}, errors.New("unknown url scheme[" + u.Scheme + "]")
+	}
+
+	// On recupere la configuration du backend
+	config, err := urlConfigParsers[backendType](u)
+	if err != nil {
+		return GoFS{}, err
+	}
+
+	return New(backendType, config, opts...)
+}
+
+func redactURLError(err error) string {
+	// L'erreur de url.Parse contient l'URL complete, donc potentiellement le mot de passe
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err.Error()
+	}
+
+	return err.Error()
+}
@@ -0,0 +1,134 @@
+package gofs
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcks3"
+)
+
+func TestOpen(t *testing.T) {
+	basePath := t.TempDir()
+	tests := []struct {
+		name    string
+		dsn     string
+		wantErr string
+	}{
+		{"file url", "file://" + basePath, ""},
+		{"local url with debug", "local://" + basePath + "?debug=false", ""},
+		{"unknown scheme", "ftp://host/data", "unknown url scheme[ftp]"},
+		{"unknown parameter", "file://" + basePath + "?color=blue", "unknown url parameter[color]"},
+		{"invalid boolean", "file://" + basePath + "?debug=maybe", "invalid boolean value for url parameter[debug]"},
+		{"file url with host", "file://data/files", "file url must not have a host"},
+		{"file url without path", "file://", "missing base path in file url"},
+		{"s3 without credentials", "s3://minio:9000/bucket", "credentials"},
+		{"s3 without endpoint", "s3://key:secret@/bucket", "missing endpoint in s3 url"},
+		{"s3 without bucket", "s3://key:secret@minio:9000/", "missing bucket name in s3 url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			goFS, err := Open(tt.dsn)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if err = goFS.WriteString("file", "content"); err != nil {
+				t.Errorf("write : %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenRedactsParseErrors(t *testing.T) {
+	// L'URL invalide contenant le mot de passe n'est pas reprise dans l'erreur
+	_, err := Open("s3://key:supersecret@minio:port/bucket")
+	if err == nil {
+		t.Fatal("invalid url accepted")
+	}
+	if strings.Contains(err.Error(), "supersecret") {
+		t.Errorf("error = %v, want the password redacted", err)
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	if err := RegisterScheme("unknown", GoFSBackendType("ftp")); err == nil {
+		t.Error("scheme registered for an unknown backend type")
+	}
+	if err := RegisterScheme("disk", BACKEND_TYPE_LOCAL); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open("disk://" + t.TempDir()); err != nil {
+		t.Errorf("open with the registered scheme : %v", err)
+	}
+}
+
+func TestS3ConfigFromURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		dsn        string
+		wantPrefix string
+		wantSSL    bool
+		wantRegion string
+	}{
+		{"bucket only", "s3://key:secret@minio:9000/bucket", "", true, "us-east-1"},
+		{"bucket and prefix", "s3://key:secret@minio:9000/bucket/some/prefix/", "some/prefix/", true, "us-east-1"},
+		{"options", "s3://key:secret@minio:9000/bucket/data?ssl=false&region=eu-west-1", "data/", false, "eu-west-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.dsn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			config, err := gofsbcks3.NewConfigFromURL(u)
+			if err != nil {
+				t.Fatalf("unexpected error : %v", err)
+			}
+			if config.Endpoint != "minio:9000" || config.BucketName != "bucket" || config.AccessKeyID != "key" || config.SecretAccessKey != "secret" {
+				t.Errorf("config = %+v, want the url values", config)
+			}
+			if config.PathPrefix != tt.wantPrefix || config.UseSSL != tt.wantSSL || config.Region != tt.wantRegion {
+				t.Errorf("prefix, ssl, region = %q, %v, %q, want %q, %v, %q", config.PathPrefix, config.UseSSL, config.Region, tt.wantPrefix, tt.wantSSL, tt.wantRegion)
+			}
+
+			// La configuration affichable masque la cle secrete et se relit a l'identique
+			configString := config.String()
+			if strings.Contains(configString, "secret") || !strings.Contains(configString, "REDACTED") {
+				t.Errorf("string = %s, want the secret key redacted", configString)
+			}
+			u, err = url.Parse(configString)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reparsed, err := gofsbcks3.NewConfigFromURL(u)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reparsed.Endpoint != config.Endpoint || reparsed.BucketName != config.BucketName || reparsed.PathPrefix != config.PathPrefix || reparsed.UseSSL != config.UseSSL || reparsed.Region != config.Region {
+				t.Errorf("reparsed config = %+v, want %+v", reparsed, config)
+			}
+		})
+	}
+}
+
+func TestLocalConfigString(t *testing.T) {
+	tests := []struct {
+		config gofsbcklocal.LocalConfig
+		want   string
+	}{
+		{gofsbcklocal.LocalConfig{BasePath: "/var/data"}, "file:///var/data"},
+		{gofsbcklocal.LocalConfig{BasePath: "/var/data", Debug: true}, "file:///var/data?debug=true"},
+	}
+	for _, tt := range tests {
+		if got := tt.config.String(); got != tt.want {
+			t.Errorf("string = %s, want %s", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package gofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/craimbault/go-fs/internal/backend"
+)
+
+const DEFAULT_WALK_WORKERS = 8
+
+// readDirFunc lit un seul niveau d'un dossier, trie par nom
+type readDirFunc func(ctx context.Context, dir string) ([]fs.DirEntry, error)
+
+// Walk parcourt l'arborescence sous root dans l'ordre lexical, comme fs.WalkDir. La racine du backend est ".",
+// les chemins passes a fn peuvent etre utilises directement avec les autres appels.
+// Les erreurs de lecture d'un dossier sont passees a fn, fs.SkipDir et fs.SkipAll sont respectees.
+// Si root ne peut pas etre lu, fn est appelee avec une entree nil et l'erreur, qu'elle peut renvoyer
+func (gfs *GoFS) Walk(root string, fn fs.WalkDirFunc) error {
+	start := time.Now()
+	ctx := gfs.Context()
+	readDir, root, rootEntry, err := gfs.walkRoot(ctx, root)
+	if err != nil || !rootEntry.IsDir() {
+		err = fn(root, rootEntry, err)
+	} else {
+		err = walkDir(ctx, readDir, root, rootEntry, fn)
+	}
+	if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+		err = nil
+	}
+	gfs.logCall("Walk", root, start, -1, err)
+	return err
+}
+
+// WalkParallel parcourt l'arborescence en lisant plusieurs dossiers en parallele, fn doit donc pouvoir etre
+// appelee de maniere concurrente et l'ordre n'est pas garanti. Les entrees d'un meme dossier restent traitees
+// dans l'ordre, fs.SkipDir renvoyee pour un fichier ignore donc la suite du dossier.
+// La premiere erreur renvoyee par fn arrete le parcours, DEFAULT_WALK_WORKERS dossiers sont lus a la fois par defaut
+func (gfs *GoFS) WalkParallel(root string, workers int, fn fs.WalkDirFunc) error {
+	start := time.Now()
+	if workers <= 0 {
+		workers = DEFAULT_WALK_WORKERS
+	}
+	ctx, cancel := context.WithCancel(gfs.Context())
+	defer cancel()
+
+	// On traite la racine
+	readDir, root, rootEntry, err := gfs.walkRoot(ctx, root)
+	if err != nil || !rootEntry.IsDir() {
+		err = fn(root, rootEntry, err)
+		if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+			err = nil
+		}
+		gfs.logCall("WalkParallel", root, start, -1, err)
+		return err
+	}
+
+	// On initialise
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	stop := func(err error) {
+		mu.Lock()
+		if firstErr == nil && !errors.Is(err, fs.SkipAll) {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+
+	// visit traite un dossier, ses sous dossiers etant confies a d'autres goroutines
+	var visit func(dir string, d fs.DirEntry)
+	visit = func(dir string, d fs.DirEntry) {
+		defer wg.Done()
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		defer func() { <-sem }()
+
+		if err := fn(dir, d, nil); err != nil {
+			if !errors.Is(err, fs.SkipDir) {
+				stop(err)
+			}
+			return
+		}
+		entries, err := readDir(ctx, dir)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if err = fn(dir, d, err); err != nil && !errors.Is(err, fs.SkipDir) {
+				stop(err)
+			}
+			return
+		}
+		for _, entry := range entries {
+			if ctx.Err() != nil {
+				return
+			}
+			entryPath := path.Join(dir, entry.Name())
+			if entry.IsDir() {
+				wg.Add(1)
+				go visit(entryPath, entry)
+				continue
+			}
+			if err := fn(entryPath, entry, nil); err != nil {
+				if !errors.Is(err, fs.SkipDir) {
+					stop(err)
+				}
+				return
+			}
+		}
+	}
+	wg.Add(1)
+	visit(root, rootEntry)
+	wg.Wait()
+
+	// Une annulation du contexte d'origine interrompt aussi le parcours
+	if firstErr == nil {
+		firstErr = gfs.Context().Err()
+	}
+	gfs.logCall("WalkParallel", root, start, -1, firstErr)
+	return firstErr
+}
+
+// walkRoot renvoie la lecture de dossier a utiliser, le chemin normalise et l'entree de la racine
+func (gfs *GoFS) walkRoot(ctx context.Context, root string) (readDirFunc, string, fs.DirEntry, error) {
+	root = backend.CleanDir(root)
+
+	// Si la racine est un fichier, seul celui ci est parcouru
+	if root != "." {
+		if fInfo, err := gfs.b.Stat(ctx, root); err == nil {
+			return nil, root, backend.NewDirEntry(path.Base(root), false, fInfo), nil
+		}
+	}
+
+	// On lit les dossiers un par un si le backend le permet, sinon on deduit l'arborescence du listing
+	var readDir readDirFunc
+	err := ErrNotSupported
+	if dirReader, ok := gfs.b.(backend.DirReader); ok {
+		readDir = sortedReadDir(dirReader.ReadDir)
+		_, err = readDir(ctx, root)
+	}
+	if errors.Is(err, ErrNotSupported) {
+		tree, err := gfs.listTree(ctx, root)
+		if err != nil {
+			return nil, root, nil, err
+		}
+		readDir = sortedReadDir(func(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+			return tree[dir], nil
+		})
+	} else if err != nil {
+		// On verifie que la racine peut etre lue
+		return nil, root, nil, err
+	}
+
+	return readDir, root, backend.NewDirEntry(path.Base(root), true, FileInfo{}), nil
+}
+
+// listTree construit les entrees de chaque dossier a partir du listing recursif
+func (gfs *GoFS) listTree(ctx context.Context, root string) (map[string][]fs.DirEntry, error) {
+	prefix := ""
+	if root != "." {
+		prefix = root + "/"
+	}
+	files, err := gfs.b.List(ctx, prefix, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 && root != "." {
+		return nil, ErrNotExist
+	}
+
+	// On ajoute chaque fichier a son dossier, et chaque dossier a son parent
+	tree := map[string][]fs.DirEntry{root: {}}
+	dirs := map[string]bool{root: true}
+	for _, file := range files {
+		filePath := path.Join(root, strings.TrimPrefix(file, "/"))
+		dir := path.Dir(filePath)
+		tree[dir] = append(tree[dir], backend.NewDirEntry(path.Base(filePath), false, FileInfo{}))
+		for !dirs[dir] {
+			dirs[dir] = true
+			parent := path.Dir(dir)
+			tree[parent] = append(tree[parent], backend.NewDirEntry(path.Base(dir), true, FileInfo{}))
+			dir = parent
+		}
+	}
+
+	return tree, nil
+}
+
+// sortedReadDir trie les entrees par nom, comme fs.ReadDir
+func sortedReadDir(readDir readDirFunc) readDirFunc {
+	return func(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+		entries, err := readDir(ctx, dir)
+		if err != nil {
+			return nil, err
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+		return entries, nil
+	}
+}
+
+// walkDir parcourt le dossier et ses sous dossiers comme fs.WalkDir
+func walkDir(ctx context.Context, readDir readDirFunc, dir string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if err := fn(dir, d, nil); err != nil || !d.IsDir() {
+		if errors.Is(err, fs.SkipDir) && d.IsDir() {
+			err = nil
+		}
+		return err
+	}
+
+	// On lit le dossier, l'erreur etant confiee a fn
+	entries, err := readDir(ctx, dir)
+	if err != nil {
+		if err = fn(dir, d, err); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	// On parcourt les entrees
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := walkDir(ctx, readDir, path.Join(dir, entry.Name()), entry, fn); err != nil {
+			if errors.Is(err, fs.SkipDir) {
+				break
+			}
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,286 @@
+package gofs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/craimbault/go-fs/internal/backend"
+	"github.com/craimbault/go-fs/pkg/backend/gofsbcklocal"
+)
+
+var errUnreadable = errors.New("unreadable folder")
+
+// dirReaderBackend remplace la lecture de dossier du backend
+type dirReaderBackend struct {
+	backend.Backend
+	readDir func(ctx context.Context, dir string) ([]fs.DirEntry, error)
+}
+
+func (b dirReaderBackend) ReadDir(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+	return b.readDir(ctx, dir)
+}
+
+// newWalkTestGoFS renvoie une instance lisant les dossiers un par un et une autre deduisant l'arborescence du listing
+func newWalkTestGoFS(t *testing.T) map[string]GoFS {
+	t.Helper()
+	goFS := newTestGoFS(t)
+	writeFiles(t, goFS, map[string]string{
+		"a.txt":         "a",
+		"dir/b.txt":     "b",
+		"dir/sub/c.txt": "c",
+		"dir/sub/d.txt": "d",
+		"e/f.txt":       "f",
+	})
+	local := goFS.Backend()
+
+	return map[string]GoFS{
+		"read dir": goFS,
+		"list":     goFS.WithBackend(struct{ backend.Backend }{local}),
+		"read dir not supported": goFS.WithBackend(dirReaderBackend{local, func(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+			return nil, ErrNotSupported
+		}}),
+	}
+}
+
+// walkFunc garde les chemins parcourus, fn decidant de la suite du parcours
+func walkFunc(visited *[]string, fn func(path string, d fs.DirEntry, err error) error) fs.WalkDirFunc {
+	var mu sync.Mutex
+	return func(path string, d fs.DirEntry, err error) error {
+		mu.Lock()
+		*visited = append(*visited, path)
+		mu.Unlock()
+		if fn == nil {
+			return err
+		}
+		return fn(path, d, err)
+	}
+}
+
+var errStop = errors.New("stop")
+
+var walkTests = []struct {
+	name         string
+	root         string
+	fn           func(path string, d fs.DirEntry, err error) error
+	want         []string
+	wantParallel []string
+	wantErr      error
+}{
+	{
+		name: "whole tree",
+		root: "",
+		want: []string{".", "a.txt", "dir", "dir/b.txt", "dir/sub", "dir/sub/c.txt", "dir/sub/d.txt", "e", "e/f.txt"},
+	},
+	{
+		name: "folder",
+		root: "/dir/",
+		want: []string{"dir", "dir/b.txt", "dir/sub", "dir/sub/c.txt", "dir/sub/d.txt"},
+	},
+	{
+		name: "file",
+		root: "dir/b.txt",
+		want: []string{"dir/b.txt"},
+	},
+	{
+		name: "skip folder",
+		root: ".",
+		fn: func(path string, d fs.DirEntry, err error) error {
+			if path == "dir/sub" {
+				return fs.SkipDir
+			}
+			return err
+		},
+		want: []string{".", "a.txt", "dir", "dir/b.txt", "dir/sub", "e", "e/f.txt"},
+	},
+	{
+		name: "skip rest of folder",
+		root: "dir/sub",
+		fn: func(path string, d fs.DirEntry, err error) error {
+			if path == "dir/sub/c.txt" {
+				return fs.SkipDir
+			}
+			return err
+		},
+		want: []string{"dir/sub", "dir/sub/c.txt"},
+	},
+	{
+		name: "skip all",
+		root: "",
+		fn: func(path string, d fs.DirEntry, err error) error {
+			if path == "dir/sub/c.txt" {
+				return fs.SkipAll
+			}
+			return err
+		},
+		want:         []string{".", "a.txt", "dir", "dir/b.txt", "dir/sub", "dir/sub/c.txt"},
+		wantParallel: []string{".", "dir/sub", "dir/sub/c.txt"},
+	},
+	{
+		name: "stop on error",
+		root: "dir/sub",
+		fn: func(path string, d fs.DirEntry, err error) error {
+			if path == "dir/sub/c.txt" {
+				return errStop
+			}
+			return err
+		},
+		want:    []string{"dir/sub", "dir/sub/c.txt"},
+		wantErr: errStop,
+	},
+	{
+		name:    "missing root",
+		root:    "missing",
+		want:    []string{"missing"},
+		wantErr: ErrNotExist,
+	},
+}
+
+func TestWalk(t *testing.T) {
+	for name, goFS := range newWalkTestGoFS(t) {
+		for _, tt := range walkTests {
+			t.Run(name+"/"+tt.name, func(t *testing.T) {
+				visited := []string{}
+				err := goFS.Walk(tt.root, walkFunc(&visited, tt.fn))
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+				if !reflect.DeepEqual(visited, tt.want) {
+					t.Errorf("visited = %v, want %v", visited, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestWalkParallel(t *testing.T) {
+	for name, goFS := range newWalkTestGoFS(t) {
+		for _, tt := range walkTests {
+			for _, workers := range []int{0, 1} {
+				t.Run(name+"/"+tt.name, func(t *testing.T) {
+					visited := []string{}
+					err := goFS.WalkParallel(tt.root, workers, walkFunc(&visited, tt.fn))
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("error = %v, want %v", err, tt.wantErr)
+					}
+
+					// L'ordre n'est pas garanti, et les autres dossiers peuvent etre parcourus avant un arret
+					sort.Strings(visited)
+					if tt.wantParallel != nil {
+						if !containsAll(visited, tt.wantParallel) {
+							t.Errorf("visited = %v, want at least %v", visited, tt.wantParallel)
+						}
+						return
+					}
+					if !reflect.DeepEqual(visited, tt.want) {
+						t.Errorf("visited = %v, want %v", visited, tt.want)
+					}
+				})
+			}
+		}
+	}
+}
+
+func containsAll(values []string, wanted []string) bool {
+	found := make(map[string]bool, len(values))
+	for _, value := range values {
+		found[value] = true
+	}
+	for _, value := range wanted {
+		if !found[value] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func TestWalkUnreadableFolder(t *testing.T) {
+	goFS := newTestGoFS(t)
+	writeFiles(t, goFS, map[string]string{"dir/b.txt": "b", "dir/sub/c.txt": "c", "e/f.txt": "f"})
+	local := goFS.Backend().(backend.DirReader)
+	goFS = goFS.WithBackend(dirReaderBackend{goFS.Backend(), func(ctx context.Context, dir string) ([]fs.DirEntry, error) {
+		if dir == "dir/sub" {
+			return nil, errUnreadable
+		}
+		return local.ReadDir(ctx, dir)
+	}})
+
+	// L'erreur de lecture est passee a fn une fois le dossier visite
+	var mu sync.Mutex
+	readErrs := map[string]error{}
+	record := func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			mu.Lock()
+			readErrs[path] = err
+			mu.Unlock()
+		}
+		return nil
+	}
+	walks := map[string]func(fn fs.WalkDirFunc) error{
+		"walk":          func(fn fs.WalkDirFunc) error { return goFS.Walk("", fn) },
+		"walk parallel": func(fn fs.WalkDirFunc) error { return goFS.WalkParallel("", 2, fn) },
+	}
+	for name, walk := range walks {
+		t.Run(name, func(t *testing.T) {
+			readErrs = map[string]error{}
+			visited := []string{}
+			if err := walk(walkFunc(&visited, record)); err != nil {
+				t.Fatal(err)
+			}
+			if len(readErrs) != 1 || !errors.Is(readErrs["dir/sub"], errUnreadable) {
+				t.Errorf("read errors = %v, want %v for dir/sub", readErrs, errUnreadable)
+			}
+
+			// Les autres dossiers sont parcourus
+			sort.Strings(visited)
+			if want := []string{".", "dir", "dir/b.txt", "dir/sub", "dir/sub", "e", "e/f.txt"}; !reflect.DeepEqual(visited, want) {
+				t.Errorf("visited = %v, want %v", visited, want)
+			}
+
+			// L'erreur renvoyee par fn arrete le parcours
+			visited = []string{}
+			if err := walk(walkFunc(&visited, nil)); !errors.Is(err, errUnreadable) {
+				t.Errorf("error = %v, want %v", err, errUnreadable)
+			}
+		})
+	}
+
+	// Une racine illisible est passee a fn sans entree
+	visited := []string{}
+	var rootEntry fs.DirEntry = backend.NewDirEntry("", false, FileInfo{})
+	err := goFS.Walk("dir/sub", walkFunc(&visited, func(path string, d fs.DirEntry, err error) error {
+		rootEntry = d
+		return err
+	}))
+	if !errors.Is(err, errUnreadable) || rootEntry != nil || !reflect.DeepEqual(visited, []string{"dir/sub"}) {
+		t.Errorf("error = %v with entry %v after %v, want %v without entry", err, rootEntry, visited, errUnreadable)
+	}
+}
+
+func TestWalkPermissionDenied(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced for root")
+	}
+	basePath := t.TempDir()
+	goFS, err := New(BACKEND_TYPE_LOCAL, gofsbcklocal.LocalConfig{BasePath: basePath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFiles(t, goFS, map[string]string{"dir/sub/c.txt": "c"})
+	subPath := filepath.Join(basePath, "dir", "sub")
+	if err := os.Chmod(subPath, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(subPath, 0755)
+
+	if err := goFS.Walk("", func(path string, d fs.DirEntry, err error) error { return err }); !errors.Is(err, fs.ErrPermission) {
+		t.Errorf("error = %v, want %v", err, fs.ErrPermission)
+	}
+}